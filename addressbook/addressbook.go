@@ -0,0 +1,179 @@
+// Package addressbook imports contacts from address book exports. Every importer produces the
+// same records: a display name and the phone numbers (and optionally email addresses) of the
+// contact, with their labels, deduplicated.
+package addressbook
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Kind tells what an entry identifies
+type Kind int
+
+const (
+	// Phone is a phone number
+	Phone Kind = iota + 1
+	// Email is an email address
+	Email
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Phone:
+		return "phone"
+	case Email:
+		return "email"
+	default:
+		return "unknown"
+	}
+}
+
+// Entry is a phone number or email address of a contact
+type Entry struct {
+	Kind  Kind
+	Value string
+	// Labels such as "cell" or "work", lower case and sorted
+	Labels []string
+}
+
+// Record is an imported contact
+type Record struct {
+	Name    string
+	Entries []Entry
+}
+
+// Options control what importers extract
+type Options struct {
+	// Emails also imports email addresses
+	Emails bool
+}
+
+// EntryError reports a problem with one entry of the address book, such as a vCard or a CSV
+// row. Importers skip the entry and carry on.
+type EntryError struct {
+	// Entry is the 1-based index of the entry
+	Entry int
+	// Line is the line where the entry starts, or 0 if unknown
+	Line int
+	Err  error
+}
+
+func (e *EntryError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("addressbook: entry %d: %v", e.Entry, e.Err)
+	}
+	return fmt.Sprintf("addressbook: entry %d (line %d): %v", e.Entry, e.Line, e.Err)
+}
+
+// Errors lists the entries that could not be imported
+type Errors []*EntryError
+
+func (e Errors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%v (and %d more errors)", e[0], len(e)-1)
+}
+
+// Numbers returns the phone numbers of the records, each once, in order of appearance
+func Numbers(records []Record) []string {
+	var numbers []string
+	seen := map[string]bool{}
+	for _, r := range records {
+		for _, e := range r.Entries {
+			if e.Kind == Phone && !seen[e.Value] {
+				seen[e.Value] = true
+				numbers = append(numbers, e.Value)
+			}
+		}
+	}
+	return numbers
+}
+
+// Collects the records of an import, merging entries with the same value
+type collector struct {
+	records []Record
+	// Position of every entry value already seen
+	seen map[string][2]int
+}
+
+func newCollector() *collector {
+	return &collector{seen: map[string][2]int{}}
+}
+
+// Add a record. Entries already seen in an earlier record are merged into it, so a number
+// listed under two contacts only appears under the first.
+func (c *collector) add(name string, entries []Entry) {
+	c.records = append(c.records, Record{Name: name})
+	i := len(c.records) - 1
+	for _, e := range entries {
+		key := e.Kind.String() + ":" + e.Value
+		if pos, ok := c.seen[key]; ok {
+			existing := &c.records[pos[0]].Entries[pos[1]]
+			existing.Labels = mergeLabels(existing.Labels, e.Labels)
+			continue
+		}
+		e.Labels = mergeLabels(nil, e.Labels)
+		c.records[i].Entries = append(c.records[i].Entries, e)
+		c.seen[key] = [2]int{i, len(c.records[i].Entries) - 1}
+	}
+	if len(c.records[i].Entries) == 0 {
+		c.records = c.records[:i]
+	}
+}
+
+func mergeLabels(a, b []string) []string {
+	set := map[string]bool{}
+	for _, l := range append(append([]string(nil), a...), b...) {
+		if l = strings.ToLower(strings.TrimSpace(l)); l != "" {
+			set[l] = true
+		}
+	}
+	var out []string
+	for l := range set {
+		out = append(out, l)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Remove the separators that people type in phone numbers. Returns "" if what remains is not
+// a plausible number.
+func cleanPhone(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "tel:")
+	// Drop URI parameters such as ;ext=
+	if i := strings.IndexByte(s, ';'); i >= 0 {
+		s = s[:i]
+	}
+
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '+' && i == 0:
+			b.WriteRune(r)
+		case r == ' ', r == '\u00a0', r == '-', r == '.', r == '(', r == ')', r == '/':
+		default:
+			return ""
+		}
+	}
+	digits := strings.TrimPrefix(b.String(), "+")
+	if len(digits) < 3 {
+		return ""
+	}
+	return b.String()
+}
+
+// Lower-case an email address. Returns "" if it is not plausible.
+func cleanEmail(s string) string {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "mailto:")
+	at := strings.LastIndexByte(s, '@')
+	if at <= 0 || at == len(s)-1 || strings.ContainsAny(s, " \t,;<>") {
+		return ""
+	}
+	return strings.ToLower(s)
+}
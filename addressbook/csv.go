@@ -0,0 +1,320 @@
+package addressbook
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Column is a CSV column holding phone numbers or email addresses
+type Column struct {
+	// Header of the column holding the values
+	Header string
+	// Label given to the values of the column, such as "mobile"
+	Label string
+	// Header of a column holding the label of each row instead, as in Google exports
+	LabelHeader string
+}
+
+// CSVMapping tells which CSV columns hold what
+type CSVMapping struct {
+	// Columns holding parts of the name, joined with spaces
+	Name   []string
+	Phones []Column
+	Emails []Column
+	// Separator between several values in one cell, e.g. " ::: " in Google exports. Empty if
+	// cells hold a single value.
+	Separator string
+}
+
+// Separator of multi-valued cells in Google exports
+const googleSeparator = ":::"
+
+var (
+	// Google: "Phone 1 - Value" with its label in "Phone 1 - Type" (or "- Label" in newer exports)
+	googleValue = regexp.MustCompile(`^(Phone|E-mail) (\d+) - Value$`)
+
+	// Columns holding the whole name, in order of preference
+	fullNameHeaders = []string{"name", "full name", "display name"}
+	// Columns holding parts of the name, in order
+	namePartHeaders = [][]string{
+		{"first name", "given name"},
+		{"middle name", "additional name"},
+		{"last name", "family name", "surname"},
+	}
+)
+
+// DetectCSVMapping guesses the mapping of a CSV file from its header row. It recognises the
+// exports of Google Contacts and Outlook, and generic files with columns named like "Name",
+// "Phone", "Mobile" or "Email".
+func DetectCSVMapping(header []string) (*CSVMapping, error) {
+	m := &CSVMapping{}
+	index := map[string]string{}
+	for _, h := range header {
+		index[strings.ToLower(strings.TrimSpace(h))] = h
+	}
+
+	// Google exports pair every value column with a label column
+	used := map[string]bool{}
+	for _, h := range header {
+		match := googleValue.FindStringSubmatch(strings.TrimSpace(h))
+		if match == nil {
+			continue
+		}
+		c := Column{Header: h}
+		for _, suffix := range []string{" - Type", " - Label"} {
+			if l, ok := index[strings.ToLower(match[1]+" "+match[2]+suffix)]; ok {
+				c.LabelHeader = l
+				used[l] = true
+			}
+		}
+		if match[1] == "Phone" {
+			m.Phones = append(m.Phones, c)
+		} else {
+			m.Emails = append(m.Emails, c)
+		}
+		used[h] = true
+		m.Separator = googleSeparator
+	}
+
+	// Outlook and generic files name columns after the kind of value they hold
+	for _, h := range header {
+		if used[h] {
+			continue
+		}
+		switch kind, label := classifyHeader(h); kind {
+		case Phone:
+			m.Phones = append(m.Phones, Column{Header: h, Label: label})
+		case Email:
+			m.Emails = append(m.Emails, Column{Header: h, Label: label})
+		}
+	}
+
+	for _, name := range fullNameHeaders {
+		if h, ok := index[name]; ok {
+			m.Name = []string{h}
+			break
+		}
+	}
+	if m.Name == nil {
+		for _, part := range namePartHeaders {
+			for _, name := range part {
+				if h, ok := index[name]; ok {
+					m.Name = append(m.Name, h)
+					break
+				}
+			}
+		}
+	}
+
+	if len(m.Phones) == 0 {
+		return nil, errors.New("addressbook: no phone number column in CSV header")
+	}
+	return m, nil
+}
+
+// ParseCSVMapping reads a mapping given as a list of "field=Header" pairs separated by
+// semicolons, for files whose columns DetectCSVMapping does not recognise. Fields are "name",
+// "phone" and "email", repeated for every column that holds them, and "separator". Phone and
+// email columns may be given a label as in "phone:mobile=Portable". For example:
+//
+//	name=Nom;phone:mobile=Portable;phone:work=Travail;email=Courriel
+func ParseCSVMapping(spec string) (*CSVMapping, error) {
+	m := &CSVMapping{}
+	for _, pair := range strings.Split(spec, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		i := strings.Index(pair, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("addressbook: %q is not a field=Header pair", pair)
+		}
+		field, header := strings.TrimSpace(pair[:i]), strings.TrimSpace(pair[i+1:])
+		if header == "" {
+			return nil, fmt.Errorf("addressbook: no header for %q", field)
+		}
+		var label string
+		if j := strings.Index(field, ":"); j >= 0 {
+			field, label = field[:j], field[j+1:]
+		}
+		switch {
+		case field == "name" && label == "":
+			m.Name = append(m.Name, header)
+		case field == "phone":
+			m.Phones = append(m.Phones, Column{Header: header, Label: label})
+		case field == "email":
+			m.Emails = append(m.Emails, Column{Header: header, Label: label})
+		case field == "separator" && label == "":
+			m.Separator = header
+		default:
+			return nil, fmt.Errorf("addressbook: unknown field %q", pair[:i])
+		}
+	}
+	if len(m.Phones) == 0 {
+		return nil, errors.New("addressbook: no phone number column in mapping")
+	}
+	return m, nil
+}
+
+var headerWords = regexp.MustCompile(`[a-z0-9]+`)
+
+// Tell whether a column holds phone numbers or email addresses, and the label of its values.
+// "Business Phone 2" holds phone numbers labelled "business", "E-mail 2 Address" holds email
+// addresses, and "E-mail Type" holds neither.
+func classifyHeader(h string) (Kind, string) {
+	words := headerWords.FindAllString(strings.ToLower(h), -1)
+	var kind Kind
+	var label []string
+	for _, w := range words {
+		switch w {
+		case "phone", "telephone", "tel":
+			kind = Phone
+		case "mobile", "cell", "cellphone":
+			kind = Phone
+			label = append(label, "mobile")
+		case "email", "mail":
+			kind = Email
+		case "e", "address", "number", "primary":
+		case "type", "label", "display", "name", "kind":
+			// Describes values held elsewhere
+			return 0, ""
+		default:
+			// Drop numbering such as "Phone 2"
+			if strings.Trim(w, "0123456789") != "" {
+				label = append(label, w)
+			}
+		}
+	}
+	return kind, strings.Join(label, " ")
+}
+
+// ReadCSV imports the contacts of a CSV file whose first row is a header. If mapping is nil,
+// it is detected from the header with DetectCSVMapping.
+//
+// Rows with a wrong number of fields are skipped, and numbers that cannot be read are left
+// out. Both are reported per row in an Errors value, which is returned alongside the records
+// that were imported. Entry 1 is the first row after the header.
+func ReadCSV(r io.Reader, mapping *CSVMapping, opts Options) ([]Record, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("addressbook: empty CSV file")
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Excel writes a byte order mark in front of UTF-8 files
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	if mapping == nil {
+		if mapping, err = DetectCSVMapping(header); err != nil {
+			return nil, err
+		}
+	}
+	columns := map[string]int{}
+	for i, h := range header {
+		columns[h] = i
+	}
+	for _, h := range mapping.headers() {
+		if _, ok := columns[h]; !ok {
+			return nil, fmt.Errorf("addressbook: no column %q in CSV header", h)
+		}
+	}
+
+	c := newCollector()
+	var errs Errors
+	for row := 1; ; row++ {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); !ok {
+				return nil, err
+			}
+			errs = append(errs, &EntryError{Entry: row, Err: err})
+			continue
+		}
+		if len(fields) != len(header) {
+			errs = append(errs, &EntryError{Entry: row, Err: fmt.Errorf("%d fields, expected %d", len(fields), len(header))})
+			continue
+		}
+		get := func(h string) string {
+			if h == "" {
+				return ""
+			}
+			return fields[columns[h]]
+		}
+
+		var names []string
+		for _, h := range mapping.Name {
+			if n := strings.TrimSpace(get(h)); n != "" {
+				names = append(names, n)
+			}
+		}
+
+		var entries []Entry
+		add := func(kind Kind, cols []Column, clean func(string) string) {
+			for _, col := range cols {
+				labels := mapping.split(get(col.LabelHeader))
+				if col.Label != "" {
+					labels = append(labels, col.Label)
+				}
+				for i, v := range mapping.split(get(col.Header)) {
+					value := clean(v)
+					if value == "" {
+						errs = append(errs, &EntryError{Entry: row, Err: fmt.Errorf("invalid %s %q in column %q", kind, v, col.Header)})
+						continue
+					}
+					e := Entry{Kind: kind, Value: value, Labels: labels}
+					// Google gives one label per value when a cell holds several
+					if col.LabelHeader != "" && len(labels) > 1 && i < len(labels) {
+						e.Labels = labels[i : i+1]
+					}
+					entries = append(entries, e)
+				}
+			}
+		}
+		add(Phone, mapping.Phones, cleanPhone)
+		if opts.Emails {
+			add(Email, mapping.Emails, cleanEmail)
+		}
+		c.add(strings.Join(names, " "), entries)
+	}
+
+	if len(errs) > 0 {
+		return c.records, errs
+	}
+	return c.records, nil
+}
+
+func (m *CSVMapping) headers() []string {
+	headers := append([]string(nil), m.Name...)
+	for _, c := range append(append([]Column(nil), m.Phones...), m.Emails...) {
+		headers = append(headers, c.Header)
+		if c.LabelHeader != "" {
+			headers = append(headers, c.LabelHeader)
+		}
+	}
+	return headers
+}
+
+// Split a cell into its values. Google marks the primary value's label with "* ".
+func (m *CSVMapping) split(cell string) []string {
+	parts := []string{cell}
+	if m.Separator != "" {
+		parts = strings.Split(cell, m.Separator)
+	}
+	var values []string
+	for _, p := range parts {
+		if p = strings.TrimPrefix(strings.TrimSpace(p), "* "); p != "" {
+			values = append(values, p)
+		}
+	}
+	return values
+}
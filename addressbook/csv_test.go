@@ -0,0 +1,132 @@
+package addressbook
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadCSVGoogle(t *testing.T) {
+	input := "Name,Given Name,Family Name,Group Membership,E-mail 1 - Type,E-mail 1 - Value,Phone 1 - Type,Phone 1 - Value,Phone 2 - Type,Phone 2 - Value\n" +
+		"Alice Smith,Alice,Smith,* myContacts,* Home,Alice@Example.com,Mobile ::: Work,+44 7700 900123 ::: 020 7946 0018,Home,07700 900456\n" +
+		"Bob Jones,Bob,Jones,* myContacts,,,* Mobile,+447700900123,,\n" +
+		"Carol,Carol,,* myContacts,,,Other,07700 900789,,\n"
+
+	records, err := ReadCSV(strings.NewReader(input), nil, Options{Emails: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Record{
+		{Name: "Alice Smith", Entries: []Entry{
+			{Phone, "+447700900123", []string{"mobile"}},
+			{Phone, "02079460018", []string{"work"}},
+			{Phone, "07700900456", []string{"home"}},
+			{Email, "alice@example.com", []string{"home"}},
+		}},
+		// Bob's number duplicates Alice's first one
+		{Name: "Carol", Entries: []Entry{
+			{Phone, "07700900789", []string{"other"}},
+		}},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("Got %+v\nexpected %+v", records, want)
+	}
+}
+
+func TestReadCSVOutlook(t *testing.T) {
+	input := "\ufeffFirst Name,Middle Name,Last Name,E-mail Address,E-mail Type,E-mail Display Name,Business Phone,Business Phone 2,Home Fax,Mobile Phone\n" +
+		"Dave,J.,Brown,dave@example.com,SMTP,Dave Brown (dave@example.com),020 7946 0000,020 7946 0001,020 7946 0002,07700 900111\n"
+
+	records, err := ReadCSV(strings.NewReader(input), nil, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Record{
+		{Name: "Dave J. Brown", Entries: []Entry{
+			{Phone, "02079460000", []string{"business"}},
+			{Phone, "02079460001", []string{"business"}},
+			{Phone, "07700900111", []string{"mobile"}},
+		}},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("Got %+v\nexpected %+v", records, want)
+	}
+}
+
+func TestReadCSVErrors(t *testing.T) {
+	input := "Name,Mobile,Email,Notes\n" +
+		"Erin,07700 900222,erin@example.com,\n" +
+		"Frank,07700 900333\n" +
+		"Grace,call me,grace@example.com,\n" +
+		"Heidi,07700-900-444,,met at work\n"
+
+	records, err := ReadCSV(strings.NewReader(input), nil, Options{})
+	errs, ok := err.(Errors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("Expected 2 errors, got %v", err)
+	}
+	for i, entry := range []int{2, 3} {
+		if errs[i].Entry != entry || errs[i].Line != 0 {
+			t.Errorf("Error %d reported for row %d line %d: %v", i, errs[i].Entry, errs[i].Line, errs[i])
+		}
+	}
+	if numbers := Numbers(records); !reflect.DeepEqual(numbers, []string{"07700900222", "07700900444"}) {
+		t.Errorf("Wrong numbers imported: %v", numbers)
+	}
+
+	if _, err := ReadCSV(strings.NewReader("Name,Notes\nIvan,\n"), nil, Options{}); err == nil {
+		t.Errorf("Read a CSV file without phone numbers")
+	}
+	if _, err := ReadCSV(strings.NewReader(""), nil, Options{}); err == nil {
+		t.Errorf("Read an empty CSV file")
+	}
+}
+
+func TestReadCSVMapping(t *testing.T) {
+	input := "Nom,Portable,Travail\nJudy,07700 900555,01632 960000\n"
+	mapping := &CSVMapping{
+		Name:   []string{"Nom"},
+		Phones: []Column{{Header: "Portable", Label: "mobile"}, {Header: "Travail", Label: "work"}},
+	}
+
+	records, err := ReadCSV(strings.NewReader(input), mapping, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Record{
+		{Name: "Judy", Entries: []Entry{
+			{Phone, "07700900555", []string{"mobile"}},
+			{Phone, "01632960000", []string{"work"}},
+		}},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("Got %+v\nexpected %+v", records, want)
+	}
+
+	mapping.Emails = []Column{{Header: "Courriel"}}
+	if _, err := ReadCSV(strings.NewReader(input), mapping, Options{}); err == nil {
+		t.Errorf("Read a CSV file without a mapped column")
+	}
+}
+
+func TestParseCSVMapping(t *testing.T) {
+	mapping, err := ParseCSVMapping("name=Prénom; name=Nom;phone:mobile=Portable;phone=Fixe;email=Courriel;separator=|")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &CSVMapping{
+		Name:      []string{"Prénom", "Nom"},
+		Phones:    []Column{{Header: "Portable", Label: "mobile"}, {Header: "Fixe"}},
+		Emails:    []Column{{Header: "Courriel"}},
+		Separator: "|",
+	}
+	if !reflect.DeepEqual(mapping, want) {
+		t.Errorf("Got %+v\nexpected %+v", mapping, want)
+	}
+
+	for _, spec := range []string{"", "name=Nom", "phone", "phone=", "address=Adresse;phone=Fixe", "name:first=Nom;phone=Fixe"} {
+		if _, err := ParseCSVMapping(spec); err == nil {
+			t.Errorf("Parsed the invalid mapping %q", spec)
+		}
+	}
+}
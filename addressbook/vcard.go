@@ -0,0 +1,258 @@
+package addressbook
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A content line of a vCard, after unfolding
+type vcardLine struct {
+	number int
+	group  string
+	name   string
+	params map[string][]string
+	value  string
+}
+
+// ReadVCard imports the contacts of a vCard 3.0 or 4.0 file. It extracts the TEL properties,
+// and the EMAIL properties if opts.Emails is set, labelled with their TYPE parameters and with
+// the X-ABLabel of their group as written by Apple devices.
+//
+// Cards with structural problems (missing END, unsupported version) are skipped, and numbers
+// that cannot be read are left out. Both are reported per card in an Errors value, which is
+// returned alongside the records that were imported.
+func ReadVCard(r io.Reader, opts Options) ([]Record, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	c := newCollector()
+	var errs Errors
+	var card []vcardLine
+	inCard, index, start := false, 0, 0
+	for _, l := range lines {
+		switch {
+		case l.name == "BEGIN" && strings.EqualFold(l.value, "VCARD"):
+			if inCard {
+				errs = append(errs, &EntryError{index, start, errors.New("missing END:VCARD")})
+			}
+			inCard, index, start, card = true, index+1, l.number, nil
+		case l.name == "END" && strings.EqualFold(l.value, "VCARD"):
+			if !inCard {
+				errs = append(errs, &EntryError{index, l.number, errors.New("END:VCARD without BEGIN")})
+				continue
+			}
+			name, entries, cardErrs := parseCard(card, opts)
+			for _, e := range cardErrs {
+				errs = append(errs, &EntryError{index, start, e})
+			}
+			if name != "" || entries != nil {
+				c.add(name, entries)
+			}
+			inCard = false
+		case inCard:
+			card = append(card, l)
+		}
+	}
+	if inCard {
+		errs = append(errs, &EntryError{index, start, errors.New("missing END:VCARD")})
+	}
+
+	if len(errs) > 0 {
+		return c.records, errs
+	}
+	return c.records, nil
+}
+
+// Extract the name and entries of a card. A card with a fatal problem returns no entries.
+func parseCard(lines []vcardLine, opts Options) (string, []Entry, []error) {
+	var version, fn, n string
+	labels := map[string]string{}
+	for _, l := range lines {
+		switch l.name {
+		case "VERSION":
+			version = l.value
+		case "FN":
+			fn = unescapeText(l.value)
+		case "N":
+			n = structuredName(l.value)
+		case "X-ABLABEL":
+			if l.group != "" {
+				labels[l.group] = appleLabel(unescapeText(l.value))
+			}
+		}
+	}
+	if version != "3.0" && version != "4.0" {
+		return "", nil, []error{fmt.Errorf("unsupported vCard version %q", version)}
+	}
+	name := fn
+	if name == "" {
+		name = n
+	}
+
+	var entries []Entry
+	var errs []error
+	for _, l := range lines {
+		var e Entry
+		switch {
+		case l.name == "TEL":
+			e = Entry{Kind: Phone, Value: cleanPhone(l.value)}
+		case l.name == "EMAIL" && opts.Emails:
+			e = Entry{Kind: Email, Value: cleanEmail(l.value)}
+		default:
+			continue
+		}
+		if e.Value == "" {
+			errs = append(errs, fmt.Errorf("line %d: invalid %s %q", l.number, e.Kind, l.value))
+			continue
+		}
+		e.Labels = append(e.Labels, l.params["TYPE"]...)
+		if label, ok := labels[l.group]; ok && l.group != "" {
+			e.Labels = append(e.Labels, label)
+		}
+		entries = append(entries, e)
+	}
+	return name, entries, errs
+}
+
+// Read the content lines of a vCard file, joining folded lines
+func unfold(r io.Reader) ([]vcardLine, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var raw []string
+	var numbers []int
+	for n := 1; s.Scan(); n++ {
+		text := strings.TrimRight(s.Text(), "\r")
+		if (strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t")) && len(raw) > 0 {
+			raw[len(raw)-1] += text[1:]
+			continue
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		raw = append(raw, text)
+		numbers = append(numbers, n)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	lines := make([]vcardLine, 0, len(raw))
+	for i, text := range raw {
+		if l, ok := parseLine(text); ok {
+			l.number = numbers[i]
+			lines = append(lines, l)
+		}
+	}
+	return lines, nil
+}
+
+// Parse [group.]name *(;param) : value. Lines without a colon are ignored.
+func parseLine(text string) (vcardLine, bool) {
+	colon := indexUnquoted(text, ':')
+	if colon < 0 {
+		return vcardLine{}, false
+	}
+	l := vcardLine{value: text[colon+1:], params: map[string][]string{}}
+
+	parts := splitUnquoted(text[:colon], ';')
+	l.name = strings.ToUpper(parts[0])
+	if dot := strings.IndexByte(l.name, '.'); dot >= 0 {
+		l.group, l.name = l.name[:dot], l.name[dot+1:]
+	}
+	for _, p := range parts[1:] {
+		key, value := "TYPE", p
+		if eq := strings.IndexByte(p, '='); eq >= 0 {
+			key, value = strings.ToUpper(p[:eq]), p[eq+1:]
+		}
+		// Quoted values may hold lists too, as in TYPE="home,voice"
+		for _, v := range strings.Split(strings.Replace(value, `"`, "", -1), ",") {
+			if v != "" {
+				l.params[key] = append(l.params[key], strings.ToLower(v))
+			}
+		}
+	}
+	return l, true
+}
+
+func indexUnquoted(s string, sep byte) int {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			return i
+		}
+	}
+	return -1
+}
+
+func splitUnquoted(s string, sep byte) []string {
+	var parts []string
+	for {
+		i := indexUnquoted(s, sep)
+		if i < 0 {
+			return append(parts, s)
+		}
+		parts = append(parts, s[:i])
+		s = s[i+1:]
+	}
+}
+
+// Undo the escaping of TEXT values: \\, \, \; and \n
+func unescapeText(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n', 'N':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// Turn N:Family;Given;Additional;Prefix;Suffix into "Prefix Given Additional Family Suffix"
+func structuredName(value string) string {
+	parts := splitEscaped(value)
+	var names []string
+	for _, i := range []int{3, 1, 2, 0, 4} {
+		if i < len(parts) && parts[i] != "" {
+			names = append(names, parts[i])
+		}
+	}
+	return strings.Join(names, " ")
+}
+
+// Split a structured value on unescaped semicolons and unescape the components
+func splitEscaped(value string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case ';':
+			parts = append(parts, unescapeText(value[start:i]))
+			start = i + 1
+		}
+	}
+	return append(parts, unescapeText(value[start:]))
+}
+
+// Apple writes standard labels as _$!<Mobile>!$_
+func appleLabel(label string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(label, "_$!<"), ">!$_")
+}
@@ -0,0 +1,84 @@
+package addressbook
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testVCards = "BEGIN:VCARD\r\n" +
+	"VERSION:3.0\r\n" +
+	"N:Smith;Alice;;Dr.;\r\n" +
+	"TEL;TYPE=CELL,VOICE:+44 7700 900123\r\n" +
+	"TEL;TYPE=work:(020) 7946-0018\r\n" +
+	"EMAIL;TYPE=INTERNET:Alice@Example.com\r\n" +
+	"item1.TEL:07700 900 456\r\n" +
+	"item1.X-ABLabel:_$!<Mobile>!$_\r\n" +
+	"END:VCARD\r\n" +
+	"BEGIN:VCARD\r\n" +
+	"VERSION:4.0\r\n" +
+	"N:Jones;Bob;;;\r\n" +
+	"FN:Bob Jones\r\n" +
+	"TEL;VALUE=uri;TYPE=\"home,voice\";PREF=1:tel:+44-7700-\r\n" +
+	" 900789;ext=12\r\n" +
+	"TEL;TYPE=cell:+447700900123\r\n" +
+	"END:VCARD\r\n"
+
+func TestReadVCard(t *testing.T) {
+	records, err := ReadVCard(strings.NewReader(testVCards), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Record{
+		{Name: "Dr. Alice Smith", Entries: []Entry{
+			{Phone, "+447700900123", []string{"cell", "voice"}},
+			{Phone, "02079460018", []string{"work"}},
+			{Phone, "07700900456", []string{"mobile"}},
+		}},
+		// Bob's second number duplicates Alice's first one
+		{Name: "Bob Jones", Entries: []Entry{
+			{Phone, "+447700900789", []string{"home", "voice"}},
+		}},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("Got %+v\nexpected %+v", records, want)
+	}
+
+	records, err = ReadVCard(strings.NewReader(testVCards), Options{Emails: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := records[0].Entries[2]; e.Kind != Email || e.Value != "alice@example.com" {
+		t.Errorf("Email was not imported: %+v", records[0].Entries)
+	}
+
+	if numbers := Numbers(records); len(numbers) != 4 {
+		t.Errorf("Wrong numbers: %v", numbers)
+	}
+}
+
+func TestReadVCardErrors(t *testing.T) {
+	input := "BEGIN:VCARD\nVERSION:2.1\nFN:Old\nTEL:0123456\nEND:VCARD\n" +
+		"BEGIN:VCARD\nVERSION:3.0\nFN:Carol\nTEL:call me\nTEL:07700 900 111\nEND:VCARD\n" +
+		"BEGIN:VCARD\nVERSION:3.0\nFN:Truncated\nTEL:07700900222\n" +
+		"BEGIN:VCARD\nVERSION:4.0\nFN:Dave\nTEL:07700900333\nEND:VCARD\n"
+
+	records, err := ReadVCard(strings.NewReader(input), Options{})
+	errs, ok := err.(Errors)
+	if !ok || len(errs) != 3 {
+		t.Fatalf("Expected 3 errors, got %v", err)
+	}
+	for i, want := range []struct{ entry, line int }{{1, 1}, {2, 6}, {3, 12}} {
+		if errs[i].Entry != want.entry || errs[i].Line != want.line {
+			t.Errorf("Error %d reported for card %d line %d: %v", i, errs[i].Entry, errs[i].Line, errs[i])
+		}
+	}
+
+	var names []string
+	for _, r := range records {
+		names = append(names, r.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"Carol", "Dave"}) {
+		t.Errorf("Wrong cards imported: %v", names)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"github.com/nmohnblatt/cd_client/identifier"
+)
+
+// The shared keys derived with one identifier of a batch
+type batchResult struct {
+	// Position of the identifier in the batch. Results are streamed as they are ready, not in
+	// the order of the batch.
+	index int
+	id    identifier.Identifier
+	// One candidate contact per identifier of the user, none if the identifier is the user's own
+	candidates []*contact
+}
+
+// Derive shared keys with many identifiers across a pool of workers, at most one per CPU if
+// workers is not positive. Every identifier is hashed to G1 and G2 once, and the public keys are
+// reused for the pairings with each identifier of the user. Results are sent on the returned
+// channel as they are ready, and the channel is closed once the batch is done or ctx is
+// cancelled, in which case identifiers not processed yet are dropped.
+func deriveBatch(ctx context.Context, u *user, ids []identifier.Identifier, workers int) <-chan batchResult {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(ids) {
+		workers = len(ids)
+	}
+
+	jobs := make(chan int)
+	results := make(chan batchResult)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if ctx.Err() != nil {
+					return
+				}
+				r := batchResult{index: i, id: ids[i], candidates: candidatesOf(u, ids[i])}
+				select {
+				case results <- r:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for i := range ids {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
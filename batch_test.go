@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/nmohnblatt/cd_client/identifier"
+)
+
+func TestDeriveBatch(t *testing.T) {
+	s1 := newDummyServer(1)
+	alice := testUser(t, "Alice", "07111111111")
+	if err := alice.addIdentifier("alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	alice.obtainPrivateKeys(s1)
+
+	ids := []identifier.Identifier{alice.id}
+	for i := 0; i < 20; i++ {
+		id, err := identifier.NewPhone(fmt.Sprintf("07222 2222%02d", i), "GB")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	// Every identifier is streamed once, with the same keys as one at a time
+	got := make([][]*contact, len(ids))
+	for res := range deriveBatch(context.Background(), alice, ids, 4) {
+		if got[res.index] != nil || res.id != ids[res.index] {
+			t.Fatalf("Unexpected result for %v at %d", res.id, res.index)
+		}
+		got[res.index] = res.candidates
+	}
+	if len(got[0]) != 0 {
+		t.Errorf("Derived shared keys with Alice's own number")
+	}
+	for i, candidates := range got[1:] {
+		want := contactCandidates(alice, ids[i+1:i+2])
+		if len(candidates) != 2 {
+			t.Fatalf("Expected a candidate per identifier of Alice, got %d", len(candidates))
+		}
+		for j := range candidates {
+			if string(candidates[j].meetingPoint) != string(want[j].meetingPoint) || candidates[j].local != want[j].local {
+				t.Errorf("%v: batch and single derivation disagree", ids[i+1])
+			}
+		}
+	}
+
+	// Cancelling stops the batch and closes the stream
+	ctx, cancel := context.WithCancel(context.Background())
+	results := deriveBatch(ctx, alice, ids, 2)
+	<-results
+	cancel()
+	n := 1
+	for range results {
+		n++
+	}
+	if n == len(ids) {
+		t.Errorf("Cancelled batch ran to completion")
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/nmohnblatt/cd_client/identifier"
+	"go.dedis.ch/kyber/v3"
+)
+
+// Number of entries kept by the cache of a user. Each contact takes one entry for the hashes
+// of their identifier and one per identifier of the user for the shared keys.
+const defaultCacheSize = 1 << 14
+
+// Cache of the points identifiers hash to and of the shared keys derived with them, so that
+// contacts processed again on every sync only cost a lookup. It is safe for concurrent use.
+// When full, the least recently used entry is evicted.
+type pairingCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[cacheKey]*list.Element
+	// Entries, the most recently used first
+	order *list.List
+}
+
+// Public keys are cached under the suite and the contact identifier only, as hashing does not
+// depend on the key epoch. Shared keys are cached under our identifier and the epoch of its
+// private keys as well.
+type cacheKey struct {
+	suite   string
+	secret  bool
+	epoch   uint32
+	local   identifier.Identifier
+	contact identifier.Identifier
+}
+
+type cacheEntry struct {
+	key    cacheKey
+	p1, p2 kyber.Point
+}
+
+func newPairingCache(capacity int) *pairingCache {
+	return &pairingCache{capacity: capacity, entries: map[cacheKey]*list.Element{}, order: list.New()}
+}
+
+// Hash a contact identifier to its public keys, as derivePublicKeys
+func (pc *pairingCache) publicKeys(id identifier.Identifier) (pk1, pk2 kyber.Point) {
+	key := cacheKey{suite: suite.String(), contact: id}
+	if pk1, pk2, ok := pc.get(key); ok {
+		return pk1, pk2
+	}
+	pk1, pk2 = derivePublicKeys(id)
+	pc.put(key, pk1, pk2)
+	return pk1, pk2
+}
+
+// Derive shared keys with a contact from one of our registrations, as pairPublicKeys
+func (pc *pairingCache) sharedKeys(local *registration, epoch uint32, id identifier.Identifier, pk1, pk2 kyber.Point) (kyber.Point, kyber.Point) {
+	key := cacheKey{suite: suite.String(), secret: true, epoch: epoch, local: local.id, contact: id}
+	if shared12, shared21, ok := pc.get(key); ok {
+		return shared12, shared21
+	}
+	shared12, shared21 := pairPublicKeys(local, pk1, pk2)
+	pc.put(key, shared12, shared21)
+	return shared12, shared21
+}
+
+// Forget every shared key, for instance once new private keys were issued after a key
+// rotation. Hashes of identifiers are kept.
+func (pc *pairingCache) invalidateSecrets() {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	for key, e := range pc.entries {
+		if key.secret {
+			pc.order.Remove(e)
+			delete(pc.entries, key)
+		}
+	}
+}
+
+// Number of entries cached
+func (pc *pairingCache) len() int {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return pc.order.Len()
+}
+
+// Return copies of the cached points, so that callers cannot alter the cache
+func (pc *pairingCache) get(key cacheKey) (kyber.Point, kyber.Point, bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	e, ok := pc.entries[key]
+	if !ok {
+		return nil, nil, false
+	}
+	pc.order.MoveToFront(e)
+	entry := e.Value.(*cacheEntry)
+	return entry.p1.Clone(), entry.p2.Clone(), true
+}
+
+func (pc *pairingCache) put(key cacheKey, p1, p2 kyber.Point) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.capacity <= 0 {
+		return
+	}
+	if e, ok := pc.entries[key]; ok {
+		// Another worker derived the same points meanwhile
+		pc.order.MoveToFront(e)
+		return
+	}
+	for pc.order.Len() >= pc.capacity {
+		oldest := pc.order.Back()
+		pc.order.Remove(oldest)
+		delete(pc.entries, oldest.Value.(*cacheEntry).key)
+	}
+	pc.entries[key] = pc.order.PushFront(&cacheEntry{key: key, p1: p1.Clone(), p2: p2.Clone()})
+}
+
+// An entry of the cache as written next to the keystore. Points are marshalled.
+type cacheRecord struct {
+	Suite   string `json:"suite"`
+	Secret  bool   `json:"secret,omitempty"`
+	Epoch   uint32 `json:"epoch,omitempty"`
+	Local   string `json:"local,omitempty"`
+	Contact string `json:"contact"`
+	P1      []byte `json:"p1"`
+	P2      []byte `json:"p2"`
+}
+
+// Write the cached entries out, the least recently used first so that they are restored in order
+func (pc *pairingCache) marshal() ([]byte, error) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	records := make([]cacheRecord, 0, pc.order.Len())
+	for e := pc.order.Back(); e != nil; e = e.Prev() {
+		entry := e.Value.(*cacheEntry)
+		r := cacheRecord{Suite: entry.key.suite, Secret: entry.key.secret, Epoch: entry.key.epoch, Contact: entry.key.contact.String()}
+		if entry.key.secret {
+			r.Local = entry.key.local.String()
+		}
+		var err error
+		if r.P1, err = entry.p1.MarshalBinary(); err != nil {
+			return nil, err
+		}
+		if r.P2, err = entry.p2.MarshalBinary(); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return json.Marshal(records)
+}
+
+// Restore entries written by marshal. Shared keys are only restored if they were derived in
+// epoch, the epoch of the current private keys: those of other epochs can no longer be used.
+func (pc *pairingCache) unmarshal(data []byte, epoch uint32) error {
+	var records []cacheRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return errors.New("cache: malformed cache")
+	}
+	for _, r := range records {
+		if r.Suite != suite.String() || r.Secret && r.Epoch != epoch {
+			continue
+		}
+		key := cacheKey{suite: r.Suite, secret: r.Secret, epoch: r.Epoch}
+		var err error
+		if key.contact, err = identifier.Parse(r.Contact, ""); err != nil {
+			return errors.New("cache: " + r.Contact + ": " + err.Error())
+		}
+		// Identifiers hash to G1 and G2, and shared keys are pairings in GT
+		p1, p2 := suite.G1().Point(), suite.G2().Point()
+		if r.Secret {
+			if key.local, err = identifier.Parse(r.Local, ""); err != nil {
+				return errors.New("cache: " + r.Local + ": " + err.Error())
+			}
+			p1, p2 = suite.GT().Point(), suite.GT().Point()
+		}
+		if p1.UnmarshalBinary(r.P1) != nil || p2.UnmarshalBinary(r.P2) != nil {
+			return errors.New("cache: malformed point")
+		}
+		pc.put(key, p1, p2)
+	}
+	return nil
+}
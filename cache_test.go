@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nmohnblatt/cd_client/identifier"
+)
+
+func TestPairingCache(t *testing.T) {
+	alice := testUser(t, "Alice", "07111111111")
+	alice.obtainPrivateKeys(newDummyServer(1))
+	bob := testUser(t, "Bob", "07222222222")
+
+	first := newContact(alice, bob.id)
+	if n := alice.cache.len(); n != 2 {
+		t.Fatalf("Expected the hashes and the shared keys of Bob to be cached, got %d entries", n)
+	}
+	// Callers get copies of the cached points
+	first.sharedAB.Null()
+	again := newContact(alice, bob.id)
+	sharedAB, _ := deriveSharedKeys(alice.registration, bob.id)
+	if !again.sharedAB.Equal(sharedAB) || alice.cache.len() != 2 {
+		t.Errorf("Cached shared keys differ from the derived ones")
+	}
+
+	// Keys issued after a rotation invalidate the shared keys but not the hashes
+	alice.obtainPrivateKeys(newDummyServer(2))
+	if n := alice.cache.len(); n != 1 {
+		t.Errorf("Expected only the hashes to be kept, got %d entries", n)
+	}
+	sharedAB, _ = deriveSharedKeys(alice.registration, bob.id)
+	if rotated := newContact(alice, bob.id); !rotated.sharedAB.Equal(sharedAB) || rotated.sharedAB.Equal(again.sharedAB) {
+		t.Errorf("Shared keys from before the rotation were reused")
+	}
+}
+
+func TestPairingCacheEviction(t *testing.T) {
+	pc := newPairingCache(3)
+	ids := []identifier.Identifier{
+		{Kind: identifier.Username, Value: "alice"},
+		{Kind: identifier.Username, Value: "bob"},
+		{Kind: identifier.Username, Value: "charlie"},
+		{Kind: identifier.Username, Value: "dave"},
+	}
+	for _, id := range ids[:3] {
+		pc.publicKeys(id)
+	}
+	// Alice was used last, so Bob is evicted to make room for Dave
+	pc.publicKeys(ids[0])
+	pc.publicKeys(ids[3])
+	if pc.len() != 3 {
+		t.Errorf("Cache grew to %d entries", pc.len())
+	}
+	for i, want := range []bool{true, false, true, true} {
+		if _, _, ok := pc.get(cacheKey{suite: suite.String(), contact: ids[i]}); ok != want {
+			t.Errorf("%v: cached %v, expected %v", ids[i], ok, want)
+		}
+	}
+}
+
+func TestPairingCacheSaved(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cd_client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	alice := testUser(t, "Alice", "07111111111")
+	alice.obtainPrivateKeys(newDummyServer(1))
+	alice.keystore = &keystoreFile{path: filepath.Join(dir, "keys"), passphrase: []byte("pass")}
+	bob := testUser(t, "Bob", "07222222222")
+	want := newContact(alice, bob.id)
+	if err := alice.saveCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next run finds the hashes and the shared keys of Bob
+	alice.cache = newPairingCache(defaultCacheSize)
+	if err := alice.loadCache(); err != nil {
+		t.Fatal(err)
+	}
+	if n := alice.cache.len(); n != 2 {
+		t.Fatalf("Expected the hashes and the shared keys of Bob to be restored, got %d entries", n)
+	}
+	if c := newContact(alice, bob.id); !c.sharedAB.Equal(want.sharedAB) || !c.sharedBA.Equal(want.sharedBA) {
+		t.Errorf("Restored shared keys differ from the derived ones")
+	}
+
+	// Shared keys of another epoch are not restored
+	alice.cache = newPairingCache(defaultCacheSize)
+	alice.epoch++
+	if err := alice.loadCache(); err != nil || alice.cache.len() != 1 {
+		t.Errorf("Expected only the hashes to be restored in another epoch, got %d entries (%v)", alice.cache.len(), err)
+	}
+}
@@ -0,0 +1,166 @@
+// Package channel implements a real-time channel between two contacts on top of a pubsub
+// transport such as IPFS pubsub. The topic and the key are derived from the contacts' key
+// schedule, so only the two contacts can find the channel and read its frames.
+//
+// Frames are sealed with XChaCha20-Poly1305 under a random nonce. Each frame carries the
+// random identifier of the channel instance that sent it, so that a receiver can ignore its
+// own frames, and a timestamp, so that old frames cannot be replayed.
+package channel
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// FrameType tells how the payload of a frame should be interpreted
+type FrameType byte
+
+const (
+	// Presence announces that the sender is online
+	Presence FrameType = iota + 1
+	// Invite carries an invitation, e.g. to a group meeting point
+	Invite
+	// Message carries application data
+	Message
+	// Stream carries a message of an encrypted stream between the contacts
+	Stream
+)
+
+// MaxSkew is how far in the past or future a frame timestamp may be
+const MaxSkew = 2 * time.Minute
+
+const (
+	senderSize = 8
+	headerSize = 1 + senderSize + 8
+)
+
+// Frame is a decrypted frame received on a channel
+type Frame struct {
+	Type    FrameType
+	Sent    time.Time
+	Payload []byte
+}
+
+// Channel is one end of a live channel between two contacts
+type Channel struct {
+	ps     PubSub
+	topic  string
+	aead   cipher.AEAD
+	sender [senderSize]byte
+
+	// Nonces seen within the replay window
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// Open returns a channel on topic, keyed with a 32-byte key
+func Open(ps PubSub, topic string, key []byte) (*Channel, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	c := &Channel{ps: ps, topic: topic, aead: aead, seen: map[string]time.Time{}}
+	if _, err := rand.Read(c.sender[:]); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Send publishes a frame
+func (c *Channel) Send(t FrameType, payload []byte) error {
+	plaintext := make([]byte, headerSize, headerSize+len(payload))
+	plaintext[0] = byte(t)
+	copy(plaintext[1:], c.sender[:])
+	binary.BigEndian.PutUint64(plaintext[1+senderSize:], uint64(time.Now().UnixNano()))
+	plaintext = append(plaintext, payload...)
+
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(plaintext)+c.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	return c.ps.Publish(c.topic, c.aead.Seal(nonce, nonce, plaintext, []byte(c.topic)))
+}
+
+// AnnouncePresence tells the contact that we are online
+func (c *Channel) AnnouncePresence() error {
+	return c.Send(Presence, nil)
+}
+
+// Receive subscribes to the channel and delivers the contact's frames until ctx is cancelled.
+// Frames that do not decrypt, that we sent ourselves, or that are replayed are dropped.
+func (c *Channel) Receive(ctx context.Context) (<-chan Frame, error) {
+	messages, err := c.ps.Subscribe(ctx, c.topic)
+	if err != nil {
+		return nil, err
+	}
+
+	frames := make(chan Frame)
+	go func() {
+		defer close(frames)
+		for data := range messages {
+			f, err := c.open(data)
+			if err != nil {
+				continue
+			}
+			select {
+			case frames <- *f:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return frames, nil
+}
+
+func (c *Channel) open(data []byte) (*Frame, error) {
+	n := c.aead.NonceSize()
+	if len(data) < n {
+		return nil, errors.New("channel: frame too short")
+	}
+	nonce := data[:n]
+	plaintext, err := c.aead.Open(nil, nonce, data[n:], []byte(c.topic))
+	if err != nil {
+		return nil, err
+	}
+	if len(plaintext) < headerSize {
+		return nil, errors.New("channel: malformed frame")
+	}
+
+	if string(plaintext[1:1+senderSize]) == string(c.sender[:]) {
+		return nil, errors.New("channel: own frame")
+	}
+	sent := time.Unix(0, int64(binary.BigEndian.Uint64(plaintext[1+senderSize:])))
+	if err := c.checkReplay(nonce, sent); err != nil {
+		return nil, err
+	}
+
+	return &Frame{Type: FrameType(plaintext[0]), Sent: sent, Payload: plaintext[headerSize:]}, nil
+}
+
+// Reject frames outside the time window, and frames seen before within it
+func (c *Channel) checkReplay(nonce []byte, sent time.Time) error {
+	now := time.Now()
+	if sent.Before(now.Add(-MaxSkew)) || sent.After(now.Add(MaxSkew)) {
+		return errors.New("channel: stale frame")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for n, t := range c.seen {
+		if t.Before(now.Add(-MaxSkew)) {
+			delete(c.seen, n)
+		}
+	}
+	if _, ok := c.seen[string(nonce)]; ok {
+		return errors.New("channel: replayed frame")
+	}
+	c.seen[string(nonce)] = sent
+	return nil
+}
@@ -0,0 +1,120 @@
+package channel
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nmohnblatt/cd_client/ipfsapi"
+	"github.com/nmohnblatt/cd_client/ipfsapi/ipfstest"
+)
+
+var testKey = bytes.Repeat([]byte{0x42}, 32)
+
+const testTopic = "cd_client/test"
+
+func receiveOne(t *testing.T, frames <-chan Frame) *Frame {
+	select {
+	case f := <-frames:
+		return &f
+	case <-time.After(5 * time.Second):
+		t.Fatal("No frame received")
+		return nil
+	}
+}
+
+func expectNothing(t *testing.T, frames <-chan Frame) {
+	select {
+	case f := <-frames:
+		t.Errorf("Unexpected frame of type %d: %q", f.Type, f.Payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func testChannel(t *testing.T, alicePS, bobPS PubSub, waitSubscribed func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	alice, err := Open(alicePS, testTopic, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := Open(bobPS, testTopic, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliceFrames, err := alice.Receive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobFrames, err := bob.Receive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitSubscribed()
+
+	if err := alice.AnnouncePresence(); err != nil {
+		t.Fatal(err)
+	}
+	if f := receiveOne(t, bobFrames); f.Type != Presence {
+		t.Errorf("Expected a presence frame, got type %d", f.Type)
+	}
+
+	if err := bob.Send(Invite, []byte("join us")); err != nil {
+		t.Fatal(err)
+	}
+	f := receiveOne(t, aliceFrames)
+	if f.Type != Invite || !bytes.Equal(f.Payload, []byte("join us")) {
+		t.Errorf("Wrong invite frame: type %d, payload %q", f.Type, f.Payload)
+	}
+
+	// Nobody receives their own frames
+	expectNothing(t, aliceFrames)
+	expectNothing(t, bobFrames)
+}
+
+func TestChannelBroker(t *testing.T) {
+	b := NewBroker()
+	testChannel(t, b, b, func() {})
+}
+
+func TestChannelIPFS(t *testing.T) {
+	s := ipfstest.NewServer()
+	defer s.Close()
+	peer := s.NewPeer()
+	defer peer.Close()
+
+	alicePS := NewIPFSPubSub(ipfsapi.NewClient(s.URL))
+	bobPS := NewIPFSPubSub(ipfsapi.NewClient(peer.URL))
+	testChannel(t, alicePS, bobPS, func() {
+		for s.Subscribers(testTopic) < 2 {
+			time.Sleep(time.Millisecond)
+		}
+	})
+}
+
+func TestReplayAndWrongKey(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := NewBroker()
+
+	alice, _ := Open(b, testTopic, testKey)
+	bob, _ := Open(b, testTopic, testKey)
+	eve, _ := Open(b, testTopic, bytes.Repeat([]byte{0x66}, 32))
+
+	raw, _ := b.Subscribe(ctx, testTopic)
+	bobFrames, _ := bob.Receive(ctx)
+	eveFrames, _ := eve.Receive(ctx)
+
+	if err := alice.Send(Message, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	receiveOne(t, bobFrames)
+	expectNothing(t, eveFrames)
+
+	// An attacker republishes the captured frame
+	captured := <-raw
+	b.Publish(testTopic, captured)
+	expectNothing(t, bobFrames)
+}
@@ -0,0 +1,98 @@
+package channel
+
+import (
+	"context"
+	"sync"
+
+	"github.com/nmohnblatt/cd_client/ipfsapi"
+)
+
+// PubSub is a publish-subscribe transport. Messages are best effort: they may be lost,
+// duplicated, and are delivered to every subscriber including the publisher.
+type PubSub interface {
+	Publish(topic string, data []byte) error
+	// Subscribe delivers messages published on topic until ctx is cancelled
+	Subscribe(ctx context.Context, topic string) (<-chan []byte, error)
+}
+
+// IPFSPubSub is a PubSub backed by the pubsub API of an IPFS daemon
+type IPFSPubSub struct {
+	client *ipfsapi.Client
+}
+
+// NewIPFSPubSub returns a PubSub that goes through the daemon behind client
+func NewIPFSPubSub(client *ipfsapi.Client) *IPFSPubSub {
+	return &IPFSPubSub{client: client}
+}
+
+// Publish sends data on a topic
+func (p *IPFSPubSub) Publish(topic string, data []byte) error {
+	return p.client.PubsubPub(topic, data)
+}
+
+// Subscribe delivers the data of the messages published on a topic
+func (p *IPFSPubSub) Subscribe(ctx context.Context, topic string) (<-chan []byte, error) {
+	messages, err := p.client.PubsubSub(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+		for msg := range messages {
+			select {
+			case out <- msg.Data:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Broker is an in-process PubSub, for tests and local experiments
+type Broker struct {
+	mu   sync.Mutex
+	subs map[string]map[chan []byte]bool
+}
+
+// NewBroker returns a broker without subscribers
+func NewBroker() *Broker {
+	return &Broker{subs: map[string]map[chan []byte]bool{}}
+}
+
+// Publish delivers data to the current subscribers of topic. Slow subscribers lose messages.
+func (b *Broker) Publish(topic string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs[topic] {
+		select {
+		case ch <- append([]byte(nil), data...):
+		default:
+		}
+	}
+	return nil
+}
+
+// Subscribe registers a subscriber until ctx is cancelled
+func (b *Broker) Subscribe(ctx context.Context, topic string) (<-chan []byte, error) {
+	ch := make(chan []byte, 64)
+
+	b.mu.Lock()
+	if b.subs[topic] == nil {
+		b.subs[topic] = map[chan []byte]bool{}
+	}
+	b.subs[topic][ch] = true
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		delete(b.subs[topic], ch)
+		close(ch)
+		b.mu.Unlock()
+	}()
+
+	return ch, nil
+}
@@ -0,0 +1,189 @@
+// Package cid encodes content identifiers (CIDs) as used by IPFS and libp2p:
+// unsigned varints, multihashes, CIDv1 and their multibase string representations.
+package cid
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// Multicodec codes used by meeting points
+const (
+	Identity  = 0x00
+	SHA256    = 0x12
+	Raw       = 0x55
+	DagPB     = 0x70
+	Libp2pKey = 0x72
+)
+
+// Version 1 of the CID format
+const V1 = 0x01
+
+// PutUvarint appends the unsigned varint encoding of x to buf
+func PutUvarint(buf []byte, x uint64) []byte {
+	for x >= 0x80 {
+		buf = append(buf, byte(x)|0x80)
+		x >>= 7
+	}
+	return append(buf, byte(x))
+}
+
+// Uvarint decodes an unsigned varint from buf and returns it with the number of bytes read
+func Uvarint(buf []byte) (uint64, int, error) {
+	var x uint64
+	for i, b := range buf {
+		if i == 9 {
+			return 0, 0, errors.New("cid: varint overflow")
+		}
+		x |= uint64(b&0x7f) << (7 * uint(i))
+		if b < 0x80 {
+			return x, i + 1, nil
+		}
+	}
+	return 0, 0, errors.New("cid: truncated varint")
+}
+
+// Multihash encodes a digest computed with the hash function identified by code
+func Multihash(code uint64, digest []byte) []byte {
+	buf := PutUvarint(nil, code)
+	buf = PutUvarint(buf, uint64(len(digest)))
+	return append(buf, digest...)
+}
+
+// NewV1 returns the binary CIDv1 of content encoded with codec and addressed by multihash
+func NewV1(codec uint64, multihash []byte) []byte {
+	buf := PutUvarint(nil, V1)
+	buf = PutUvarint(buf, codec)
+	return append(buf, multihash...)
+}
+
+// Base36 returns the multibase base36 (lowercase, prefix 'k') encoding of data,
+// the usual representation of IPNS names
+func Base36(data []byte) string {
+	const alphabet = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+	zeros := 0
+	for zeros < len(data) && data[zeros] == 0 {
+		zeros++
+	}
+
+	x := new(big.Int).SetBytes(data)
+	base := big.NewInt(36)
+	mod := new(big.Int)
+	var digits []byte
+	for x.Sign() > 0 {
+		x.DivMod(x, base, mod)
+		digits = append(digits, alphabet[mod.Int64()])
+	}
+	for i := 0; i < zeros; i++ {
+		digits = append(digits, '0')
+	}
+
+	out := make([]byte, 0, len(digits)+1)
+	out = append(out, 'k')
+	for i := len(digits) - 1; i >= 0; i-- {
+		out = append(out, digits[i])
+	}
+	return string(out)
+}
+
+// Sum returns the binary CIDv1 of a block encoded with codec, using a SHA-256 multihash
+func Sum(codec uint64, block []byte) []byte {
+	digest := sha256.Sum256(block)
+	return NewV1(codec, Multihash(SHA256, digest[:]))
+}
+
+// String returns the default string representation of a binary CIDv1 (base32, "bafy..." for
+// dag-pb and "bafk..." for raw blocks)
+func String(c []byte) string {
+	return Base32(c)
+}
+
+// Parse decodes a CIDv1 string in base32 or base36 and returns its codec and multihash
+func Parse(s string) (uint64, []byte, error) {
+	var c []byte
+	var err error
+	switch {
+	case strings.HasPrefix(s, "b"):
+		c, err = lowerBase32.DecodeString(s[1:])
+	case strings.HasPrefix(s, "k"):
+		c, err = decodeBase36(s[1:])
+	default:
+		return 0, nil, errors.New("cid: unsupported multibase encoding")
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	version, n, err := Uvarint(c)
+	if err != nil {
+		return 0, nil, err
+	}
+	if version != V1 {
+		return 0, nil, errors.New("cid: unsupported CID version")
+	}
+	codec, m, err := Uvarint(c[n:])
+	if err != nil {
+		return 0, nil, err
+	}
+	return codec, c[n+m:], nil
+}
+
+// Verify checks that data is the content addressed by the CID string s. Raw CIDs address the
+// bytes themselves, dag-pb CIDs the file that ipfs add would build from them. Raw CIDs with an
+// identity multihash carry the bytes. s may be in any multibase Parse accepts.
+func Verify(s string, data []byte) error {
+	codec, mh, err := Parse(s)
+	if err != nil {
+		return err
+	}
+
+	var want []byte
+	switch {
+	case codec == Raw && len(mh) > 0 && mh[0] == Identity:
+		want = NewV1(Raw, Multihash(Identity, data))
+	case codec == Raw:
+		want = Sum(Raw, data)
+	case codec == DagPB:
+		want = File(data)
+	default:
+		return errors.New("cid: unsupported codec")
+	}
+	if !bytes.Equal(want, NewV1(codec, mh)) {
+		return errors.New("cid: content does not match " + s)
+	}
+	return nil
+}
+
+// Base32 returns the multibase base32 (lowercase, no padding, prefix 'b') encoding of data,
+// the default representation of CIDv1
+func Base32(data []byte) string {
+	return "b" + lowerBase32.EncodeToString(data)
+}
+
+func decodeBase36(s string) ([]byte, error) {
+	const alphabet = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+	zeros := 0
+	for zeros < len(s) && s[zeros] == '0' {
+		zeros++
+	}
+
+	x := new(big.Int)
+	base := big.NewInt(36)
+	for _, c := range []byte(s[zeros:]) {
+		d := strings.IndexByte(alphabet, c)
+		if d < 0 {
+			return nil, errors.New("cid: invalid base36 character")
+		}
+		x.Mul(x, base)
+		x.Add(x, big.NewInt(int64(d)))
+	}
+	return append(bytes.Repeat([]byte{0}, zeros), x.Bytes()...), nil
+}
+
+var lowerBase32 = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
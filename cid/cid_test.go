@@ -0,0 +1,133 @@
+package cid
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestUvarint(t *testing.T) {
+	for _, tc := range []struct {
+		x   uint64
+		enc []byte
+	}{
+		{0, []byte{0x00}},
+		{1, []byte{0x01}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{300, []byte{0xac, 0x02}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+	} {
+		if enc := PutUvarint(nil, tc.x); !bytes.Equal(enc, tc.enc) {
+			t.Errorf("PutUvarint(%d) = %x, want %x", tc.x, enc, tc.enc)
+		}
+		x, n, err := Uvarint(tc.enc)
+		if err != nil || x != tc.x || n != len(tc.enc) {
+			t.Errorf("Uvarint(%x) = %d, %d, %v", tc.enc, x, n, err)
+		}
+	}
+
+	if _, _, err := Uvarint([]byte{0x80}); err == nil {
+		t.Errorf("Accepted a truncated varint")
+	}
+}
+
+func TestBase36(t *testing.T) {
+	for _, tc := range []struct {
+		data []byte
+		enc  string
+	}{
+		{[]byte{0x01}, "k1"},
+		{[]byte{0x00, 0x01}, "k01"},
+		{[]byte{0x01, 0x00}, "k74"},
+		// Test vector from the multibase specification
+		{[]byte("Decentralize everything!!!"), "km552ng4dabi4neu1oo8l4i5mndwmpc3mkukwtxy9"},
+	} {
+		if enc := Base36(tc.data); enc != tc.enc {
+			t.Errorf("Base36(%x) = %s, want %s", tc.data, enc, tc.enc)
+		}
+	}
+}
+
+func TestBase32(t *testing.T) {
+	if enc := Base32([]byte("hello world")); enc != "bnbswy3dpeb3w64tmmq" {
+		t.Errorf("Base32 = %s", enc)
+	}
+}
+
+func TestFile(t *testing.T) {
+	// ipfs add --cid-version=1 of "hello world" and of an empty file
+	for _, tc := range []struct {
+		data string
+		cid  string
+	}{
+		{"hello world", "bafkreifzjut3te2nhyekklss27nh3k72ysco7y32koao5eei66wof36n5e"},
+		{"", "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku"},
+	} {
+		if c := String(File([]byte(tc.data))); c != tc.cid {
+			t.Errorf("File(%q) = %s, want %s", tc.data, c, tc.cid)
+		}
+	}
+
+	// Larger content becomes a dag-pb tree, of two levels past 174 chunks. CIDs from the
+	// balanced importer of IPFS with raw leaves, as used by ipfs add --cid-version=1.
+	tree := make([]byte, 175*ChunkSize+5)
+	for i := range tree {
+		tree[i] = byte(i * 7)
+	}
+	if c := String(File(tree)); c != "bafybeibujhd3utzdw4xesvwcqluxhnukr7szscuu77pvkgaspsfhozd7yq" {
+		t.Errorf("File of 175 chunks = %s", c)
+	}
+	large := bytes.Repeat([]byte{0xab}, 3*ChunkSize+1)
+	c := String(File(large))
+	if c != "bafybeigp2ijar63sxw4ydj4oeg2fbyvnacyifvnrqzdwduq7j7avvhvhca" {
+		t.Errorf("File of 4 chunks = %s", c)
+	}
+	if err := Verify(c, large); err != nil {
+		t.Errorf("Verify failed on the original content: %s", err)
+	}
+	if err := Verify(c, large[1:]); err == nil {
+		t.Errorf("Verify accepted different content")
+	}
+}
+
+func TestParse(t *testing.T) {
+	data := []byte("meeting point envelope")
+	c := Sum(Raw, data)
+
+	codec, mh, err := Parse(String(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codec != Raw || !bytes.Equal(NewV1(codec, mh), c) {
+		t.Errorf("CID was not recovered")
+	}
+
+	codec, _, err = Parse(Base36(c))
+	if err != nil || codec != Raw {
+		t.Errorf("Could not parse a base36 CID: %v", err)
+	}
+
+	if err := Verify(String(c), data); err != nil {
+		t.Errorf("Verify failed on the original content: %s", err)
+	}
+	if err := Verify(String(c), []byte("tampered")); err == nil {
+		t.Errorf("Verify accepted different content")
+	}
+	if err := Verify(Base36(c), data); err != nil {
+		t.Errorf("Verify failed on a base36 CID: %s", err)
+	}
+	if err := Verify(Base36(c), []byte("tampered")); err == nil {
+		t.Errorf("Verify accepted different content for a base36 CID")
+	}
+	// Identity CIDs carry their content
+	inline := NewV1(Raw, Multihash(Identity, data))
+	if err := Verify(String(inline), data); err != nil {
+		t.Errorf("Verify failed on inline content: %s", err)
+	}
+	if err := Verify(String(inline), []byte("tampered")); err == nil {
+		t.Errorf("Verify accepted different inline content")
+	}
+	if _, _, err := Parse("Qm"); err == nil {
+		t.Errorf("Parsed an unsupported encoding")
+	}
+}
@@ -0,0 +1,117 @@
+package cid
+
+// ChunkSize is the size of the chunks ipfs add splits files into by default
+const ChunkSize = 256 * 1024
+
+// Maximum number of links per node in the balanced layout of ipfs add
+const maxLinks = 174
+
+// UnixFS data type of a file
+const unixfsFile = 2
+
+// File returns the binary CID that "ipfs add --cid-version=1" assigns to data with the default
+// settings: 256KiB chunks, raw leaves, SHA-256 and the balanced DAG layout.
+// Content that fits in one chunk is a single raw block ("bafk..."), larger content is a
+// dag-pb tree ("bafy...").
+func File(data []byte) []byte {
+	var chunks [][]byte
+	for len(data) > ChunkSize {
+		chunks = append(chunks, data[:ChunkSize])
+		data = data[ChunkSize:]
+	}
+	chunks = append(chunks, data)
+
+	if len(chunks) == 1 {
+		return Sum(Raw, chunks[0])
+	}
+
+	b := &dagBuilder{chunks: chunks}
+	root := b.leaf()
+	for depth := 1; !b.done(); depth++ {
+		parent := &node{}
+		parent.add(root)
+		b.fill(parent, depth)
+		root = parent.finish()
+	}
+	return root.cid
+}
+
+// A finished block of the DAG, as seen from its parent
+type link struct {
+	cid      []byte
+	size     uint64 // cumulative size of the encoded blocks (Tsize)
+	fileSize uint64 // number of bytes of the file below the link
+}
+
+// An intermediate dag-pb node under construction
+type node struct {
+	links []link
+}
+
+type dagBuilder struct {
+	chunks [][]byte
+}
+
+func (b *dagBuilder) done() bool {
+	return len(b.chunks) == 0
+}
+
+func (b *dagBuilder) leaf() link {
+	chunk := b.chunks[0]
+	b.chunks = b.chunks[1:]
+	return link{cid: Sum(Raw, chunk), size: uint64(len(chunk)), fileSize: uint64(len(chunk))}
+}
+
+// Fill n with children of the given depth (leaves at depth 1) until it is full or data runs out
+func (b *dagBuilder) fill(n *node, depth int) {
+	for !b.done() && len(n.links) < maxLinks {
+		if depth == 1 {
+			n.add(b.leaf())
+			continue
+		}
+		child := &node{}
+		b.fill(child, depth-1)
+		n.add(child.finish())
+	}
+}
+
+func (n *node) add(l link) {
+	n.links = append(n.links, l)
+}
+
+// Encode the node as a dag-pb block: links first (field 2), then the UnixFS data (field 1)
+func (n *node) finish() link {
+	var fileSize, size uint64
+	var block []byte
+	for _, l := range n.links {
+		var pbLink []byte
+		pbLink = appendBytes(pbLink, 1, l.cid)
+		pbLink = appendBytes(pbLink, 2, nil)
+		pbLink = appendVarint(pbLink, 3, l.size)
+		block = appendBytes(block, 2, pbLink)
+
+		fileSize += l.fileSize
+		size += l.size
+	}
+
+	var unixfs []byte
+	unixfs = appendVarint(unixfs, 1, unixfsFile)
+	unixfs = appendVarint(unixfs, 3, fileSize)
+	for _, l := range n.links {
+		unixfs = appendVarint(unixfs, 4, l.fileSize)
+	}
+	block = appendBytes(block, 1, unixfs)
+
+	return link{cid: Sum(DagPB, block), size: size + uint64(len(block)), fileSize: fileSize}
+}
+
+func appendVarint(buf []byte, field int, x uint64) []byte {
+	buf = PutUvarint(buf, uint64(field)<<3)
+	return PutUvarint(buf, x)
+}
+
+func appendBytes(buf []byte, field int, data []byte) []byte {
+	buf = PutUvarint(buf, uint64(field)<<3|2)
+	buf = PutUvarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
@@ -0,0 +1,39 @@
+// Command cd_rendezvous serves an HTTP blob store where contacts exchange records at their
+// meeting points. It is an alternative to IPFS for running the client (see README).
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/nmohnblatt/cd_client/rendezvous"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "address to listen on")
+	maxSize := flag.Int("max-size", rendezvous.DefaultServerConfig.MaxRecordSize, "maximum size of a record in bytes")
+	maxRecords := flag.Int("max-records", rendezvous.DefaultServerConfig.MaxRecords, "maximum number of records per meeting point")
+	ttl := flag.Duration("ttl", rendezvous.DefaultServerConfig.TTL, "how long records are kept after they were written")
+	maxSigs := flag.Int("max-signatures", rendezvous.DefaultServerConfig.MaxSignatures, "maximum number of recent request signatures kept per meeting point to reject replays")
+	maxPoints := flag.Int("max-points", rendezvous.DefaultServerConfig.MaxPoints, "maximum number of meeting points")
+	flag.Parse()
+
+	server := rendezvous.NewServer(rendezvous.ServerConfig{
+		MaxRecordSize: *maxSize,
+		MaxRecords:    *maxRecords,
+		TTL:           *ttl,
+		MaxSignatures: *maxSigs,
+		MaxPoints:     *maxPoints,
+	})
+
+	go func() {
+		for range time.Tick(time.Minute) {
+			server.Purge()
+		}
+	}()
+
+	log.Printf("cd_rendezvous listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, server))
+}
@@ -0,0 +1,28 @@
+package confirm
+
+import (
+	"testing"
+)
+
+func TestTagVerify(t *testing.T) {
+	key := []byte("a confirmation key")
+	mp := []byte("meeting point")
+	alice := []byte("07111111111")
+	bob := []byte("07222222222")
+
+	tag := Tag(key, mp, alice, bob)
+	if err := Verify(key, mp, alice, bob, tag); err != nil {
+		t.Errorf("Valid tag was rejected")
+	}
+
+	// A tag cannot be reflected back to its sender
+	if err := Verify(key, mp, bob, alice, tag); err == nil {
+		t.Errorf("Tag was accepted in the wrong direction")
+	}
+	if err := Verify([]byte("another key"), mp, alice, bob, tag); err == nil {
+		t.Errorf("Tag was accepted under the wrong key")
+	}
+	if err := Verify(key, []byte("another meeting point"), alice, bob, tag); err == nil {
+		t.Errorf("Tag was accepted for the wrong meeting point")
+	}
+}
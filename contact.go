@@ -0,0 +1,133 @@
+package main
+
+import (
+	"github.com/nmohnblatt/cd_client/confirm"
+	"github.com/nmohnblatt/cd_client/identifier"
+	"github.com/nmohnblatt/cd_client/keyschedule"
+	"github.com/nmohnblatt/cd_client/mailbox"
+	"github.com/nmohnblatt/cd_client/ratchet"
+	"github.com/nmohnblatt/cd_client/x3dh"
+	"go.dedis.ch/kyber/v3"
+)
+
+type contactStatus int
+
+const (
+	// Shared keys were derived but the contact has not proved knowledge of the same secret
+	contactPending contactStatus = iota
+	// Both confirmation MACs checked out
+	contactConfirmed
+)
+
+func (s contactStatus) String() string {
+	switch s {
+	case contactPending:
+		return "pending"
+	case contactConfirmed:
+		return "confirmed"
+	default:
+		return "unknown"
+	}
+}
+
+type contact struct {
+	id identifier.Identifier
+	// Our registration the shared keys were derived with. We appear to the contact under its
+	// identifier.
+	local              *registration
+	sharedAB, sharedBA kyber.Point
+	schedule           *keyschedule.Schedule
+	meetingPoint       []byte
+	status             contactStatus
+	// Key epoch in which the shared keys were derived
+	epoch uint32
+	// Sequence numbers of the mailboxes at the meeting point, for messages and for streams
+	mailbox, streamMailbox mailbox.State
+	// One-time prekey published for the contact, and the double ratchet of the session
+	// established with them
+	oneTimePreKey *x3dh.PreKey
+	session       *ratchet.State
+
+	// Key confirmation progress
+	confirmationSent, confirmationReceived bool
+}
+
+// Derive shared keys with a contact from the user's primary identifier. The contact stays
+// pending until key confirmation completes.
+func newContact(u *user, id identifier.Identifier) *contact {
+	return newContactAs(u, u.registration, id)
+}
+
+// Derive shared keys with a contact from one of the user's registrations
+func newContactAs(u *user, local *registration, id identifier.Identifier) *contact {
+	pk1, pk2 := u.cache.publicKeys(id)
+	return newContactFromKeys(u, local, id, pk1, pk2)
+}
+
+// Derive shared keys with a contact whose public keys were already derived from their identifier
+func newContactFromKeys(u *user, local *registration, id identifier.Identifier, pk1, pk2 kyber.Point) *contact {
+	var c contact
+
+	c.id, c.local = id, local
+	c.sharedAB, c.sharedBA = u.cache.sharedKeys(local, u.epoch, id, pk1, pk2)
+	c.schedule = newKeySchedule(c.sharedAB, c.sharedBA)
+	c.meetingPoint = c.schedule.MeetingPoint()
+	c.epoch = u.epoch
+	c.status = contactPending
+	u.restoreSession(&c)
+
+	return &c
+}
+
+// Compute the confirmation MAC to post at the meeting point for the contact
+func (c *contact) confirmationTag() []byte {
+	return confirm.Tag(c.schedule.ConfirmationKey(), c.meetingPoint, c.local.id.Bytes(), c.id.Bytes())
+}
+
+// Record that our confirmation MAC was posted where the contact can read it
+func (c *contact) confirmationPosted() {
+	c.confirmationSent = true
+	c.updateStatus()
+}
+
+// Check the confirmation MAC posted by the contact at the meeting point
+func (c *contact) checkConfirmation(tag []byte) error {
+	if err := confirm.Verify(c.schedule.ConfirmationKey(), c.meetingPoint, c.id.Bytes(), c.local.id.Bytes(), tag); err != nil {
+		return err
+	}
+	c.confirmationReceived = true
+	c.updateStatus()
+
+	return nil
+}
+
+func (c *contact) updateStatus() {
+	if c.confirmationSent && c.confirmationReceived {
+		c.status = contactConfirmed
+	}
+}
+
+// Derive shared keys with a person known under several identifiers, from every identifier of
+// the user. The person has registered with some of them at most, so only some of the candidates
+// will meet. Identifiers of the user themselves are skipped.
+func contactCandidates(u *user, ids []identifier.Identifier) []*contact {
+	var candidates []*contact
+	for _, id := range ids {
+		candidates = append(candidates, candidatesOf(u, id)...)
+	}
+	return candidates
+}
+
+// Derive shared keys with one identifier of a person from every identifier of the user. The
+// identifier is hashed once for all of them.
+func candidatesOf(u *user, id identifier.Identifier) []*contact {
+	if u.registrationOf(id) != nil {
+		return nil
+	}
+	pk1, pk2 := u.cache.publicKeys(id)
+	candidates := make([]*contact, len(u.registrations))
+	for i, r := range u.registrations {
+		candidates[i] = newContactFromKeys(u, r, id, pk1, pk2)
+	}
+	return candidates
+}
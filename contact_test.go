@@ -0,0 +1,107 @@
+package main
+
+import (
+	"testing"
+
+	"go.dedis.ch/kyber/v3/util/random"
+)
+
+func TestKeyConfirmation(t *testing.T) {
+	s1 := newDummyServer(1)
+	alice := testUser(t, "Alice", "07111111111")
+	bob := testUser(t, "Bob", "07222222222")
+	alice.obtainPrivateKeys(s1)
+	bob.obtainPrivateKeys(s1)
+
+	aliceView := newContact(alice, bob.id)
+	bobView := newContact(bob, alice.id)
+
+	if aliceView.status != contactPending || bobView.status != contactPending {
+		t.Errorf("New contacts should be pending")
+	}
+
+	aliceTag := aliceView.confirmationTag()
+	aliceView.confirmationPosted()
+	if err := bobView.checkConfirmation(aliceTag); err != nil {
+		t.Fatal(err)
+	}
+	if bobView.status != contactPending {
+		t.Errorf("Bob confirmed before posting his own tag")
+	}
+
+	bobTag := bobView.confirmationTag()
+	bobView.confirmationPosted()
+	if err := aliceView.checkConfirmation(bobTag); err != nil {
+		t.Fatal(err)
+	}
+	if aliceView.status != contactConfirmed || bobView.status != contactConfirmed {
+		t.Errorf("Contacts should be confirmed: Alice %s, Bob %s", aliceView.status, bobView.status)
+	}
+}
+
+func TestKeyConfirmationWrongNumber(t *testing.T) {
+	s1 := newDummyServer(1)
+	alice := testUser(t, "Alice", "07111111111")
+	bob := testUser(t, "Bob", "07222222222")
+	alice.obtainPrivateKeys(s1)
+	bob.obtainPrivateKeys(s1)
+
+	// Alice mistyped Bob's number
+	aliceView := testContact(t, alice, "07222222223")
+	bobView := newContact(bob, alice.id)
+
+	if err := bobView.checkConfirmation(aliceView.confirmationTag()); err == nil {
+		t.Errorf("Bob accepted a tag derived from the wrong number")
+	}
+	if err := aliceView.checkConfirmation(bobView.confirmationTag()); err == nil {
+		t.Errorf("Alice accepted a tag derived from the wrong number")
+	}
+	if aliceView.status != contactPending || bobView.status != contactPending {
+		t.Errorf("Contacts should remain pending")
+	}
+}
+
+func TestKeyConfirmationMismatchedServers(t *testing.T) {
+	alice := testUser(t, "Alice", "07111111111")
+	bob := testUser(t, "Bob", "07222222222")
+	alice.obtainPrivateKeys(newDummyServer(1))
+	bob.obtainPrivateKeys(newDummyServer(2))
+
+	aliceView := newContact(alice, bob.id)
+	bobView := newContact(bob, alice.id)
+
+	if err := bobView.checkConfirmation(aliceView.confirmationTag()); err == nil {
+		t.Errorf("Bob accepted a tag from a different server configuration")
+	}
+}
+
+func TestKeyEpoch(t *testing.T) {
+	n, thr := 3, 2
+	serverList, pubPoly1, pubPoly2 := setupThresholdServers(suite, nil, n, thr)
+	alice := testUser(t, "Alice", "07111111111")
+	bob := testUser(t, "Bob", "07222222222")
+	for _, u := range []*user{alice, bob} {
+		if err := u.obtainPrivateKeysThreshold(suite, serverList[:thr], pubPoly1, pubPoly2, thr, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if alice.epoch != bob.epoch {
+		t.Errorf("Users of the same servers in different epochs: %d and %d", alice.epoch, bob.epoch)
+	}
+	if c := newContact(alice, bob.id); c.epoch != alice.epoch {
+		t.Errorf("Contact derived in epoch %d, expected %d", c.epoch, alice.epoch)
+	}
+
+	// Keys issued after the servers rotated their master keys are in another epoch
+	previous := alice.epoch
+	serverList, pubPoly1, pubPoly2 = setupThresholdServers(suite, suite.GT().Scalar().Pick(random.New()), n, thr)
+	if err := alice.obtainPrivateKeysBlindThreshold(suite, serverList[:thr], pubPoly1, pubPoly2, thr, n); err != nil {
+		t.Fatal(err)
+	}
+	if alice.epoch == previous {
+		t.Errorf("Epoch unchanged after a key rotation")
+	}
+	if c := newContact(alice, bob.id); c.epoch != alice.epoch {
+		t.Errorf("Contact derived in epoch %d, expected %d", c.epoch, alice.epoch)
+	}
+}
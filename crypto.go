@@ -3,23 +3,31 @@ package main
 import (
 	"errors"
 
+	"github.com/nmohnblatt/cd_client/identifier"
+
 	"go.dedis.ch/kyber/v3"
 )
 
-// Derive "Public Keys" pk1 =  H1(id), pk2 = H2(id) by hashing phone number to points
-func derivePublicKeys(phoneNumber string) (pk1, pk2 kyber.Point) {
+// Derive "Public Keys" pk1 =  H1(id), pk2 = H2(id) by hashing the identifier to points.
+// Identifiers are hashed with a tag naming their kind, see identifier.Identifier.Bytes.
+func derivePublicKeys(id identifier.Identifier) (pk1, pk2 kyber.Point) {
 
-	pk1 = hashtoG1([]byte(phoneNumber))
-	pk2 = insecureHashtoG2([]byte(phoneNumber))
+	pk1 = hashtoG1(id.Bytes())
+	pk2 = insecureHashtoG2(id.Bytes())
 
 	return pk1, pk2
 }
 
-// Derive shared keys between users A and B:
+// Derive shared keys between users A and B, from the registration of A's identifier:
 // shared12 = e(H1(idA)^s, H2(idB)) = e(H1(idA), H2(idB))^s
 // shared21 = e(H1(idB), H2(idA)^s) = e(H1(idB), H2(idA))^s
-func deriveSharedKeys(alice *user, contactNumber string) (kyber.Point, kyber.Point) {
-	bobPk1, bobPk2 := derivePublicKeys(contactNumber)
+func deriveSharedKeys(alice *registration, bob identifier.Identifier) (kyber.Point, kyber.Point) {
+	bobPk1, bobPk2 := derivePublicKeys(bob)
+	return pairPublicKeys(alice, bobPk1, bobPk2)
+}
+
+// Derive shared keys with B from the public keys of B's identifier, hashed beforehand
+func pairPublicKeys(alice *registration, bobPk1, bobPk2 kyber.Point) (kyber.Point, kyber.Point) {
 	shared12 := suite.Pair(alice.sk1, bobPk2)
 	shared21 := suite.Pair(bobPk1, alice.sk2)
 
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/nmohnblatt/cd_client/envelope"
+	"github.com/nmohnblatt/cd_client/mutual"
+	"github.com/nmohnblatt/cd_client/rendezvous"
+)
+
+// Responses are padded to a multiple of this many tags
+const mutualResponseBlock = 64
+
+// Kinds of the records of a discovery, each written at the meeting point of the coordinator
+// and one of their contacts. The request and the view are written by the coordinator, the
+// response by the contact, and all of them start with the session they belong to.
+const (
+	recordDiscoveryRequest  = "discovery-request"
+	recordDiscoveryResponse = "discovery-response"
+	recordDiscoveryView     = "discovery-view"
+)
+
+// Answer a discovery request received at a meeting point with one tag per confirmed contact
+func answerMutualDiscovery(contacts []*contact, session []byte) ([][]byte, error) {
+	if len(session) != mutual.SessionSize {
+		return nil, errors.New("discovery: malformed session identifier")
+	}
+
+	var tags [][]byte
+	for _, c := range contacts {
+		if c.status != contactConfirmed {
+			continue
+		}
+		tags = append(tags, mutual.Tag(c.schedule.MutualDiscoveryKey(), session))
+	}
+
+	return mutual.Pad(tags, mutualResponseBlock)
+}
+
+// Start a discovery of the mutual-contact graph by posting a fresh session at the meeting point
+// of each confirmed contact. Contacts answer it the next time they sync.
+func requestMutualDiscovery(store rendezvous.Rendezvous, u *user, contacts []*contact) error {
+	session, err := mutual.NewSession()
+	if err != nil {
+		return err
+	}
+	for _, c := range confirmedContacts(contacts) {
+		if err := putSigned(store, u, c, recordDiscoveryRequest, envelope.MutualDiscovery, session); err != nil {
+			return err
+		}
+		if err := syncMeetingPoint(store, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Answer the discovery requests posted by our confirmed contacts with the tags of our own
+// confirmed contacts. Returns the number of requests answered.
+func answerMutualDiscoveryRequests(store rendezvous.Rendezvous, u *user, contacts []*contact) (int, error) {
+	answered := 0
+	for _, c := range confirmedContacts(contacts) {
+		if err := syncMeetingPoint(store, c); err != nil {
+			return answered, err
+		}
+		session, err := getSigned(store, u, c, recordDiscoveryRequest, envelope.MutualDiscovery)
+		if err == rendezvous.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return answered, err
+		}
+		tags, err := answerMutualDiscovery(contacts, session)
+		if err != nil {
+			return answered, err
+		}
+		response := append([]byte(nil), session...)
+		for _, tag := range tags {
+			response = append(response, tag...)
+		}
+		if err := putSigned(store, u, c, recordDiscoveryResponse, envelope.MutualDiscovery, response); err != nil {
+			return answered, err
+		}
+		if err := syncMeetingPoint(store, c); err != nil {
+			return answered, err
+		}
+		answered++
+	}
+	return answered, nil
+}
+
+// Collect the answers to our discovery requests and compute the mutual-contact graph. Every
+// contact who answered is then sent the edges they are part of, and nothing else. Returns nil
+// if no contact answered yet. Suggested rosters are available with Rosters.
+func collectMutualDiscovery(store rendezvous.Rendezvous, u *user, contacts []*contact) (*mutual.Graph, error) {
+	var responses []mutual.Response
+	var members []*contact
+	for _, c := range confirmedContacts(contacts) {
+		if err := syncMeetingPoint(store, c); err != nil {
+			return nil, err
+		}
+		// The response must answer the request we posted at this meeting point
+		request, err := getOwnSigned(store, u, c, recordDiscoveryRequest, envelope.MutualDiscovery)
+		if err == rendezvous.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		response, err := getSigned(store, u, c, recordDiscoveryResponse, envelope.MutualDiscovery)
+		if err == rendezvous.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.HasPrefix(response, request) || (len(response)-len(request))%mutual.TagSize != 0 {
+			continue
+		}
+		var tags [][]byte
+		for rest := response[len(request):]; len(rest) > 0; rest = rest[mutual.TagSize:] {
+			tags = append(tags, rest[:mutual.TagSize])
+		}
+		responses = append(responses, mutual.Response{Member: c.id.String(), Tags: tags})
+		members = append(members, c)
+	}
+	if len(responses) == 0 {
+		return nil, nil
+	}
+
+	g := mutual.Build(u.id.String(), responses)
+	for _, c := range members {
+		request, err := getOwnSigned(store, u, c, recordDiscoveryRequest, envelope.MutualDiscovery)
+		if err != nil {
+			return nil, err
+		}
+		view := append(request, encodeEdges(g.View(c.id.String()))...)
+		if err := putSigned(store, u, c, recordDiscoveryView, envelope.MutualDiscovery, view); err != nil {
+			return nil, err
+		}
+		if err := syncMeetingPoint(store, c); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// Read the edges of the mutual-contact graph that a contact who coordinated a discovery found
+// we are part of. Returns nil if they did not send any.
+func readMutualView(store rendezvous.Rendezvous, u *user, c *contact) ([]mutual.Edge, error) {
+	if err := syncMeetingPoint(store, c); err != nil {
+		return nil, err
+	}
+	view, err := getSigned(store, u, c, recordDiscoveryView, envelope.MutualDiscovery)
+	if err == rendezvous.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(view) < mutual.SessionSize {
+		return nil, errors.New("discovery: malformed view")
+	}
+	return decodeEdges(view[mutual.SessionSize:])
+}
+
+func confirmedContacts(contacts []*contact) []*contact {
+	var confirmed []*contact
+	for _, c := range contacts {
+		if c.status == contactConfirmed {
+			confirmed = append(confirmed, c)
+		}
+	}
+	return confirmed
+}
+
+// Edges are encoded as their members, each prefixed by its length on 2 bytes
+func encodeEdges(edges []mutual.Edge) []byte {
+	var members []string
+	for _, e := range edges {
+		members = append(members, e.A, e.B)
+	}
+	return encodeRoster(members)
+}
+
+func decodeEdges(data []byte) ([]mutual.Edge, error) {
+	var members []string
+	for len(data) > 0 {
+		if len(data) < 2 || len(data)-2 < int(binary.BigEndian.Uint16(data)) {
+			return nil, errors.New("discovery: malformed view")
+		}
+		n := int(binary.BigEndian.Uint16(data))
+		members = append(members, string(data[2:2+n]))
+		data = data[2+n:]
+	}
+	if len(members)%2 != 0 {
+		return nil, errors.New("discovery: malformed view")
+	}
+	var edges []mutual.Edge
+	for i := 0; i < len(members); i += 2 {
+		edges = append(edges, mutual.Edge{A: members[i], B: members[i+1]})
+	}
+	return edges, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nmohnblatt/cd_client/mutual"
+	"github.com/nmohnblatt/cd_client/rendezvous"
+	"go.dedis.ch/kyber/v3/util/random"
+)
+
+// Derive and confirm shared keys between every pair of users
+func confirmAll(t *testing.T, users []*user, pairs [][2]int) map[*user][]*contact {
+	contacts := map[*user][]*contact{}
+	for _, p := range pairs {
+		a, b := users[p[0]], users[p[1]]
+		aView := newContact(a, b.id)
+		bView := newContact(b, a.id)
+		aView.confirmationPosted()
+		bView.confirmationPosted()
+		if err := bView.checkConfirmation(aView.confirmationTag()); err != nil {
+			t.Fatal(err)
+		}
+		if err := aView.checkConfirmation(bView.confirmationTag()); err != nil {
+			t.Fatal(err)
+		}
+		contacts[a] = append(contacts[a], aView)
+		contacts[b] = append(contacts[b], bView)
+	}
+	return contacts
+}
+
+func TestMutualDiscovery(t *testing.T) {
+	n := 10
+	thr := n/2 + 1
+	secret := suite.GT().Scalar().Pick(random.New())
+	serverList, pubPoly1, pubPoly2 := setupThresholdServers(suite, secret, n, thr)
+
+	alice := testUser(t, "Alice", "07111111111")
+	bob := testUser(t, "Bob", "07222222222")
+	charlie := testUser(t, "Charlie", "07333333333")
+	dave := testUser(t, "Dave", "07444444444")
+	users := []*user{alice, bob, charlie, dave}
+	for _, u := range users {
+		if err := u.obtainPrivateKeysBlindThreshold(suite, serverList[:thr], pubPoly1, pubPoly2, thr, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Alice knows everyone, Bob and Charlie know each other, Dave only knows Alice
+	contacts := confirmAll(t, users, [][2]int{{0, 1}, {0, 2}, {0, 3}, {1, 2}})
+	store := rendezvous.NewMemory()
+
+	if g, err := collectMutualDiscovery(store, alice, contacts[alice]); err != nil || g != nil {
+		t.Fatalf("Collected a discovery that was not requested: %v", err)
+	}
+	if err := requestMutualDiscovery(store, alice, contacts[alice]); err != nil {
+		t.Fatal(err)
+	}
+	// Dave does not sync before Alice collects the answers
+	for _, u := range []*user{bob, charlie} {
+		if answered, err := answerMutualDiscoveryRequests(store, u, contacts[u]); err != nil || answered != 1 {
+			t.Fatalf("%s answered %d requests: %v", u.name, answered, err)
+		}
+	}
+	if answered, err := answerMutualDiscoveryRequests(store, bob, contacts[bob][1:]); err != nil || answered != 0 {
+		t.Errorf("Charlie's meeting point with Bob holds a request: %d, %v", answered, err)
+	}
+
+	g, err := collectMutualDiscovery(store, alice, contacts[alice])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{alice.id.String(), bob.id.String(), charlie.id.String()}}
+	if rosters := g.Rosters(3); !reflect.DeepEqual(rosters, want) {
+		t.Errorf("Wrong rosters: got %v, want %v", rosters, want)
+	}
+
+	// Each member who answered only receives the edges they are part of
+	bobView, err := readMutualView(store, bob, contacts[bob][0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantView := []mutual.Edge{{A: alice.id.String(), B: bob.id.String()}, {A: bob.id.String(), B: charlie.id.String()}}
+	if !reflect.DeepEqual(bobView, wantView) {
+		t.Errorf("Wrong view for Bob: got %v, want %v", bobView, wantView)
+	}
+	if view, err := readMutualView(store, dave, contacts[dave][0]); err != nil || view != nil {
+		t.Errorf("Dave received a view without answering: %v, %v", view, err)
+	}
+
+	// Once Dave answers, he is told of his edge with Alice only
+	if _, err := answerMutualDiscoveryRequests(store, dave, contacts[dave]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := collectMutualDiscovery(store, alice, contacts[alice]); err != nil {
+		t.Fatal(err)
+	}
+	daveView, err := readMutualView(store, dave, contacts[dave][0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []mutual.Edge{{A: alice.id.String(), B: dave.id.String()}}; !reflect.DeepEqual(daveView, want) {
+		t.Errorf("Wrong view for Dave: got %v, want %v", daveView, want)
+	}
+}
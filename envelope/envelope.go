@@ -0,0 +1,189 @@
+// Package envelope defines the format of the content that contacts post at their meeting point.
+//
+// An envelope is a clear header followed by an AEAD ciphertext keyed from the contacts' key
+// schedule:
+//
+//	version (1) | suite (2) | epoch (4) | nonce (24) | ciphertext
+//
+// The header is authenticated as additional data. The ciphertext holds a typed payload
+// padded with zeros to a multiple of BlockSize, so that envelopes only reveal the approximate
+// size of their content:
+//
+//	type (1) | payload length (4) | payload | zero padding
+//
+// All integers are big-endian.
+package envelope
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Version is the version of the envelope format produced by this package
+const Version = 1
+
+// Suite identifies the cryptographic suite that produced the key of an envelope
+type Suite uint16
+
+// SuiteBN256XChaCha20 derives keys from BN256 pairings with HKDF-SHA256 and seals envelopes
+// with XChaCha20-Poly1305
+const SuiteBN256XChaCha20 Suite = 1
+
+// Type tells how the payload of an envelope should be interpreted
+type Type byte
+
+const (
+	// Invite carries an invitation, e.g. to a group meeting point
+	Invite Type = iota + 1
+	// Profile carries the sender's profile
+	Profile
+	// Message carries a message for the contact
+	Message
+	// KeyConfirmation carries a proof that the sender derived the shared secret
+	KeyConfirmation
+	// PreKeyBundle carries the sender's X3DH identity and prekeys
+	PreKeyBundle
+	// Handshake carries the initial message of a session handshake
+	Handshake
+	// GroupShare carries the sender's signed share of a three-party meeting point
+	GroupShare
+	// MutualDiscovery carries a request, response or view of a mutual-contact discovery
+	MutualDiscovery
+)
+
+func (t Type) String() string {
+	switch t {
+	case Invite:
+		return "invite"
+	case Profile:
+		return "profile"
+	case Message:
+		return "message"
+	case KeyConfirmation:
+		return "key-confirmation"
+	case PreKeyBundle:
+		return "prekey-bundle"
+	case Handshake:
+		return "handshake"
+	case GroupShare:
+		return "group-share"
+	case MutualDiscovery:
+		return "mutual-discovery"
+	default:
+		return "unknown"
+	}
+}
+
+// BlockSize is the granularity to which plaintexts are padded
+const BlockSize = 256
+
+// HeaderSize is the size of the clear header, nonce included
+const HeaderSize = 1 + 2 + 4 + chacha20poly1305.NonceSizeX
+
+const payloadHeaderSize = 1 + 4
+
+// Header is the clear part of an envelope
+type Header struct {
+	Version uint8
+	Suite   Suite
+	// Epoch of the keys the envelope was sealed with: the receiver needs it to pick the key
+	Epoch uint32
+}
+
+// Envelope is an opened envelope
+type Envelope struct {
+	Header
+	Type    Type
+	Payload []byte
+}
+
+// Seal encrypts a payload of type t under a 32-byte key from the given key epoch
+func Seal(key []byte, epoch uint32, t Type, payload []byte) ([]byte, error) {
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return seal(key, Header{Version, SuiteBN256XChaCha20, epoch}, t, payload, nonce)
+}
+
+func seal(key []byte, h Header, t Type, payload []byte, nonce []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(payload)) > 1<<32-1 {
+		return nil, errors.New("envelope: payload too large")
+	}
+
+	size := payloadHeaderSize + len(payload)
+	size += (BlockSize - size%BlockSize) % BlockSize
+	plaintext := make([]byte, size)
+	plaintext[0] = byte(t)
+	binary.BigEndian.PutUint32(plaintext[1:], uint32(len(payload)))
+	copy(plaintext[payloadHeaderSize:], payload)
+
+	out := make([]byte, HeaderSize, HeaderSize+size+aead.Overhead())
+	out[0] = h.Version
+	binary.BigEndian.PutUint16(out[1:], uint16(h.Suite))
+	binary.BigEndian.PutUint32(out[3:], h.Epoch)
+	copy(out[7:], nonce)
+
+	return aead.Seal(out, nonce, plaintext, out[:HeaderSize]), nil
+}
+
+// ParseHeader returns the clear header of an envelope, so that the receiver can find the key
+// to open it with
+func ParseHeader(data []byte) (Header, error) {
+	if len(data) < HeaderSize {
+		return Header{}, errors.New("envelope: too short")
+	}
+	h := Header{
+		Version: data[0],
+		Suite:   Suite(binary.BigEndian.Uint16(data[1:])),
+		Epoch:   binary.BigEndian.Uint32(data[3:]),
+	}
+	if h.Version != Version {
+		return Header{}, errors.New("envelope: unsupported version")
+	}
+	if h.Suite != SuiteBN256XChaCha20 {
+		return Header{}, errors.New("envelope: unsupported suite")
+	}
+	return h, nil
+}
+
+// Open decrypts an envelope with a 32-byte key
+func Open(key []byte, data []byte) (*Envelope, error) {
+	h, err := ParseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := aead.Open(nil, data[7:HeaderSize], data[HeaderSize:], data[:HeaderSize])
+	if err != nil {
+		return nil, errors.New("envelope: decryption failed")
+	}
+	if len(plaintext) < payloadHeaderSize || len(plaintext)%BlockSize != 0 {
+		return nil, errors.New("envelope: malformed plaintext")
+	}
+	n := binary.BigEndian.Uint32(plaintext[1:])
+	if uint64(n) > uint64(len(plaintext)-payloadHeaderSize) {
+		return nil, errors.New("envelope: malformed plaintext")
+	}
+	for _, b := range plaintext[payloadHeaderSize+int(n):] {
+		if b != 0 {
+			return nil, errors.New("envelope: malformed padding")
+		}
+	}
+
+	payload := make([]byte, n)
+	copy(payload, plaintext[payloadHeaderSize:])
+
+	return &Envelope{Header: h, Type: Type(plaintext[0]), Payload: payload}, nil
+}
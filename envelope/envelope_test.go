@@ -0,0 +1,100 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func testKey() []byte {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	return key
+}
+
+// Envelopes sealed under the key 00 01 .. 1f with the nonce 24 24 .. 24
+var golden = []struct {
+	epoch    uint32
+	t        Type
+	payload  string
+	envelope string
+}{
+	{7, Message, "hello", "01000100000007242424242424242424242424242424242424242424242424a8c5587e94c50808182d92f7037486aaebf547fd8e7aa2c892ed07f231ba975e46d940cd6c26a42696042ab4ecd44e08fe40cca53d0bc4fe0fe5cba5e8868833fc84f90020c91e394a75393f01bc3cf901da5d5e87388c4dbfc64f57c07e54389dfc641e1c343ebcf95360ec7f91f75d3a562e71dcb35f99c3a22bc1d4fc2ebc688c45464388f8c3b838c62ee7d414840103d815347a9cd4b7ad66a08be0535be3123b8089010a3664c42d6229b679bf422e403f80ef24e6cc104876754bac4213b739824631957c485e84aacaa261e78bbff090595a0bda36cf10f64372b4df7b93c7e5e53224e1e376149c4e0f389d8ad064e9b5e5a5d349806b8aca1904d5db63a86bad59abafddbc2d500f25f079"},
+	{0, KeyConfirmation, "", "01000100000000242424242424242424242424242424242424242424242424afc5587e91ad6d64744292f7037486aaebf547fd8e7aa2c892ed07f231ba975e46d940cd6c26a42696042ab4ecd44e08fe40cca53d0bc4fe0fe5cba5e8868833fc84f90020c91e394a75393f01bc3cf901da5d5e87388c4dbfc64f57c07e54389dfc641e1c343ebcf95360ec7f91f75d3a562e71dcb35f99c3a22bc1d4fc2ebc688c45464388f8c3b838c62ee7d414840103d815347a9cd4b7ad66a08be0535be3123b8089010a3664c42d6229b679bf422e403f80ef24e6cc104876754bac4213b739824631957c485e84aacaa261e78bbff090595a0bda36cf10f64372b4df7b93c7e5e53224e1e376149c4e0f389d8ad064e9b5e5a5d349806b8aca1904d54b25dffe0d6543055aa69edd969a9e33"},
+}
+
+func TestGolden(t *testing.T) {
+	nonce := bytes.Repeat([]byte{0x24}, 24)
+
+	for _, v := range golden {
+		want, _ := hex.DecodeString(v.envelope)
+		got, err := seal(testKey(), Header{Version, SuiteBN256XChaCha20, v.epoch}, v.t, []byte(v.payload), nonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("Wrong encoding of the %s envelope:\n%x", v.t, got)
+		}
+
+		e, err := Open(testKey(), want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Version != Version || e.Suite != SuiteBN256XChaCha20 || e.Epoch != v.epoch || e.Type != v.t || string(e.Payload) != v.payload {
+			t.Errorf("Wrong decoding of the %s envelope: %+v", v.t, e)
+		}
+	}
+}
+
+func TestPadding(t *testing.T) {
+	for _, n := range []int{0, BlockSize - payloadHeaderSize, BlockSize - payloadHeaderSize + 1, 1000} {
+		data, err := Seal(testKey(), 1, Profile, make([]byte, n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (len(data)-HeaderSize-16)%BlockSize != 0 {
+			t.Errorf("Envelope of a %d-byte payload is not padded: %d bytes", n, len(data))
+		}
+		e, err := Open(testKey(), data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(e.Payload) != n {
+			t.Errorf("Wrong payload length: got %d, want %d", len(e.Payload), n)
+		}
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	data, err := Seal(testKey(), 3, Invite, []byte("invitation"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := ParseHeader(data)
+	if err != nil || h.Epoch != 3 {
+		t.Errorf("Could not parse header: %+v, %v", h, err)
+	}
+
+	if _, err := Open(make([]byte, 32), data); err == nil {
+		t.Errorf("Opened an envelope with the wrong key")
+	}
+	if _, err := Open(testKey(), data[:HeaderSize-1]); err == nil {
+		t.Errorf("Opened a truncated envelope")
+	}
+
+	// The header is authenticated
+	tampered := append([]byte{}, data...)
+	tampered[6] ^= 1
+	if _, err := Open(testKey(), tampered); err == nil {
+		t.Errorf("Opened an envelope with a tampered epoch")
+	}
+
+	unknown := append([]byte{}, data...)
+	unknown[0] = Version + 1
+	if _, err := Open(testKey(), unknown); err == nil {
+		t.Errorf("Opened an envelope of an unknown version")
+	}
+}
@@ -4,5 +4,8 @@ go 1.14
 
 require (
 	go.dedis.ch/kyber/v3 v3.0.12
-	golang.org/x/crypto v0.0.0-20190611184440-5c40567a22f8 // indirect
+	golang.org/x/crypto v0.0.0-20210921155107-089bfa567519
+	golang.org/x/net v0.1.0
+	golang.org/x/term v0.1.0
+	golang.org/x/text v0.4.0
 )
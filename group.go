@@ -0,0 +1,243 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"sort"
+
+	"github.com/nmohnblatt/cd_client/envelope"
+	"github.com/nmohnblatt/cd_client/ibs"
+	"github.com/nmohnblatt/cd_client/identifier"
+	"github.com/nmohnblatt/cd_client/joux"
+	"github.com/nmohnblatt/cd_client/keyschedule"
+	"github.com/nmohnblatt/cd_client/rendezvous"
+	"go.dedis.ch/kyber/v3/xof/blake2xb"
+)
+
+const (
+	groupShareLabel  = "cd_client group share v1"
+	groupSecretLabel = "cd_client group secret v1"
+)
+
+// Kind of the records carrying group shares at pairwise meeting points
+const recordGroupShare = "group"
+
+// A member's contribution to a three-party meeting point, signed under their identifier
+type groupShare struct {
+	member string
+	share  *joux.Share
+	sig    []byte
+}
+
+// Roster of the group formed with two contacts, who must be contacts of each other too. The
+// roster names us by the identifier both contacts know us by.
+func groupRoster(c1, c2 *contact) ([]string, error) {
+	if c1.status != contactConfirmed || c2.status != contactConfirmed {
+		return nil, errors.New("group: contact is not confirmed")
+	}
+	if c1.local.id != c2.local.id {
+		return nil, errors.New("group: contacts know you by different identifiers")
+	}
+	if c1.id == c2.id {
+		return nil, errors.New("group: duplicate member in roster")
+	}
+	return []string{c1.local.id.String(), c1.id.String(), c2.id.String()}, nil
+}
+
+// Derive our secret for the group formed by roster from the private key of our registration r,
+// so that we contribute the same share at every meeting point and in every run. A pairing only
+// combines the identifiers of two users, so no value of the issued keys alone is known to all
+// three members: that would take a trilinear map. The issued keys rather fix each member's
+// Joux secret, and sign their share, so that the group meeting point only depends on the keys
+// and identifiers of the members, like a pairwise meeting point.
+func groupEphemeral(r *registration, roster []string) (*joux.Ephemeral, error) {
+	if r.sk1 == nil {
+		return nil, errors.New("group: private key unknown, fetch private keys first")
+	}
+	sk, err := r.sk1.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, sk)
+	mac.Write([]byte(groupSecretLabel))
+	mac.Write(encodeRoster(canonicalRoster(roster)))
+
+	return joux.NewEphemeral(suite, blake2xb.New(mac.Sum(nil))), nil
+}
+
+// Sign our ephemeral share for the group formed by the identifiers in roster (which includes
+// that of our registration r), as formatted by identifier.Identifier.String
+func newGroupShare(r *registration, eph *joux.Ephemeral, roster []string) (*groupShare, error) {
+	msg, err := groupShareMessage(&eph.Share, roster)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := ibs.Sign(suite, r.sk1, r.id.Bytes(), msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &groupShare{member: r.id.String(), share: &eph.Share, sig: sig}, nil
+}
+
+// Encode the share and its signature. The member is known from the meeting point it is read at.
+func (s *groupShare) MarshalBinary() ([]byte, error) {
+	share, err := s.share.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append(share, s.sig...), nil
+}
+
+// Decode a share of member encoded with MarshalBinary
+func unmarshalGroupShare(member string, data []byte) (*groupShare, error) {
+	size := suite.G1().PointLen() + suite.G2().PointLen()
+	if len(data) <= size {
+		return nil, errors.New("group: malformed share")
+	}
+	share, err := joux.UnmarshalShare(suite, data[:size])
+	if err != nil {
+		return nil, err
+	}
+	return &groupShare{member: member, share: share, sig: append([]byte(nil), data[size:]...)}, nil
+}
+
+// Derive the key schedule of a three-party group from our ephemeral and the signed shares of
+// the two other members. Every member obtains the same schedule, hence the same meeting point.
+func deriveGroupKeySchedule(u *user, r *registration, eph *joux.Ephemeral, roster []string, peers ...*groupShare) (*keyschedule.Schedule, error) {
+	if len(roster) != 3 || len(peers) != 2 {
+		return nil, errors.New("group: tripartite mode requires exactly three members")
+	}
+	if u.groupKey1 == nil {
+		return nil, errors.New("group: group public key unknown, fetch private keys first")
+	}
+
+	members := canonicalRoster(roster)
+	if members[0] == members[1] || members[1] == members[2] {
+		return nil, errors.New("group: duplicate member in roster")
+	}
+	expected := map[string]bool{}
+	for _, m := range members {
+		expected[m] = true
+	}
+	if !expected[r.id.String()] {
+		return nil, errors.New("group: user is not a member of the roster")
+	}
+	delete(expected, r.id.String())
+
+	for _, p := range peers {
+		if !expected[p.member] {
+			return nil, errors.New("group: share from unexpected member " + p.member)
+		}
+		delete(expected, p.member)
+		member, err := identifier.Parse(p.member, "")
+		if err != nil {
+			return nil, err
+		}
+
+		msg, err := groupShareMessage(p.share, members)
+		if err != nil {
+			return nil, err
+		}
+		if err := ibs.Verify(suite, u.groupKey1, member.Bytes(), msg, p.sig); err != nil {
+			return nil, err
+		}
+	}
+
+	K, err := joux.Agree(suite, eph, peers[0].share, peers[1].share)
+	if err != nil {
+		return nil, err
+	}
+	keymaterial, err := K.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	return keyschedule.New(append(keymaterial, encodeRoster(members)...)), nil
+}
+
+// Publish our share of the group formed with two contacts at our meeting points with each of
+// them, and read theirs. Returns the key schedule of the group once both contacts published
+// their share, nil until then.
+func meetGroup(store rendezvous.Rendezvous, u *user, c1, c2 *contact) (*keyschedule.Schedule, error) {
+	roster, err := groupRoster(c1, c2)
+	if err != nil {
+		return nil, err
+	}
+	eph, err := groupEphemeral(c1.local, roster)
+	if err != nil {
+		return nil, err
+	}
+	share, err := newGroupShare(c1.local, eph, roster)
+	if err != nil {
+		return nil, err
+	}
+	data, err := share.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	// Records of different groups are told apart by the roster, which only enters their keyed name
+	digest := sha256.Sum256(encodeRoster(canonicalRoster(roster)))
+	kind := recordGroupShare + "/" + hex.EncodeToString(digest[:])
+	contacts := []*contact{c1, c2}
+	for _, c := range contacts {
+		if err := putSigned(store, u, c, kind, envelope.GroupShare, data); err != nil {
+			return nil, err
+		}
+		if err := syncMeetingPoint(store, c); err != nil {
+			return nil, err
+		}
+	}
+
+	var peers []*groupShare
+	for _, c := range contacts {
+		data, err := getSigned(store, u, c, kind, envelope.GroupShare)
+		if err == rendezvous.ErrNotFound {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		peer, err := unmarshalGroupShare(c.id.String(), data)
+		if err != nil {
+			return nil, err
+		}
+		peers = append(peers, peer)
+	}
+	return deriveGroupKeySchedule(u, c1.local, eph, roster, peers...)
+}
+
+func groupShareMessage(share *joux.Share, roster []string) ([]byte, error) {
+	shareBytes, err := share.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	msg := []byte(groupShareLabel)
+	msg = append(msg, encodeRoster(canonicalRoster(roster))...)
+
+	return append(msg, shareBytes...), nil
+}
+
+// Members are sorted so that the roster does not depend on who created the group
+func canonicalRoster(roster []string) []string {
+	members := make([]string, len(roster))
+	copy(members, roster)
+	sort.Strings(members)
+
+	return members
+}
+
+func encodeRoster(members []string) []byte {
+	var buf []byte
+	for _, m := range members {
+		var l [2]byte
+		binary.BigEndian.PutUint16(l[:], uint16(len(m)))
+		buf = append(buf, l[:]...)
+		buf = append(buf, m...)
+	}
+	return buf
+}
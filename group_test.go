@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nmohnblatt/cd_client/joux"
+	"github.com/nmohnblatt/cd_client/rendezvous"
+	"go.dedis.ch/kyber/v3/util/random"
+)
+
+func TestGroupMeetingPoint(t *testing.T) {
+	n := 10
+	thr := n/2 + 1
+
+	secret := suite.GT().Scalar().Pick(random.New())
+	serverList, pubPoly1, pubPoly2 := setupThresholdServers(suite, secret, n, thr)
+
+	alice := testUser(t, "Alice", "07111111111")
+	bob := testUser(t, "Bob", "07222222222")
+	charlie := testUser(t, "Charlie", "07333333333")
+	dave := testUser(t, "Dave", "07444444444")
+	users := []*user{alice, bob, charlie, dave}
+	for _, u := range users {
+		if err := u.obtainPrivateKeysBlindThreshold(suite, serverList[:thr], pubPoly1, pubPoly2, thr, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	roster := []string{alice.id.String(), bob.id.String(), charlie.id.String()}
+	ephemerals := make([]*joux.Ephemeral, 3)
+	shares := make([]*groupShare, 3)
+	for i, u := range users[:3] {
+		ephemerals[i] = joux.NewEphemeral(suite, random.New())
+		share, err := newGroupShare(u.registration, ephemerals[i], roster)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shares[i] = share
+	}
+
+	var meetingPoints [][]byte
+	for i, u := range users[:3] {
+		peers := []*groupShare{shares[(i+1)%3], shares[(i+2)%3]}
+		schedule, err := deriveGroupKeySchedule(u, u.registration, ephemerals[i], roster, peers...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		meetingPoints = append(meetingPoints, schedule.MeetingPoint())
+	}
+	if !bytes.Equal(meetingPoints[0], meetingPoints[1]) || !bytes.Equal(meetingPoints[1], meetingPoints[2]) {
+		t.Errorf("Members did not derive the same group meeting point")
+	}
+
+	// Dave replaces Charlie's share with his own, signed under his number
+	daveEph := joux.NewEphemeral(suite, random.New())
+	daveShare, err := newGroupShare(dave.registration, daveEph, roster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	daveShare.member = charlie.id.String()
+	if _, err := deriveGroupKeySchedule(alice, alice.registration, ephemerals[0], roster, shares[1], daveShare); err == nil {
+		t.Errorf("Accepted a share that was not signed by Charlie")
+	}
+
+	// A share signed for another roster is rejected
+	otherRoster := []string{alice.id.String(), bob.id.String(), dave.id.String()}
+	if _, err := deriveGroupKeySchedule(charlie, charlie.registration, ephemerals[2], otherRoster, shares[0], shares[1]); err == nil {
+		t.Errorf("Accepted shares for a roster Charlie is not part of")
+	}
+}
+
+func TestMeetGroup(t *testing.T) {
+	n := 10
+	thr := n/2 + 1
+
+	secret := suite.GT().Scalar().Pick(random.New())
+	serverList, pubPoly1, pubPoly2 := setupThresholdServers(suite, secret, n, thr)
+
+	alice := testUser(t, "Alice", "07111111111")
+	bob := testUser(t, "Bob", "07222222222")
+	charlie := testUser(t, "Charlie", "07333333333")
+	users := []*user{alice, bob, charlie}
+	for _, u := range users {
+		if err := u.obtainPrivateKeysBlindThreshold(suite, serverList[:thr], pubPoly1, pubPoly2, thr, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	contacts := confirmAll(t, users, [][2]int{{0, 1}, {0, 2}, {1, 2}})
+	store := rendezvous.NewMemory()
+
+	// Shares are carried by the pairwise meeting points, so the group forms once all three
+	// members published theirs
+	if schedule, err := meetGroup(store, alice, contacts[alice][0], contacts[alice][1]); err != nil || schedule != nil {
+		t.Fatalf("Alice formed the group alone: %v", err)
+	}
+	if schedule, err := meetGroup(store, bob, contacts[bob][0], contacts[bob][1]); err != nil || schedule != nil {
+		t.Fatalf("Bob formed the group without Charlie: %v", err)
+	}
+	var meetingPoints [][]byte
+	for _, u := range []*user{charlie, alice, bob} {
+		schedule, err := meetGroup(store, u, contacts[u][0], contacts[u][1])
+		if err != nil || schedule == nil {
+			t.Fatalf("%s did not form the group: %v", u.name, err)
+		}
+		meetingPoints = append(meetingPoints, schedule.MeetingPoint())
+	}
+	if !bytes.Equal(meetingPoints[0], meetingPoints[1]) || !bytes.Equal(meetingPoints[1], meetingPoints[2]) {
+		t.Errorf("Members did not derive the same group meeting point")
+	}
+
+	// Shares depend on the issued keys and the roster only, so the group is found again
+	again, err := meetGroup(store, alice, contacts[alice][1], contacts[alice][0])
+	if err != nil || again == nil || !bytes.Equal(again.MeetingPoint(), meetingPoints[0]) {
+		t.Errorf("The group meeting point changed: %v", err)
+	}
+	if _, err := meetGroup(store, alice, contacts[alice][0], contacts[alice][0]); err == nil {
+		t.Errorf("Formed a group with the same contact twice")
+	}
+}
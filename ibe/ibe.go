@@ -0,0 +1,145 @@
+// Package ibe implements the Boneh-Franklin identity-based encryption scheme on top of the
+// keys issued by the contact discovery servers.
+// A user holding sk1 = s*H1(id) (resp. sk2 = s*H2(id)) can decrypt any message that was
+// encrypted to their identifier under the servers' group public key s*B2 (resp. s*B1).
+//
+// The pairing value is hashed into a ChaCha20-Poly1305 key which seals the message, so that
+// ciphertexts are both confidential and tamper-evident.
+//
+// WARNING: Encrypt2 and Decrypt2 rely on an insecure hash-to-G2 function
+package ibe
+
+import (
+	"crypto/sha256"
+	"errors"
+
+	"github.com/nmohnblatt/cd_client/hash"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/util/random"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const keyLabel = "cd_client ibe v1"
+
+// Ciphertext is a Boneh-Franklin ciphertext: an ephemeral point U = r*B and the sealed message C
+type Ciphertext struct {
+	U kyber.Point
+	C []byte
+}
+
+// Encrypt encrypts msg to the identifier id. The recipient decrypts using their private key
+// sk1 = s*H1(id) on G1. The group public key master = s*B2 is a point on G2.
+func Encrypt(suite pairing.Suite, master kyber.Point, id, msg []byte) (*Ciphertext, error) {
+	r := suite.G1().Scalar().Pick(random.New())
+	U := suite.G2().Point().Mul(r, nil)
+
+	// g = e(H1(id), s*B2)^r = e(s*H1(id), r*B2)
+	g := suite.Pair(hash.HashtoG1(suite, id), master)
+	g.Mul(r, g)
+
+	return seal(g, U, id, msg)
+}
+
+// Decrypt recovers the message contained in ct using the private key sk1 = s*H1(id) on G1
+func Decrypt(suite pairing.Suite, sk1 kyber.Point, id []byte, ct *Ciphertext) ([]byte, error) {
+	g := suite.Pair(sk1, ct.U)
+	return open(g, ct.U, id, ct.C)
+}
+
+// Encrypt2 encrypts msg to the identifier id. The recipient decrypts using their private key
+// sk2 = s*H2(id) on G2. The group public key master = s*B1 is a point on G1.
+func Encrypt2(suite pairing.Suite, master kyber.Point, id, msg []byte) (*Ciphertext, error) {
+	r := suite.G2().Scalar().Pick(random.New())
+	U := suite.G1().Point().Mul(r, nil)
+
+	// g = e(s*B1, H2(id))^r = e(r*B1, s*H2(id))
+	g := suite.Pair(master, hash.InsecureHashtoG2(suite, id))
+	g.Mul(r, g)
+
+	return seal(g, U, id, msg)
+}
+
+// Decrypt2 recovers the message contained in ct using the private key sk2 = s*H2(id) on G2
+func Decrypt2(suite pairing.Suite, sk2 kyber.Point, id []byte, ct *Ciphertext) ([]byte, error) {
+	g := suite.Pair(ct.U, sk2)
+	return open(g, ct.U, id, ct.C)
+}
+
+// MarshalBinary encodes the ciphertext as U || C
+func (ct *Ciphertext) MarshalBinary() ([]byte, error) {
+	u, err := ct.U.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append(u, ct.C...), nil
+}
+
+// UnmarshalCiphertext decodes a ciphertext whose ephemeral point U lies in the given group.
+// Use G2 for ciphertexts produced by Encrypt and G1 for those produced by Encrypt2.
+func UnmarshalCiphertext(group kyber.Group, data []byte) (*Ciphertext, error) {
+	U := group.Point()
+	if len(data) < U.MarshalSize() {
+		return nil, errors.New("ibe: ciphertext too short")
+	}
+	if err := U.UnmarshalBinary(data[:U.MarshalSize()]); err != nil {
+		return nil, err
+	}
+	C := make([]byte, len(data)-U.MarshalSize())
+	copy(C, data[U.MarshalSize():])
+
+	return &Ciphertext{U: U, C: C}, nil
+}
+
+// Every key is used for a single message, so a fixed nonce is safe
+func seal(g, U kyber.Point, id, msg []byte) (*Ciphertext, error) {
+	key, err := deriveKey(g, U, id)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+
+	return &Ciphertext{U: U, C: aead.Seal(nil, nonce, msg, id)}, nil
+}
+
+func open(g, U kyber.Point, id, C []byte) ([]byte, error) {
+	key, err := deriveKey(g, U, id)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+
+	msg, err := aead.Open(nil, nonce, C, id)
+	if err != nil {
+		return nil, errors.New("ibe: could not decrypt ciphertext")
+	}
+	return msg, nil
+}
+
+// Hash the pairing value together with the ephemeral point and the recipient's identifier
+func deriveKey(g, U kyber.Point, id []byte) ([]byte, error) {
+	gBytes, err := g.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	uBytes, err := U.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	h.Write([]byte(keyLabel))
+	h.Write(gBytes)
+	h.Write(uBytes)
+	h.Write(id)
+
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,117 @@
+package ibe
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nmohnblatt/cd_client/hash"
+	"go.dedis.ch/kyber/v3/pairing/bn256"
+	"go.dedis.ch/kyber/v3/util/random"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	suite := bn256.NewSuite()
+	msg := []byte("Hello Boneh-Franklin")
+	id := []byte("07111111111")
+
+	s := suite.G1().Scalar().Pick(random.New())
+	master := suite.G2().Point().Mul(s, nil)
+	sk1 := suite.G1().Point().Mul(s, hash.HashtoG1(suite, id))
+
+	ct, err := Encrypt(suite, master, id, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test, err := Decrypt(suite, sk1, id, ct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(test, msg) {
+		t.Errorf("Decrypted message does not match")
+	}
+}
+
+func TestEncryptDecrypt2(t *testing.T) {
+	suite := bn256.NewSuite()
+	msg := []byte("Hello Boneh-Franklin")
+	id := []byte("07111111111")
+
+	s := suite.G2().Scalar().Pick(random.New())
+	master := suite.G1().Point().Mul(s, nil)
+	sk2 := suite.G2().Point().Mul(s, hash.InsecureHashtoG2(suite, id))
+
+	ct, err := Encrypt2(suite, master, id, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test, err := Decrypt2(suite, sk2, id, ct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(test, msg) {
+		t.Errorf("Decrypted message does not match")
+	}
+}
+
+func TestDecryptWrongIdentity(t *testing.T) {
+	suite := bn256.NewSuite()
+	msg := []byte("Hello Boneh-Franklin")
+	alice := []byte("07111111111")
+	bob := []byte("07222222222")
+
+	s := suite.G1().Scalar().Pick(random.New())
+	master := suite.G2().Point().Mul(s, nil)
+	bobKey := suite.G1().Point().Mul(s, hash.HashtoG1(suite, bob))
+
+	ct, err := Encrypt(suite, master, alice, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decrypt(suite, bobKey, bob, ct); err == nil {
+		t.Errorf("Decrypted a message intended for another identity")
+	}
+	if _, err := Decrypt(suite, bobKey, alice, ct); err == nil {
+		t.Errorf("Decrypted a message using another identity's key")
+	}
+}
+
+func TestMarshalCiphertext(t *testing.T) {
+	suite := bn256.NewSuite()
+	msg := []byte("Hello Boneh-Franklin")
+	id := []byte("07111111111")
+
+	s := suite.G1().Scalar().Pick(random.New())
+	master := suite.G2().Point().Mul(s, nil)
+	sk1 := suite.G1().Point().Mul(s, hash.HashtoG1(suite, id))
+
+	ct, err := Encrypt(suite, master, id, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ct.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := UnmarshalCiphertext(suite.G2(), buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test, err := Decrypt(suite, sk1, id, decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(test, msg) {
+		t.Errorf("Decrypted message does not match")
+	}
+
+	// Flip a bit of the sealed message
+	buf[len(buf)-1] ^= 1
+	tampered, err := UnmarshalCiphertext(suite.G2(), buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decrypt(suite, sk1, id, tampered); err == nil {
+		t.Errorf("Decrypted a tampered ciphertext")
+	}
+}
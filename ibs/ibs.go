@@ -0,0 +1,113 @@
+// Package ibs implements the Cha-Cheon identity-based signature scheme on top of the keys
+// issued by the contact discovery servers.
+// A user holding sk1 = s*H1(id) (resp. sk2 = s*H2(id)) signs as their identifier, and anyone
+// knowing the servers' group public key s*B2 (resp. s*B1) can check the signature against id.
+//
+// WARNING: Sign2 and Verify2 rely on an insecure hash-to-G2 function
+package ibs
+
+import (
+	"errors"
+
+	"github.com/nmohnblatt/cd_client/hash"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/util/random"
+	"go.dedis.ch/kyber/v3/xof/blake2xb"
+)
+
+const challengeLabel = "cd_client ibs v1"
+
+// Sign creates a signature (U, V) on msg using the private key sk1 = s*H1(id) on G1, where
+// U = r*H1(id), h = H(msg, U) and V = (r + h)*sk1. Both U and V are points on G1.
+func Sign(suite pairing.Suite, sk1 kyber.Point, id, msg []byte) ([]byte, error) {
+	return sign(suite.G1(), hash.HashtoG1(suite, id), sk1, msg)
+}
+
+// Verify checks the signature sig on msg against the identifier id and the group public key
+// master = s*B2 by verifying that e(V, B2) == e(U + h*H1(id), master)
+func Verify(suite pairing.Suite, master kyber.Point, id, msg, sig []byte) error {
+	U, V, h, err := decode(suite.G1(), msg, sig)
+	if err != nil {
+		return err
+	}
+	Q := hash.HashtoG1(suite, id)
+	UhQ := suite.G1().Point().Add(U, suite.G1().Point().Mul(h, Q))
+
+	left := suite.Pair(V, suite.G2().Point().Base())
+	right := suite.Pair(UhQ, master)
+	if !left.Equal(right) {
+		return errors.New("ibs: invalid signature")
+	}
+	return nil
+}
+
+// Sign2 creates a signature (U, V) on msg using the private key sk2 = s*H2(id) on G2, where
+// U = r*H2(id), h = H(msg, U) and V = (r + h)*sk2. Both U and V are points on G2.
+func Sign2(suite pairing.Suite, sk2 kyber.Point, id, msg []byte) ([]byte, error) {
+	return sign(suite.G2(), hash.InsecureHashtoG2(suite, id), sk2, msg)
+}
+
+// Verify2 checks the signature sig on msg against the identifier id and the group public key
+// master = s*B1 by verifying that e(B1, V) == e(master, U + h*H2(id))
+func Verify2(suite pairing.Suite, master kyber.Point, id, msg, sig []byte) error {
+	U, V, h, err := decode(suite.G2(), msg, sig)
+	if err != nil {
+		return err
+	}
+	Q := hash.InsecureHashtoG2(suite, id)
+	UhQ := suite.G2().Point().Add(U, suite.G2().Point().Mul(h, Q))
+
+	left := suite.Pair(suite.G1().Point().Base(), V)
+	right := suite.Pair(master, UhQ)
+	if !left.Equal(right) {
+		return errors.New("ibs: invalid signature")
+	}
+	return nil
+}
+
+func sign(group kyber.Group, Q, sk kyber.Point, msg []byte) ([]byte, error) {
+	r := group.Scalar().Pick(random.New())
+	U := group.Point().Mul(r, Q)
+
+	uBytes, err := U.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	h := challenge(group, uBytes, msg)
+	V := group.Point().Mul(group.Scalar().Add(r, h), sk)
+
+	vBytes, err := V.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append(uBytes, vBytes...), nil
+}
+
+// Split a signature into its two points and recompute the challenge h
+func decode(group kyber.Group, msg, sig []byte) (kyber.Point, kyber.Point, kyber.Scalar, error) {
+	size := group.PointLen()
+	if len(sig) != 2*size {
+		return nil, nil, nil, errors.New("ibs: wrong signature length")
+	}
+	U := group.Point()
+	if err := U.UnmarshalBinary(sig[:size]); err != nil {
+		return nil, nil, nil, err
+	}
+	V := group.Point()
+	if err := V.UnmarshalBinary(sig[size:]); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return U, V, challenge(group, sig[:size], msg), nil
+}
+
+// Hash the commitment U and the message to a scalar
+func challenge(group kyber.Group, U, msg []byte) kyber.Scalar {
+	seed := make([]byte, 0, len(challengeLabel)+len(U)+len(msg))
+	seed = append(seed, challengeLabel...)
+	seed = append(seed, U...)
+	seed = append(seed, msg...)
+
+	return group.Scalar().Pick(blake2xb.New(seed))
+}
@@ -0,0 +1,75 @@
+package ibs
+
+import (
+	"testing"
+
+	"github.com/nmohnblatt/cd_client/hash"
+	"go.dedis.ch/kyber/v3/pairing/bn256"
+	"go.dedis.ch/kyber/v3/util/random"
+)
+
+func TestSignVerify(t *testing.T) {
+	suite := bn256.NewSuite()
+	msg := []byte("Hello Cha-Cheon")
+	id := []byte("07111111111")
+
+	s := suite.G1().Scalar().Pick(random.New())
+	master := suite.G2().Point().Mul(s, nil)
+	sk1 := suite.G1().Point().Mul(s, hash.HashtoG1(suite, id))
+
+	sig, err := Sign(suite, sk1, id, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(suite, master, id, msg, sig); err != nil {
+		t.Errorf("Signature did not verify: %s", err)
+	}
+	if err := Verify(suite, master, []byte("07222222222"), msg, sig); err == nil {
+		t.Errorf("Signature verified under the wrong identity")
+	}
+	if err := Verify(suite, master, id, []byte("Goodbye Cha-Cheon"), sig); err == nil {
+		t.Errorf("Signature verified on the wrong message")
+	}
+}
+
+func TestSignVerify2(t *testing.T) {
+	suite := bn256.NewSuite()
+	msg := []byte("Hello Cha-Cheon")
+	id := []byte("07111111111")
+
+	s := suite.G2().Scalar().Pick(random.New())
+	master := suite.G1().Point().Mul(s, nil)
+	sk2 := suite.G2().Point().Mul(s, hash.InsecureHashtoG2(suite, id))
+
+	sig, err := Sign2(suite, sk2, id, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify2(suite, master, id, msg, sig); err != nil {
+		t.Errorf("Signature did not verify: %s", err)
+	}
+	if err := Verify2(suite, master, []byte("07222222222"), msg, sig); err == nil {
+		t.Errorf("Signature verified under the wrong identity")
+	}
+}
+
+func TestVerifyWrongMaster(t *testing.T) {
+	suite := bn256.NewSuite()
+	msg := []byte("Hello Cha-Cheon")
+	id := []byte("07111111111")
+
+	s := suite.G1().Scalar().Pick(random.New())
+	sk1 := suite.G1().Point().Mul(s, hash.HashtoG1(suite, id))
+	other := suite.G2().Point().Mul(suite.G1().Scalar().Pick(random.New()), nil)
+
+	sig, err := Sign(suite, sk1, id, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(suite, other, id, msg, sig); err == nil {
+		t.Errorf("Signature verified under the wrong group public key")
+	}
+	if err := Verify(suite, other, id, msg, sig[:10]); err == nil {
+		t.Errorf("Truncated signature was accepted")
+	}
+}
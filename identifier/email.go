@@ -0,0 +1,88 @@
+package identifier
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Limits of RFC 5321
+const (
+	maxLocalPart   = 64
+	maxDomain      = 253
+	maxDomainLabel = 63
+)
+
+func normalizeEmail(address string) (string, error) {
+	a := strings.TrimPrefix(strings.TrimSpace(address), "mailto:")
+	at := strings.LastIndexByte(a, '@')
+	if at < 0 {
+		return "", errors.New("no @")
+	}
+	local, domain := a[:at], a[at+1:]
+
+	// Local parts are case sensitive in theory, but no provider treats them so
+	local = norm.NFKC.String(cases.Fold().String(norm.NFKC.String(local)))
+	switch {
+	case local == "":
+		return "", errors.New("empty local part")
+	case len(local) > maxLocalPart:
+		return "", errors.New("local part too long")
+	case strings.ContainsAny(local, " \t\"(),:;<>@[\\]"):
+		return "", errors.New("local part with special characters")
+	case strings.HasPrefix(local, ".") || strings.HasSuffix(local, ".") || strings.Contains(local, ".."):
+		return "", errors.New("misplaced dot in local part")
+	}
+
+	domain, err := asciiDomain(domain)
+	if err != nil {
+		return "", err
+	}
+	return local + "@" + domain, nil
+}
+
+// Domains are mapped as for lookup (UTS #46), but without the transitional mapping that turns
+// "ß" into "ss" when built with Go releases before 1.18, as both are distinct registered domains
+var idnaLookup = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.Transitional(false))
+
+// Convert a domain to the lower-case ASCII form used in DNS
+func asciiDomain(domain string) (string, error) {
+	domain, err := idnaLookup.ToASCII(domain)
+	if err != nil {
+		return "", errors.New("invalid domain")
+	}
+	domain = strings.TrimSuffix(domain, ".")
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return "", errors.New("domain without a dot")
+	}
+	for _, label := range labels {
+		if err := checkLabel(label); err != nil {
+			return "", err
+		}
+	}
+	if len(domain) > maxDomain {
+		return "", errors.New("domain too long")
+	}
+	return domain, nil
+}
+
+// Labels are letters, digits and hyphens, and neither start nor end with a hyphen
+func checkLabel(label string) error {
+	if label == "" || len(label) > maxDomainLabel {
+		return errors.New("invalid domain label length")
+	}
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return errors.New("domain label starts or ends with a hyphen")
+	}
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return errors.New("invalid character in domain")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+// Package identifier defines the identities users register and are discovered by: phone
+// numbers, email addresses and usernames. Every kind has one canonical spelling, and is hashed
+// to keys under its own domain-separation tag, so the email address and the username that
+// happen to be written the same never share keys.
+package identifier
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/nmohnblatt/cd_client/phonenumber"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Kind of identifier
+type Kind byte
+
+const (
+	// Phone is a phone number in E.164 format
+	Phone Kind = iota + 1
+	// Email is an email address, lower case with an ASCII domain
+	Email
+	// Username is a Unicode username, NFKC normalized and case folded
+	Username
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Phone:
+		return "phone"
+	case Email:
+		return "email"
+	case Username:
+		return "username"
+	default:
+		return "unknown"
+	}
+}
+
+const hashLabel = "cd_client identifier v1 "
+
+// Reasons for rejecting an identifier. Phone numbers are also rejected with the errors of the
+// phonenumber package.
+var (
+	ErrEmpty           = errors.New("identifier: empty")
+	ErrServiceNumber   = errors.New("identifier: service numbers cannot be contacts")
+	ErrInvalidEmail    = errors.New("identifier: invalid email address")
+	ErrInvalidUsername = errors.New("identifier: invalid username")
+)
+
+// MaxUsernameLength is the maximum number of characters of a username
+const MaxUsernameLength = 64
+
+// Identifier is a normalized identifier. Identifiers are comparable: two spellings of the same
+// identity give equal values.
+type Identifier struct {
+	Kind  Kind
+	Value string
+}
+
+// NewPhone normalizes a phone number, reading it in region if it has no country calling code.
+// Service numbers such as toll free lines are not owned by a person and are rejected.
+func NewPhone(number, region string) (Identifier, error) {
+	n, err := phonenumber.Parse(number, region)
+	if err != nil {
+		return Identifier{}, err
+	}
+	switch n.Type {
+	case phonenumber.TollFree, phonenumber.PremiumRate, phonenumber.SharedCost, phonenumber.Pager:
+		return Identifier{}, fmt.Errorf("%q is a %s number: %w", number, n.Type, ErrServiceNumber)
+	}
+	return Identifier{Phone, n.E164()}, nil
+}
+
+// NewEmail normalizes an email address. The address is lower-cased, and an internationalized
+// domain is converted to its ASCII form, so "Alice@Bücher.example" and
+// "alice@xn--bcher-kva.example" are the same identifier.
+func NewEmail(address string) (Identifier, error) {
+	a, err := normalizeEmail(address)
+	if err != nil {
+		return Identifier{}, fmt.Errorf("%w %q: %v", ErrInvalidEmail, address, err)
+	}
+	return Identifier{Email, a}, nil
+}
+
+// NewUsername normalizes a username with Unicode NFKC and case folding, so that
+// compatibility characters and case variants ("Ａlice", "ALICE") give the same identifier.
+// Usernames are letters, digits, marks and the punctuation "._-", with at least one letter.
+func NewUsername(name string) (Identifier, error) {
+	fold := cases.Fold()
+	u := norm.NFKC.String(fold.String(norm.NFKC.String(strings.TrimSpace(name))))
+	u = strings.TrimPrefix(u, "@")
+
+	n, letters := 0, 0
+	for _, r := range u {
+		n++
+		switch {
+		case unicode.IsLetter(r):
+			letters++
+		case unicode.IsDigit(r), unicode.IsMark(r), r == '.', r == '_', r == '-':
+		default:
+			return Identifier{}, fmt.Errorf("%w %q: character %q not allowed", ErrInvalidUsername, name, r)
+		}
+	}
+	switch {
+	case n == 0:
+		return Identifier{}, ErrEmpty
+	case n > MaxUsernameLength:
+		return Identifier{}, fmt.Errorf("%w %q: longer than %d characters", ErrInvalidUsername, name, MaxUsernameLength)
+	case letters == 0:
+		return Identifier{}, fmt.Errorf("%w %q: no letter", ErrInvalidUsername, name)
+	}
+	return Identifier{Username, u}, nil
+}
+
+// Parse reads an identifier as a user types it. An explicit kind may be given as in
+// "email:alice@example.com", which is also how String formats identifiers. Otherwise anything
+// with an "@" after its first character is an email address, anything that starts with "+",
+// "(" or a digit is a phone number read in region, and anything else is a username; a leading
+// "@" also marks a username.
+func Parse(s, region string) (Identifier, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Identifier{}, ErrEmpty
+	}
+	if i := strings.IndexByte(s, ':'); i > 0 {
+		switch s[:i] {
+		case Phone.String(), "tel":
+			return NewPhone(s[i+1:], region)
+		case Email.String(), "mailto":
+			return NewEmail(s[i+1:])
+		case Username.String():
+			return NewUsername(s[i+1:])
+		}
+	}
+	switch {
+	case strings.LastIndexByte(s, '@') > 0:
+		return NewEmail(s)
+	case s[0] == '+' || s[0] == '(' || (s[0] >= '0' && s[0] <= '9'):
+		return NewPhone(s, region)
+	default:
+		return NewUsername(s)
+	}
+}
+
+// String formats the identifier as its kind and value, e.g. "phone:+447700900123". Parse reads
+// it back.
+func (id Identifier) String() string {
+	return id.Kind.String() + ":" + id.Value
+}
+
+// Bytes is what the identifier is hashed to keys from. The value is prefixed with a tag naming
+// its kind, so identifiers of different kinds never hash to the same keys.
+func (id Identifier) Bytes() []byte {
+	b := make([]byte, 0, len(hashLabel)+len(id.Kind.String())+1+len(id.Value))
+	b = append(b, hashLabel...)
+	b = append(b, id.Kind.String()...)
+	b = append(b, 0)
+	return append(b, id.Value...)
+}
+
+// Region returns the region of a phone number, in which the numbers of its owner's contacts
+// are read when they have no country calling code. Returns defaultRegion for other kinds and
+// for numbers of regions without a numbering plan.
+func (id Identifier) Region(defaultRegion string) string {
+	if id.Kind != Phone {
+		return defaultRegion
+	}
+	n, err := phonenumber.Parse(id.Value, defaultRegion)
+	if err != nil || n.Region == "" {
+		return defaultRegion
+	}
+	return n.Region
+}
@@ -0,0 +1,93 @@
+package identifier
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/nmohnblatt/cd_client/phonenumber"
+)
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		want  Identifier
+	}{
+		{"07700 900123", Identifier{Phone, "+447700900123"}},
+		{"+44 7700 900123", Identifier{Phone, "+447700900123"}},
+		{"tel:+447700900123", Identifier{Phone, "+447700900123"}},
+		{"phone:+447700900123", Identifier{Phone, "+447700900123"}},
+		{"Alice@Example.COM", Identifier{Email, "alice@example.com"}},
+		{"mailto:alice@example.com.", Identifier{Email, "alice@example.com"}},
+		{"alice@Bücher.example", Identifier{Email, "alice@xn--bcher-kva.example"}},
+		{"alice@xn--bcher-kva.example", Identifier{Email, "alice@xn--bcher-kva.example"}},
+		{"alice@bücher．example", Identifier{Email, "alice@xn--bcher-kva.example"}},
+		// Unlike usernames, domains keep ß, as straße.de and strasse.de are different domains
+		{"alice@straße.de", Identifier{Email, "alice@xn--strae-oqa.de"}},
+		{"alice@STRASSE.de", Identifier{Email, "alice@strasse.de"}},
+		{"Alice", Identifier{Username, "alice"}},
+		{"@alice", Identifier{Username, "alice"}},
+		// Fullwidth letters are compatibility characters
+		{"Ａlice", Identifier{Username, "alice"}},
+		{"Straße", Identifier{Username, "strasse"}},
+		{"username:bob_2", Identifier{Username, "bob_2"}},
+	} {
+		id, err := Parse(test.input, "GB")
+		if err != nil {
+			t.Errorf("%q: %v", test.input, err)
+			continue
+		}
+		if id != test.want {
+			t.Errorf("%q: got %v, expected %v", test.input, id, test.want)
+		}
+		if back, err := Parse(id.String(), ""); err != nil || back != id {
+			t.Errorf("%v does not parse back: %v, %v", id, back, err)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		err   error
+	}{
+		{"  ", ErrEmpty},
+		{"0800 123 4567", ErrServiceNumber},
+		{"0770090", phonenumber.ErrTooShort},
+		{"alice@localhost", ErrInvalidEmail},
+		{"alice@exa mple.com", ErrInvalidEmail},
+		{".alice@example.com", ErrInvalidEmail},
+		{"alice@-example.com", ErrInvalidEmail},
+		{"alice smith", ErrInvalidUsername},
+		{"_2020_", ErrInvalidUsername},
+	} {
+		if _, err := Parse(test.input, "GB"); !errors.Is(err, test.err) {
+			t.Errorf("%q: got %v, expected %v", test.input, err, test.err)
+		}
+	}
+}
+
+func TestDomainSeparation(t *testing.T) {
+	// The same value under two kinds must not hash the same
+	email := Identifier{Email, "alice@example.com"}
+	username := Identifier{Username, "alice@example.com"}
+	if bytes.Equal(email.Bytes(), username.Bytes()) {
+		t.Errorf("Identifiers of different kinds hash the same")
+	}
+	if email.String() == username.String() {
+		t.Errorf("Identifiers of different kinds format the same")
+	}
+}
+
+func TestRegion(t *testing.T) {
+	id, err := NewPhone("+1 416 555 0123", "CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := id.Region("CA"); r != "CA" {
+		t.Errorf("Got region %q", r)
+	}
+	if r := (Identifier{Username, "alice"}).Region("FR"); r != "FR" {
+		t.Errorf("Got region %q for a username", r)
+	}
+}
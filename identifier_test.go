@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nmohnblatt/cd_client/identifier"
+	"github.com/nmohnblatt/cd_client/phonenumber"
+	"github.com/nmohnblatt/cd_client/rendezvous"
+	"go.dedis.ch/kyber/v3/util/random"
+)
+
+// Create a user, failing the test if the identifier is rejected
+func testUser(t *testing.T, name, id string) *user {
+	t.Helper()
+	u, err := newUser(name, id, "GB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// Issue private keys to users from threshold servers, which also gives them the group public
+// key that signatures on posts are checked with
+func issueKeys(t *testing.T, users ...*user) {
+	t.Helper()
+	n := 3
+	thr := 2
+	secret := suite.GT().Scalar().Pick(random.New())
+	serverList, pubPoly1, pubPoly2 := setupThresholdServers(suite, secret, n, thr)
+	for _, u := range users {
+		if err := u.obtainPrivateKeysThreshold(suite, serverList[:thr], pubPoly1, pubPoly2, thr, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Derive shared keys with a contact identifier as the user would type it
+func testContact(t *testing.T, u *user, id string) *contact {
+	t.Helper()
+	parsed, err := identifier.Parse(id, u.region)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newContact(u, parsed)
+}
+
+func TestNormalizedIdentifiersMeet(t *testing.T) {
+	s1 := newDummyServer(1)
+	alice := testUser(t, "Alice", "07111 111111")
+	alice.obtainPrivateKeys(s1)
+	bob := testUser(t, "Bob", "+44 7222 222222")
+	bob.obtainPrivateKeys(s1)
+	if alice.id.String() != "phone:+447111111111" || alice.region != "GB" {
+		t.Errorf("Wrong normalized number %v in %s", alice.id, alice.region)
+	}
+
+	// However the numbers are written, both sides derive the same meeting point
+	want := testContact(t, bob, "00447111111111").meetingPoint
+	for _, number := range []string{"07222222222", "447222222222", "+44 (0)7222-222-222"} {
+		if c := testContact(t, alice, number); string(c.meetingPoint) != string(want) {
+			t.Errorf("%q does not meet Bob", number)
+		}
+	}
+
+	// Users registered with an email address or a username are found by it
+	carol := testUser(t, "Carol", "Carol@Example.com")
+	carol.obtainPrivateKeys(s1)
+	dave := testUser(t, "Dave", "Ｄave")
+	dave.obtainPrivateKeys(s1)
+	if string(testContact(t, carol, "dave").meetingPoint) != string(testContact(t, dave, "carol@example.COM").meetingPoint) {
+		t.Errorf("Carol and Dave do not meet")
+	}
+	// An email address and a username written the same are different identities
+	email := newContact(dave, identifier.Identifier{Kind: identifier.Email, Value: "carol"})
+	username := newContact(dave, identifier.Identifier{Kind: identifier.Username, Value: "carol"})
+	if string(email.meetingPoint) == string(username.meetingPoint) {
+		t.Errorf("Identifiers of different kinds share a meeting point")
+	}
+}
+
+func TestRejectedIdentifiers(t *testing.T) {
+	if _, err := newUser("Alice", "07111", "GB"); !errors.Is(err, phonenumber.ErrTooShort) {
+		t.Errorf("Short number not rejected: %v", err)
+	}
+	if _, err := newUser("Alice", "+999 1234567", "GB"); !errors.Is(err, phonenumber.ErrUnknownCountryCode) {
+		t.Errorf("Unknown country calling code not rejected: %v", err)
+	}
+	// National numbers are read in the region given
+	if u, err := newUser("Bob", "(212) 555-0123", "US"); err != nil || u.id.Value != "+12125550123" || u.region != "US" {
+		t.Errorf("National number not read in the region given: %v", err)
+	}
+	// Numbers of regions without a numbering plan are accepted in international format
+	if u, err := newUser("Anders", "+45 32 12 34 56", "GB"); err != nil || u.id.Value != "+4532123456" || u.region != "GB" {
+		t.Errorf("Number of a region without a numbering plan not accepted: %v", err)
+	}
+	if _, err := newUser("Alice", "0800 123 4567", "GB"); !errors.Is(err, identifier.ErrServiceNumber) {
+		t.Errorf("Toll free number not rejected: %v", err)
+	}
+	if _, err := newUser("Alice", "alice@localhost", "GB"); !errors.Is(err, identifier.ErrInvalidEmail) {
+		t.Errorf("Email address without a domain not rejected: %v", err)
+	}
+}
+
+func TestMultipleIdentifiers(t *testing.T) {
+	n, thr := 3, 2
+	secret := suite.GT().Scalar().Pick(random.New())
+	serverList, pubPoly1, pubPoly2 := setupThresholdServers(suite, secret, n, thr)
+
+	alice := testUser(t, "Alice", "07111111111")
+	if err := alice.addIdentifier("Alice@Example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.addIdentifier("alice@example.com"); err == nil {
+		t.Errorf("Registered the same identifier twice")
+	}
+	bob := testUser(t, "Bob", "bob")
+	for _, u := range []*user{alice, bob} {
+		if err := u.obtainPrivateKeysBlindThreshold(suite, serverList[:thr], pubPoly1, pubPoly2, thr, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Alice has Bob's number, with which he did not register, and his username. Bob only has
+	// Alice's email address.
+	bobNumber, _ := identifier.Parse("07222222222", alice.region)
+	candidates := contactCandidates(alice, []identifier.Identifier{bobNumber, bob.id, alice.id})
+	if len(candidates) != 4 {
+		t.Fatalf("Expected 4 candidates without Alice's own number, got %d", len(candidates))
+	}
+	aliceEmail := alice.registrations[1].id
+	store := rendezvous.NewMemory()
+	if _, found, err := meetPerson(store, bob, contactCandidates(bob, []identifier.Identifier{aliceEmail})); err != nil || found {
+		t.Fatalf("Bob met Alice before she joined: %v", err)
+	}
+	c, found, err := meetPerson(store, alice, candidates)
+	if err != nil || !found {
+		t.Fatalf("Alice did not meet Bob: %v", err)
+	}
+	if c.local.id != aliceEmail || c.id != bob.id || c.status != contactConfirmed {
+		t.Errorf("Kept the wrong meeting point, from %v to %v", c.local.id, c.id)
+	}
+
+	// Invitations to any of Alice's identifiers open
+	invitation, err := createInvitation(bob, aliceEmail, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sender, _, err := openInvitation(alice, invitation); err != nil || sender != bob.id {
+		t.Errorf("Invitation to Alice's email address did not open: %v", err)
+	}
+}
+
+func TestMeetPersonAgrees(t *testing.T) {
+	n, thr := 3, 2
+	secret := suite.GT().Scalar().Pick(random.New())
+	serverList, pubPoly1, pubPoly2 := setupThresholdServers(suite, secret, n, thr)
+
+	alice := testUser(t, "Alice", "07111111111")
+	bob := testUser(t, "Bob", "bob")
+	if err := alice.addIdentifier("alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.addIdentifier("07222222222"); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []*user{alice, bob} {
+		if err := u.obtainPrivateKeysBlindThreshold(suite, serverList[:thr], pubPoly1, pubPoly2, thr, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each has both identifiers of the other, listed in a different order, so that their first
+	// candidates are different meeting points
+	store := rendezvous.NewMemory()
+	bobCandidates := contactCandidates(bob, []identifier.Identifier{alice.registrations[1].id, alice.id})
+	if _, found, err := meetPerson(store, bob, bobCandidates); err != nil || found {
+		t.Fatalf("Bob met Alice before she joined: %v", err)
+	}
+	aliceCandidates := contactCandidates(alice, []identifier.Identifier{bob.registrations[1].id, bob.id})
+	if string(aliceCandidates[0].meetingPoint) == string(bobCandidates[0].meetingPoint) {
+		t.Fatal("Alice and Bob list each other in the same order")
+	}
+	a, found, err := meetPerson(store, alice, aliceCandidates)
+	if err != nil || !found {
+		t.Fatalf("Alice did not meet Bob: %v", err)
+	}
+	b, found, err := meetPerson(store, bob, bobCandidates)
+	if err != nil || !found {
+		t.Fatalf("Bob did not meet Alice: %v", err)
+	}
+	if string(a.meetingPoint) != string(b.meetingPoint) {
+		t.Errorf("Alice kept the meeting point of %v and %v, Bob that of %v and %v", a.local.id, a.id, b.local.id, b.id)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nmohnblatt/cd_client/addressbook"
+	"github.com/nmohnblatt/cd_client/identifier"
+)
+
+// A person imported from an address book, with the name they were saved under. Shared keys are
+// derived for every pair of their identifiers and ours, and contact is the candidate kept once
+// meeting points were established.
+type importedContact struct {
+	name string
+	*contact
+	candidates []*contact
+}
+
+// Read an address book file. The format is chosen from the file extension. The columns of CSV
+// files are read with mapping, or detected from the header if it is nil. Entries that could not
+// be read are reported in an addressbook.Errors value returned with the other records.
+func readAddressBook(path string, mapping *addressbook.CSVMapping) ([]addressbook.Record, error) {
+	var read func(io.Reader, addressbook.Options) ([]addressbook.Record, error)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".vcf", ".vcard":
+		read = addressbook.ReadVCard
+	case ".csv":
+		read = func(r io.Reader, opts addressbook.Options) ([]addressbook.Record, error) {
+			return addressbook.ReadCSV(r, mapping, opts)
+		}
+	default:
+		return nil, errors.New("import: unsupported address book format " + filepath.Ext(path))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return read(f, addressbook.Options{Emails: true})
+}
+
+// Derive shared keys with every phone number and email address of the records, from every
+// identifier of the user. Identifiers are compared once normalized, so one listed under several
+// records, however it is written, is only processed once, under the first name. Identifiers that
+// are not valid are skipped and returned with the reason. Shared keys are derived in parallel,
+// and each person is sent on the returned channel as soon as all their identifiers are done. The
+// channel is closed once every record is processed or ctx is cancelled.
+func processContacts(ctx context.Context, u *user, records []addressbook.Record) (<-chan importedContact, []error) {
+	var rejected []error
+	var ids []identifier.Identifier
+	// Record each identifier comes from. The identifiers of record i follow each other, from
+	// first[i] on, and count[i] of them are kept.
+	var owners []int
+	first := make([]int, len(records))
+	count := make([]int, len(records))
+	seen := map[identifier.Identifier]bool{}
+	for i, r := range records {
+		first[i] = len(ids)
+		for _, e := range r.Entries {
+			var id identifier.Identifier
+			var err error
+			switch e.Kind {
+			case addressbook.Phone:
+				id, err = identifier.NewPhone(e.Value, u.region)
+			case addressbook.Email:
+				id, err = identifier.NewEmail(e.Value)
+			default:
+				continue
+			}
+			if err != nil {
+				rejected = append(rejected, fmt.Errorf("%s: %v", r.Name, err))
+				continue
+			}
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			ids = append(ids, id)
+			owners = append(owners, i)
+			count[i]++
+		}
+	}
+
+	contacts := make(chan importedContact)
+	go func() {
+		defer close(contacts)
+		derived := make([][]*contact, len(ids))
+		pending := append([]int(nil), count...)
+		for res := range deriveBatch(ctx, u, ids, 0) {
+			derived[res.index] = res.candidates
+			i := owners[res.index]
+			if pending[i]--; pending[i] > 0 {
+				continue
+			}
+			// Candidates of the person, in the order their identifiers are listed
+			var candidates []*contact
+			for _, c := range derived[first[i] : first[i]+count[i]] {
+				candidates = append(candidates, c...)
+			}
+			if len(candidates) == 0 {
+				continue
+			}
+			select {
+			case contacts <- importedContact{name: records[i].Name, contact: candidates[0], candidates: candidates}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return contacts, rejected
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+
+	"github.com/nmohnblatt/cd_client/addressbook"
+)
+
+// Collect the contacts processed from records, sorted by name as they arrive in any order
+func importContacts(u *user, records []addressbook.Record) ([]importedContact, []error) {
+	ch, rejected := processContacts(context.Background(), u, records)
+	var contacts []importedContact
+	for c := range ch {
+		contacts = append(contacts, c)
+	}
+	sort.Slice(contacts, func(i, j int) bool { return contacts[i].name < contacts[j].name })
+	return contacts, rejected
+}
+
+func TestImportContacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cd_client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "contacts.vcf")
+	vcards := "BEGIN:VCARD\nVERSION:3.0\nFN:Bob\nTEL;TYPE=cell:07222 222222\nTEL:07111111111\nEND:VCARD\n" +
+		"BEGIN:VCARD\nVERSION:3.0\nFN:Charlie\nTEL:07333333333\nTEL:+44 7222-222-222\nTEL:0800 123 4567\nEND:VCARD\n" +
+		"BEGIN:VCARD\nVERSION:3.0\nFN:Broken\nTEL:07444444444\n"
+	if err := ioutil.WriteFile(path, []byte(vcards), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := readAddressBook(path, nil)
+	if errs, ok := err.(addressbook.Errors); !ok || len(errs) != 1 {
+		t.Fatalf("Expected one error for the broken card, got %v", err)
+	}
+
+	s1 := newDummyServer(1)
+	alice := testUser(t, "Alice", "07111111111")
+	alice.obtainPrivateKeys(s1)
+	bob := testUser(t, "Bob", "07222222222")
+	bob.obtainPrivateKeys(s1)
+
+	// Alice's own number is skipped, Bob's number is processed once and Charlie's toll free
+	// number is rejected
+	contacts, rejected := importContacts(alice, records)
+	if len(rejected) != 1 {
+		t.Errorf("Expected the toll free number to be rejected, got %v", rejected)
+	}
+	if len(contacts) != 2 || contacts[0].name != "Bob" || contacts[1].name != "Charlie" {
+		t.Fatalf("Wrong contacts: %v", contacts)
+	}
+	if string(contacts[0].meetingPoint) != string(newContact(bob, alice.id).meetingPoint) {
+		t.Errorf("Imported contact does not meet Bob")
+	}
+
+	// CSV exports give the same contacts
+	path = filepath.Join(dir, "contacts.csv")
+	rows := "Name,Mobile,Phone\nBob,07222 222222,07111111111\nCharlie,07333333333,07222-222-222\n"
+	if err := ioutil.WriteFile(path, []byte(rows), 0644); err != nil {
+		t.Fatal(err)
+	}
+	records, err = readAddressBook(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if csvContacts, _ := importContacts(alice, records); len(csvContacts) != 2 || csvContacts[1].id != contacts[1].id {
+		t.Errorf("Wrong contacts from CSV: %v", csvContacts)
+	}
+
+	// Columns that are not detected are read with a mapping
+	path = filepath.Join(dir, "contacts-fr.csv")
+	rows = "Nom,Portable\nCharlie,07333333333\n"
+	if err := ioutil.WriteFile(path, []byte(rows), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readAddressBook(path, nil); err == nil {
+		t.Errorf("Detected columns in a file without known headers")
+	}
+	mapping, err := addressbook.ParseCSVMapping("name=Nom;phone=Portable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records, err = readAddressBook(path, mapping); err != nil {
+		t.Fatal(err)
+	}
+	if mapped, _ := importContacts(alice, records); len(mapped) != 1 || mapped[0].name != "Charlie" || mapped[0].id != contacts[1].id {
+		t.Errorf("Wrong contacts from mapped CSV: %v", mapped)
+	}
+
+	if _, err := readAddressBook(filepath.Join(dir, "contacts.txt"), nil); err == nil {
+		t.Errorf("Read an address book in an unknown format")
+	}
+}
+
+func TestImportContactsCancelled(t *testing.T) {
+	s1 := newDummyServer(1)
+	alice := testUser(t, "Alice", "07111111111")
+	alice.obtainPrivateKeys(s1)
+	// More people than can be in progress across the workers when cancelling
+	n := 2*runtime.GOMAXPROCS(0) + 4
+	var records []addressbook.Record
+	for i := 0; i < n; i++ {
+		number := fmt.Sprintf("07700 900%03d", i)
+		records = append(records, addressbook.Record{Name: number, Entries: []addressbook.Entry{{Kind: addressbook.Phone, Value: number}}})
+	}
+
+	// People are sent as soon as they are processed, and the rest is dropped once cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	contacts, _ := processContacts(ctx, alice, records)
+	if _, ok := <-contacts; !ok {
+		t.Fatal("No contact received before cancelling")
+	}
+	cancel()
+	received := 1
+	for range contacts {
+		received++
+	}
+	if received == n {
+		t.Errorf("Processed every contact after cancelling")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/nmohnblatt/cd_client/ibe"
+	"github.com/nmohnblatt/cd_client/identifier"
+)
+
+// Encrypt an invitation to a contact's identifier under the servers' group public key.
+// The contact does not need to have created a meeting point (or even fetched their keys) yet:
+// once they obtain sk1 they can open the invitation and compute the meeting point with us.
+func createInvitation(u *user, contact identifier.Identifier, note []byte) ([]byte, error) {
+	if u.groupKey1 == nil {
+		return nil, errors.New("invitation: group public key unknown, fetch private keys first")
+	}
+
+	// Plaintext format: len(sender) || sender || note
+	sender := u.id.String()
+	plaintext := make([]byte, 2, 2+len(sender)+len(note))
+	binary.BigEndian.PutUint16(plaintext, uint16(len(sender)))
+	plaintext = append(plaintext, sender...)
+	plaintext = append(plaintext, note...)
+
+	ct, err := ibe.Encrypt(suite, u.groupKey1, contact.Bytes(), plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return ct.MarshalBinary()
+}
+
+// Decrypt an invitation addressed to any of the user's identifiers. Returns the sender's
+// identifier and the attached note.
+func openInvitation(u *user, invitation []byte) (identifier.Identifier, []byte, error) {
+	var sender identifier.Identifier
+	if u.sk1 == nil {
+		return sender, nil, errors.New("invitation: private key unknown, fetch private keys first")
+	}
+
+	ct, err := ibe.UnmarshalCiphertext(suite.G2(), invitation)
+	if err != nil {
+		return sender, nil, err
+	}
+	var plaintext []byte
+	for _, r := range u.registrations {
+		if plaintext, err = ibe.Decrypt(suite, r.sk1, r.id.Bytes(), ct); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return sender, nil, err
+	}
+
+	if len(plaintext) < 2 {
+		return sender, nil, errors.New("invitation: malformed plaintext")
+	}
+	n := int(binary.BigEndian.Uint16(plaintext))
+	if len(plaintext) < 2+n {
+		return sender, nil, errors.New("invitation: malformed plaintext")
+	}
+	if sender, err = identifier.Parse(string(plaintext[2:2+n]), ""); err != nil {
+		return sender, nil, err
+	}
+
+	return sender, plaintext[2+n:], nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"go.dedis.ch/kyber/v3/util/random"
+)
+
+func TestInvitation(t *testing.T) {
+	n := 10
+	thr := n/2 + 1
+
+	secret := suite.GT().Scalar().Pick(random.New())
+	serverList, pubPoly1, pubPoly2 := setupThresholdServers(suite, secret, n, thr)
+
+	alice := testUser(t, "Alice", "07111111111")
+	bob := testUser(t, "Bob", "07222222222")
+	charlie := testUser(t, "Charlie", "07333333333")
+
+	if err := alice.obtainPrivateKeysBlindThreshold(suite, serverList[:thr], pubPoly1, pubPoly2, thr, n); err != nil {
+		t.Fatal(err)
+	}
+
+	// Alice invites Bob before Bob has obtained any keys
+	note := []byte("Let's meet")
+	invitation, err := createInvitation(alice, bob.id, note)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bob.obtainPrivateKeysBlindThreshold(suite, serverList[:thr], pubPoly1, pubPoly2, thr, n); err != nil {
+		t.Fatal(err)
+	}
+	if err := charlie.obtainPrivateKeysBlindThreshold(suite, serverList[:thr], pubPoly1, pubPoly2, thr, n); err != nil {
+		t.Fatal(err)
+	}
+
+	sender, test, err := openInvitation(bob, invitation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sender != alice.id {
+		t.Errorf("Wrong sender: got %s, want %s", sender, alice.id)
+	}
+	if !bytes.Equal(test, note) {
+		t.Errorf("Note does not match")
+	}
+
+	// Charlie cannot read an invitation that was addressed to Bob
+	if _, _, err := openInvitation(charlie, invitation); err == nil {
+		t.Errorf("Charlie opened an invitation addressed to Bob")
+	}
+}
@@ -1,13 +1,34 @@
 package main
 
 import (
-	"crypto/sha256"
 	"fmt"
 
+	"github.com/nmohnblatt/cd_client/cid"
+	"github.com/nmohnblatt/cd_client/keyschedule"
+	"github.com/nmohnblatt/cd_client/rendezvous"
 	"go.dedis.ch/kyber/v3"
 )
 
 func createMeetingPoint(u *user, sharedAB, sharedBA kyber.Point) []byte {
+	return newKeySchedule(sharedAB, sharedBA).MeetingPoint()
+}
+
+// Express the meeting point with a contact as the CIDv1 string of the confirmation envelope we
+// published there, computed as ipfs add and the mutable file system of the daemon assign it.
+// The contact can fetch our envelope by this CID and verify it with cid.Verify.
+func meetingPointCID(store rendezvous.Rendezvous, c *contact) (string, error) {
+	post, err := store.Get(meetingPointID(store, c), recordName(c, recordConfirmation, c.local.id.String()))
+	if err != nil {
+		return "", err
+	}
+	return cid.String(cid.File(post)), nil
+}
+
+// Combine the two shared keys into symmetric key material. The combination does not depend on
+// the order of its arguments, so both contacts obtain the same key material. The schedule also
+// keeps the two keys in order, sharedAB being the one in which our identifier comes first, so
+// that both contacts agree on who writes first and on per-direction keys.
+func newKeySchedule(sharedAB, sharedBA kyber.Point) *keyschedule.Schedule {
 	bytesSharedAB, _ := sharedAB.MarshalBinary()
 	bytesSharedBA, _ := sharedBA.MarshalBinary()
 
@@ -16,8 +37,5 @@ func createMeetingPoint(u *user, sharedAB, sharedBA kyber.Point) []byte {
 		panic(fmt.Errorf("Could not xor bytes"))
 	}
 
-	h := sha256.New()
-	h.Write(keymaterial)
-
-	return h.Sum(nil)
+	return keyschedule.NewDirectional(keymaterial, bytesSharedAB, bytesSharedBA)
 }
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/nmohnblatt/cd_client/cid"
+	"github.com/nmohnblatt/cd_client/ipfsapi"
+	"github.com/nmohnblatt/cd_client/ipfsapi/ipfstest"
+	"github.com/nmohnblatt/cd_client/rendezvous"
+)
+
+func TestMeetingPointCID(t *testing.T) {
+	s := ipfstest.NewServer()
+	defer s.Close()
+	store := rendezvous.NewIPFS(s.URL)
+
+	s1 := newDummyServer(1)
+	alice := testUser(t, "Alice", "07111111111")
+	alice.obtainPrivateKeys(s1)
+	c := testContact(t, alice, "07222222222")
+	if err := establishMeetingPoint(store, alice, c); err != nil {
+		t.Fatal(err)
+	}
+
+	mp, err := meetingPointCID(store, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(mp, "bafk") || strings.HasPrefix(mp, "bafkqa") {
+		t.Errorf("Meeting point is not the CID of a raw block: %s", mp)
+	}
+
+	// The daemon assigns the same CID to the envelope it stores
+	name := recordName(c, recordConfirmation, alice.id.String())
+	stored, err := ipfsapi.NewClient(s.URL).FilesStat(path.Join("/cd_client", meetingPointID(store, c), name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored != mp {
+		t.Errorf("Meeting point %s is not the CID of the published envelope %s", mp, stored)
+	}
+
+	post, err := store.Get(meetingPointID(store, c), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cid.Verify(mp, post); err != nil {
+		t.Errorf("CID does not address the published envelope: %v", err)
+	}
+}
@@ -0,0 +1,264 @@
+// Package ipfsapi is a minimal client for the HTTP RPC API of an IPFS (Kubo) daemon.
+// It covers the endpoints used to publish meeting-point content: add and cat, the mutable file
+// system (files/*), IPNS (name/*) and pubsub.
+package ipfsapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nmohnblatt/cd_client/cid"
+)
+
+// DefaultURL is the address of the API of a local daemon started with "ipfs daemon"
+const DefaultURL = "http://127.0.0.1:5001"
+
+// Timeout bounds every call to the daemon, response included. Routing calls walk the DHT,
+// which takes up to a minute on a busy network. Subscriptions are bounded by their context.
+const Timeout = 2 * time.Minute
+
+// Client talks to the HTTP RPC API of an IPFS daemon
+type Client struct {
+	url    string
+	http   *http.Client
+	stream *http.Client
+}
+
+// NewClient returns a client for the API served at apiURL (DefaultURL if empty)
+func NewClient(apiURL string) *Client {
+	if apiURL == "" {
+		apiURL = DefaultURL
+	}
+	return &Client{url: strings.TrimRight(apiURL, "/"), http: &http.Client{Timeout: Timeout}, stream: &http.Client{}}
+}
+
+// Error is an error reported by the daemon
+type Error struct {
+	Message string
+	Code    int
+}
+
+func (e *Error) Error() string {
+	return "ipfsapi: " + e.Message
+}
+
+// IsNotFound reports whether err is the daemon's error for a missing file or path
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && (strings.Contains(e.Message, "does not exist") || strings.Contains(e.Message, "not found"))
+}
+
+// Add adds data to the node and returns its CID (version 1). The CID returned by the daemon
+// is checked against the one computed locally.
+func (c *Client) Add(data []byte) (string, error) {
+	var out struct {
+		Hash string
+	}
+	params := url.Values{"cid-version": {"1"}, "pin": {"true"}}
+	if err := c.callJSON("add", params, data, &out); err != nil {
+		return "", err
+	}
+	if want := cid.String(cid.File(data)); out.Hash != want {
+		return "", &Error{Message: "add returned CID " + out.Hash + ", expected " + want}
+	}
+	return out.Hash, nil
+}
+
+// Cat returns the content addressed by an IPFS path or CID
+func (c *Client) Cat(path string) ([]byte, error) {
+	return c.callRaw("cat", url.Values{"arg": {path}}, nil)
+}
+
+// CatVerified returns the content addressed by a CID after checking it matches the CID
+func (c *Client) CatVerified(contentID string) ([]byte, error) {
+	data, err := c.Cat("/ipfs/" + contentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := cid.Verify(contentID, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// FilesWrite creates or replaces a file of the mutable file system, creating parent directories.
+// Files use CIDv1 with raw leaves, like Add, so their CID can be computed locally.
+func (c *Client) FilesWrite(path string, data []byte) error {
+	params := url.Values{"arg": {path}, "create": {"true"}, "parents": {"true"}, "truncate": {"true"}, "cid-version": {"1"}}
+	_, err := c.callRaw("files/write", params, data)
+	return err
+}
+
+// FilesRead returns the content of a file of the mutable file system
+func (c *Client) FilesRead(path string) ([]byte, error) {
+	return c.callRaw("files/read", url.Values{"arg": {path}}, nil)
+}
+
+// FilesLs returns the names of the entries of a directory of the mutable file system
+func (c *Client) FilesLs(path string) ([]string, error) {
+	var out struct {
+		Entries []struct {
+			Name string
+		}
+	}
+	if err := c.callJSON("files/ls", url.Values{"arg": {path}}, nil, &out); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(out.Entries))
+	for i, e := range out.Entries {
+		names[i] = e.Name
+	}
+	return names, nil
+}
+
+// FilesRm removes a file or directory of the mutable file system
+func (c *Client) FilesRm(path string) error {
+	_, err := c.callRaw("files/rm", url.Values{"arg": {path}, "recursive": {"true"}}, nil)
+	return err
+}
+
+// FilesStat returns the CID of a file or directory of the mutable file system
+func (c *Client) FilesStat(path string) (string, error) {
+	var out struct {
+		Hash string
+	}
+	if err := c.callJSON("files/stat", url.Values{"arg": {path}}, nil, &out); err != nil {
+		return "", err
+	}
+	return out.Hash, nil
+}
+
+// NamePublish publishes an IPFS path under the IPNS name of the given key ("self" if empty)
+// and returns that name
+func (c *Client) NamePublish(path, key string) (string, error) {
+	if key == "" {
+		key = "self"
+	}
+	var out struct {
+		Name string
+	}
+	if err := c.callJSON("name/publish", url.Values{"arg": {path}, "key": {key}}, nil, &out); err != nil {
+		return "", err
+	}
+	return out.Name, nil
+}
+
+// NameResolve returns the IPFS path an IPNS name points to
+func (c *Client) NameResolve(name string) (string, error) {
+	var out struct {
+		Path string
+	}
+	if err := c.callJSON("name/resolve", url.Values{"arg": {name}}, nil, &out); err != nil {
+		return "", err
+	}
+	return out.Path, nil
+}
+
+// Link is an entry of an IPFS directory
+type Link struct {
+	Name string
+	Hash string
+}
+
+// Ls returns the links of an IPFS directory, e.g. /ipfs/<cid>
+func (c *Client) Ls(path string) ([]Link, error) {
+	var out struct {
+		Objects []struct {
+			Links []Link
+		}
+	}
+	if err := c.callJSON("ls", url.Values{"arg": {path}}, nil, &out); err != nil {
+		return nil, err
+	}
+
+	var links []Link
+	for _, o := range out.Objects {
+		links = append(links, o.Links...)
+	}
+	return links, nil
+}
+
+// RoutingPut stores a record under key (e.g. a signed IPNS record under /ipns/<name>)
+func (c *Client) RoutingPut(key string, record []byte) error {
+	_, err := c.callRaw("routing/put", url.Values{"arg": {key}, "allow-offline": {"true"}}, record)
+	return err
+}
+
+// RoutingGet returns the record stored under key
+func (c *Client) RoutingGet(key string) ([]byte, error) {
+	return c.callRaw("routing/get", url.Values{"arg": {key}}, nil)
+}
+
+// Send a request and return the raw response body
+func (c *Client) callRaw(endpoint string, params url.Values, data []byte) ([]byte, error) {
+	resp, err := c.post(endpoint, params, data)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// Send a request and decode its JSON response into out
+func (c *Client) callJSON(endpoint string, params url.Values, data []byte, out interface{}) error {
+	resp, err := c.post(endpoint, params, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Every RPC is a POST. When data is not nil it is sent as a multipart file.
+func (c *Client) post(endpoint string, params url.Values, data []byte) (*http.Response, error) {
+	var body io.Reader
+	contentType := ""
+	if data != nil {
+		buf := new(bytes.Buffer)
+		w := multipart.NewWriter(buf)
+		part, err := w.CreateFormFile("file", "data")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := part.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		body, contentType = buf, w.FormDataContentType()
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.url+"/api/v0/"+endpoint+"?"+params.Encode(), body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		e := &Error{}
+		if err := json.NewDecoder(resp.Body).Decode(e); err != nil || e.Message == "" {
+			e.Message = fmt.Sprintf("%s returned status %s", endpoint, resp.Status)
+		}
+		return nil, e
+	}
+	return resp, nil
+}
@@ -0,0 +1,210 @@
+package ipfsapi
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nmohnblatt/cd_client/cid"
+	"github.com/nmohnblatt/cd_client/ipfsapi/ipfstest"
+)
+
+func TestAddCat(t *testing.T) {
+	s := ipfstest.NewServer()
+	defer s.Close()
+	c := NewClient(s.URL)
+
+	data := []byte("meeting point content")
+	contentID, err := c.Add(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentID != cid.String(cid.File(data)) {
+		t.Errorf("Add returned %s, expected the locally computed CID", contentID)
+	}
+	test, err := c.CatVerified(contentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(test, data) {
+		t.Errorf("Cat returned the wrong content")
+	}
+	if _, err := c.Cat("bafkmissing"); err == nil {
+		t.Errorf("Cat of missing content succeeded")
+	}
+}
+
+func TestFiles(t *testing.T) {
+	s := ipfstest.NewServer()
+	defer s.Close()
+	c := NewClient(s.URL)
+
+	if _, err := c.FilesRead("/cd_client/mp/a"); !IsNotFound(err) {
+		t.Errorf("Read of a missing file: got %v, want not found", err)
+	}
+
+	if err := c.FilesWrite("/cd_client/mp/a", []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.FilesWrite("/cd_client/mp/b", []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.FilesWrite("/cd_client/mp/a", []byte("replaced")); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := c.FilesRead("/cd_client/mp/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte("replaced")) {
+		t.Errorf("File was not replaced: %s", data)
+	}
+
+	names, err := c.FilesLs("/cd_client/mp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Errorf("Wrong listing: %v", names)
+	}
+	if _, err := c.FilesStat("/cd_client/mp"); err != nil {
+		t.Errorf("Stat of a directory failed: %s", err)
+	}
+
+	if err := c.FilesRm("/cd_client/mp/a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.FilesRm("/cd_client/mp/a"); !IsNotFound(err) {
+		t.Errorf("Removal of a missing file: got %v, want not found", err)
+	}
+}
+
+func TestName(t *testing.T) {
+	s := ipfstest.NewServer()
+	defer s.Close()
+	c := NewClient(s.URL)
+
+	contentID, err := c.Add([]byte("record"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := c.NamePublish("/ipfs/"+contentID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := c.NameResolve("/ipns/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != "/ipfs/"+contentID {
+		t.Errorf("Name resolved to %s, want /ipfs/%s", p, contentID)
+	}
+}
+
+func TestPubsub(t *testing.T) {
+	s := ipfstest.NewServer()
+	defer s.Close()
+	c := NewClient(s.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	topic := "cd_client/test"
+	messages, err := c.PubsubSub(ctx, topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for s.Subscribers(topic) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	data := []byte{0, 1, 2, 0xff}
+	if err := c.PubsubPub(topic, data); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case msg := <-messages:
+		if !bytes.Equal(msg.Data, data) {
+			t.Errorf("Received %x, want %x", msg.Data, data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No message received")
+	}
+
+	cancel()
+	for range messages {
+	}
+}
+
+func TestTopicEncoding(t *testing.T) {
+	topic := "a topic/with?special&characters"
+	test, err := DecodeTopic(EncodeTopic(topic))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if test != topic {
+		t.Errorf("Topic was not recovered: %s", test)
+	}
+}
+
+func TestPeersShareContent(t *testing.T) {
+	s := ipfstest.NewServer()
+	defer s.Close()
+	peer := s.NewPeer()
+	defer peer.Close()
+	c1, c2 := NewClient(s.URL), NewClient(peer.URL)
+
+	if err := c1.FilesWrite("/dir/a", []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c2.FilesRead("/dir/a"); !IsNotFound(err) {
+		t.Errorf("Mutable file systems of two peers should be separate")
+	}
+
+	dir, err := c1.FilesStat("/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	links, err := c2.Ls("/ipfs/" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 || links[0].Name != "a" {
+		t.Fatalf("Wrong listing: %v", links)
+	}
+	if _, err := c2.CatVerified(links[0].Hash); err != nil {
+		t.Errorf("Could not fetch the file by CID: %s", err)
+	}
+	data, err := c2.Cat("/ipfs/" + dir + "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte("first")) {
+		t.Errorf("Cat returned the wrong content")
+	}
+}
+
+func TestRouting(t *testing.T) {
+	s := ipfstest.NewServer()
+	defer s.Close()
+	peer := s.NewPeer()
+	defer peer.Close()
+
+	if _, err := NewClient(peer.URL).RoutingGet("/ipns/k51name"); err == nil {
+		t.Errorf("Got a record that was never put")
+	}
+	if err := NewClient(s.URL).RoutingPut("/ipns/k51name", []byte("record")); err != nil {
+		t.Fatal(err)
+	}
+	record, err := NewClient(peer.URL).RoutingGet("/ipns/k51name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(record, []byte("record")) {
+		t.Errorf("Wrong record: %s", record)
+	}
+}
@@ -0,0 +1,433 @@
+// Package ipfstest provides an in-process fake of the IPFS HTTP RPC API, for tests of code
+// that talks to a daemon through package ipfsapi.
+// Several fake daemons can be connected to the same network: each has its own mutable file
+// system, while content, routing records and pubsub messages are shared.
+package ipfstest
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nmohnblatt/cd_client/cid"
+)
+
+// Server emulates the endpoints of a daemon used by package ipfsapi
+type Server struct {
+	*httptest.Server
+	*network
+
+	files map[string][]byte
+}
+
+// State shared by every daemon connected to the same network
+type network struct {
+	mu      sync.Mutex
+	blocks  map[string][]byte
+	dirs    map[string]map[string][]byte
+	records map[string][]byte
+	names   map[string]string
+	subs    map[string]map[chan message]bool
+}
+
+type message struct {
+	From string `json:"from"`
+	Data string `json:"data"`
+}
+
+// NewServer starts a fake daemon on a new network. Its API address is s.URL. Call Close when done.
+func NewServer() *Server {
+	return newServer(&network{
+		blocks:  map[string][]byte{},
+		dirs:    map[string]map[string][]byte{},
+		records: map[string][]byte{},
+		names:   map[string]string{},
+		subs:    map[string]map[chan message]bool{},
+	})
+}
+
+// NewPeer starts another fake daemon connected to the same network as s
+func (s *Server) NewPeer() *Server {
+	return newServer(s.network)
+}
+
+func newServer(n *network) *Server {
+	s := &Server{network: n, files: map[string][]byte{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v0/add", s.add)
+	mux.HandleFunc("/api/v0/cat", s.cat)
+	mux.HandleFunc("/api/v0/ls", s.ls)
+	mux.HandleFunc("/api/v0/files/write", s.filesWrite)
+	mux.HandleFunc("/api/v0/files/read", s.filesRead)
+	mux.HandleFunc("/api/v0/files/ls", s.filesLs)
+	mux.HandleFunc("/api/v0/files/rm", s.filesRm)
+	mux.HandleFunc("/api/v0/files/stat", s.filesStat)
+	mux.HandleFunc("/api/v0/name/publish", s.namePublish)
+	mux.HandleFunc("/api/v0/name/resolve", s.nameResolve)
+	mux.HandleFunc("/api/v0/routing/put", s.routingPut)
+	mux.HandleFunc("/api/v0/routing/get", s.routingGet)
+	mux.HandleFunc("/api/v0/pubsub/pub", s.pubsubPub)
+	mux.HandleFunc("/api/v0/pubsub/sub", s.pubsubSub)
+	s.Server = httptest.NewServer(postOnly(mux))
+
+	return s
+}
+
+// The real daemon rejects GET requests on its RPC API
+func postOnly(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "405 - Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func writeError(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(map[string]interface{}{"Message": msg, "Code": 0, "Type": "error"})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func readFile(r *http.Request) ([]byte, bool) {
+	f, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	return data, err == nil
+}
+
+// Files get the CID a real daemon would assign. Directories get a fake, unique identifier.
+func fileCID(data []byte) string {
+	return cid.String(cid.File(data))
+}
+
+func (s *Server) add(w http.ResponseWriter, r *http.Request) {
+	data, ok := readFile(r)
+	if !ok {
+		writeError(w, "file argument 'path' is required")
+		return
+	}
+	c := fileCID(data)
+
+	s.mu.Lock()
+	s.blocks[c] = data
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]interface{}{"Name": c, "Hash": c, "Size": len(data)})
+}
+
+func (s *Server) cat(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Query().Get("arg"), "/ipfs/"), "/", 2)
+
+	s.mu.Lock()
+	data, ok := s.blocks[parts[0]]
+	if len(parts) == 2 {
+		data, ok = s.dirs[parts[0]][parts[1]]
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, "block was not found locally (offline): ipld: could not find "+parts[0])
+		return
+	}
+	w.Write(data)
+}
+
+func (s *Server) ls(w http.ResponseWriter, r *http.Request) {
+	dirID := strings.TrimPrefix(r.URL.Query().Get("arg"), "/ipfs/")
+
+	s.mu.Lock()
+	dir, ok := s.dirs[dirID]
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, "block was not found locally (offline): ipld: could not find "+dirID)
+		return
+	}
+	var names []string
+	for name := range dir {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	links := make([]map[string]interface{}, len(names))
+	for i, name := range names {
+		links[i] = map[string]interface{}{"Name": name, "Hash": fileCID(dir[name]), "Size": len(dir[name]), "Type": 2}
+	}
+	writeJSON(w, map[string]interface{}{"Objects": []interface{}{map[string]interface{}{"Hash": dirID, "Links": links}}})
+}
+
+func (s *Server) filesWrite(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	p := path.Clean(q.Get("arg"))
+	data, ok := readFile(r)
+	if !ok {
+		writeError(w, "file argument 'data' is required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.files[p]; !exists && q.Get("create") != "true" {
+		writeError(w, "file does not exist")
+		return
+	}
+	if !s.dirExists(path.Dir(p)) && q.Get("parents") != "true" {
+		writeError(w, "file does not exist")
+		return
+	}
+	s.files[p] = data
+	s.blocks[fileCID(data)] = data
+}
+
+func (s *Server) filesRead(w http.ResponseWriter, r *http.Request) {
+	p := path.Clean(r.URL.Query().Get("arg"))
+
+	s.mu.Lock()
+	data, ok := s.files[p]
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, "file does not exist")
+		return
+	}
+	w.Write(data)
+}
+
+func (s *Server) filesLs(w http.ResponseWriter, r *http.Request) {
+	dir := path.Clean(r.URL.Query().Get("arg"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirExists(dir) {
+		writeError(w, "file does not exist")
+		return
+	}
+
+	seen := map[string]bool{}
+	for p := range s.files {
+		if rel := strings.TrimPrefix(p, strings.TrimRight(dir, "/")+"/"); rel != p {
+			seen[strings.SplitN(rel, "/", 2)[0]] = true
+		}
+	}
+	var names []string
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entries := make([]map[string]interface{}, len(names))
+	for i, name := range names {
+		entries[i] = map[string]interface{}{"Name": name, "Type": 0, "Size": 0, "Hash": ""}
+	}
+	writeJSON(w, map[string]interface{}{"Entries": entries})
+}
+
+func (s *Server) filesRm(w http.ResponseWriter, r *http.Request) {
+	p := path.Clean(r.URL.Query().Get("arg"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.files[p]; ok {
+		delete(s.files, p)
+		return
+	}
+	if !s.dirExists(p) {
+		writeError(w, "file does not exist")
+		return
+	}
+	for f := range s.files {
+		if strings.HasPrefix(f, p+"/") {
+			delete(s.files, f)
+		}
+	}
+}
+
+func (s *Server) filesStat(w http.ResponseWriter, r *http.Request) {
+	p := path.Clean(r.URL.Query().Get("arg"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if data, ok := s.files[p]; ok {
+		writeJSON(w, map[string]interface{}{"Hash": fileCID(data), "Size": len(data), "Type": "file"})
+		return
+	}
+	if !s.dirExists(p) {
+		writeError(w, "file does not exist")
+		return
+	}
+
+	// Snapshot the directory so that its content can be fetched by CID from any peer
+	dir := map[string][]byte{}
+	var names []string
+	for f, data := range s.files {
+		if rel := strings.TrimPrefix(f, p+"/"); rel != f && !strings.Contains(rel, "/") {
+			dir[rel] = data
+			names = append(names, rel)
+		}
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		h.Write([]byte(name))
+		h.Write(dir[name])
+	}
+	dirID := "bafyfake" + hex.EncodeToString(h.Sum(nil))
+	s.dirs[dirID] = dir
+
+	writeJSON(w, map[string]interface{}{"Hash": dirID, "Size": 0, "Type": "directory"})
+}
+
+// Directories of the fake only exist while they contain files
+func (s *Server) dirExists(dir string) bool {
+	if dir == "/" {
+		return true
+	}
+	for p := range s.files {
+		if strings.HasPrefix(p, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) namePublish(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	name := "k51fake" + q.Get("key")
+
+	s.mu.Lock()
+	s.names[name] = q.Get("arg")
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]string{"Name": name, "Value": q.Get("arg")})
+}
+
+func (s *Server) nameResolve(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Query().Get("arg"), "/ipns/")
+
+	s.mu.Lock()
+	p, ok := s.names[name]
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, "could not resolve name")
+		return
+	}
+	writeJSON(w, map[string]string{"Path": p})
+}
+
+func (s *Server) routingPut(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("arg")
+	data, ok := readFile(r)
+	if !ok {
+		writeError(w, "argument \"value-file\" is required")
+		return
+	}
+
+	s.mu.Lock()
+	s.records[key] = data
+	s.mu.Unlock()
+}
+
+func (s *Server) routingGet(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("arg")
+
+	s.mu.Lock()
+	data, ok := s.records[key]
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, "routing: not found")
+		return
+	}
+	w.Write(data)
+}
+
+func (s *Server) pubsubPub(w http.ResponseWriter, r *http.Request) {
+	topic := r.URL.Query().Get("arg")
+	data, ok := readFile(r)
+	if !ok {
+		writeError(w, "argument \"data\" is required")
+		return
+	}
+	msg := message{From: "12D3KooWFake", Data: "u" + base64URL(data)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.subs[topic] {
+		select {
+		case ch <- msg:
+		default:
+			// Pubsub is best effort: slow subscribers lose messages
+		}
+	}
+}
+
+func (s *Server) pubsubSub(w http.ResponseWriter, r *http.Request) {
+	topic := r.URL.Query().Get("arg")
+	ch := make(chan message, 64)
+
+	s.mu.Lock()
+	if s.subs[topic] == nil {
+		s.subs[topic] = map[chan message]bool{}
+	}
+	s.subs[topic][ch] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.subs[topic], ch)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case msg := <-ch:
+			if err := enc.Encode(msg); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// Subscribers returns the number of active subscriptions to a topic, given in clear
+func (s *Server) Subscribers(topic string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subs["u"+base64URL([]byte(topic))])
+}
+
+func base64URL(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
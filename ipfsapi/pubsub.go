@@ -0,0 +1,89 @@
+package ipfsapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Message is a message received on a pubsub topic
+type Message struct {
+	From string
+	Data []byte
+}
+
+// PubsubPub publishes data on a topic
+func (c *Client) PubsubPub(topic string, data []byte) error {
+	_, err := c.callRaw("pubsub/pub", url.Values{"arg": {EncodeTopic(topic)}}, data)
+	return err
+}
+
+// PubsubSub subscribes to a topic. Messages are delivered on the returned channel, which is
+// closed when ctx is cancelled or the connection to the daemon ends.
+func (c *Client) PubsubSub(ctx context.Context, topic string) (<-chan Message, error) {
+	req, err := http.NewRequest(http.MethodPost, c.url+"/api/v0/pubsub/sub?"+url.Values{"arg": {EncodeTopic(topic)}}.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.stream.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &Error{Message: "pubsub/sub returned status " + resp.Status}
+	}
+
+	messages := make(chan Message)
+	go func() {
+		defer close(messages)
+		defer resp.Body.Close()
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var raw struct {
+				From string `json:"from"`
+				Data string `json:"data"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &raw); err != nil {
+				continue
+			}
+			data, err := decodeMultibase(raw.Data)
+			if err != nil {
+				continue
+			}
+			select {
+			case messages <- Message{From: raw.From, Data: data}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return messages, nil
+}
+
+// EncodeTopic encodes a topic name the way the pubsub API expects it (base64url multibase)
+func EncodeTopic(topic string) string {
+	return "u" + base64.RawURLEncoding.EncodeToString([]byte(topic))
+}
+
+// DecodeTopic reverses EncodeTopic
+func DecodeTopic(encoded string) (string, error) {
+	topic, err := decodeMultibase(encoded)
+	return string(topic), err
+}
+
+// Topics and message data are base64url multibase strings since Kubo v0.11
+func decodeMultibase(s string) ([]byte, error) {
+	if !strings.HasPrefix(s, "u") {
+		return nil, errors.New("ipfsapi: unsupported multibase encoding")
+	}
+	return base64.RawURLEncoding.DecodeString(s[1:])
+}
@@ -0,0 +1,211 @@
+// Package ipns computes IPNS names and signs IPNS records locally, without a daemon.
+// Names are libp2p peer IDs of Ed25519 keys encoded as CIDv1 (libp2p-key codec, base36).
+// Records follow the IPNS record specification and carry both the V1 signature and the
+// V2 signature over their DAG-CBOR data.
+package ipns
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"time"
+
+	"github.com/nmohnblatt/cd_client/cid"
+)
+
+// Record is the content of an IPNS record
+type Record struct {
+	// IPFS path the name points to, e.g. /ipfs/bafy...
+	Value string
+	// Records with a higher sequence number replace those with a lower one
+	Sequence uint64
+	// End of validity of the record
+	EOL time.Time
+	// How long resolvers may cache the record
+	TTL time.Duration
+}
+
+const signaturePrefix = "ipns-signature:"
+
+// Protobuf field numbers of IpnsEntry
+const (
+	fieldValue        = 1
+	fieldSignatureV1  = 2
+	fieldValidityType = 3
+	fieldValidity     = 4
+	fieldSequence     = 5
+	fieldTTL          = 6
+	fieldSignatureV2  = 8
+	fieldData         = 9
+)
+
+// ErrExpired is returned by Verify for records past their end of validity
+var ErrExpired = errors.New("ipns: record expired")
+
+// PeerID returns the binary libp2p peer ID of an Ed25519 public key
+func PeerID(pub ed25519.PublicKey) []byte {
+	// Public keys are small enough to be inlined in an identity multihash
+	return cid.Multihash(cid.Identity, marshalPublicKey(pub))
+}
+
+// Name returns the IPNS name of an Ed25519 public key
+func Name(pub ed25519.PublicKey) string {
+	return cid.Base36(cid.NewV1(cid.Libp2pKey, PeerID(pub)))
+}
+
+// Sign creates an IPNS record signed with priv
+func Sign(priv ed25519.PrivateKey, r *Record) ([]byte, error) {
+	if r.Value == "" {
+		return nil, errors.New("ipns: empty value")
+	}
+	validity := []byte(r.EOL.UTC().Format(time.RFC3339Nano))
+	data := cborData(r, validity)
+
+	sigV1 := ed25519.Sign(priv, append(append([]byte(r.Value), validity...), "EOL"...))
+	sigV2 := ed25519.Sign(priv, append([]byte(signaturePrefix), data...))
+
+	var buf []byte
+	buf = appendBytes(buf, fieldValue, []byte(r.Value))
+	buf = appendBytes(buf, fieldSignatureV1, sigV1)
+	buf = appendVarint(buf, fieldValidityType, 0)
+	buf = appendBytes(buf, fieldValidity, validity)
+	buf = appendVarint(buf, fieldSequence, r.Sequence)
+	buf = appendVarint(buf, fieldTTL, uint64(r.TTL))
+	buf = appendBytes(buf, fieldSignatureV2, sigV2)
+	buf = appendBytes(buf, fieldData, data)
+
+	return buf, nil
+}
+
+// Verify checks the V2 signature of a record against pub and returns its content
+func Verify(pub ed25519.PublicKey, record []byte) (*Record, error) {
+	fields, err := parseFields(record)
+	if err != nil {
+		return nil, err
+	}
+	data := fields[fieldData].bytes
+	if !ed25519.Verify(pub, append([]byte(signaturePrefix), data...), fields[fieldSignatureV2].bytes) {
+		return nil, errors.New("ipns: invalid signature")
+	}
+	if fields[fieldValidityType].varint != 0 {
+		return nil, errors.New("ipns: unsupported validity type")
+	}
+
+	eol, err := time.Parse(time.RFC3339Nano, string(fields[fieldValidity].bytes))
+	if err != nil {
+		return nil, err
+	}
+	r := &Record{
+		Value:    string(fields[fieldValue].bytes),
+		Sequence: fields[fieldSequence].varint,
+		EOL:      eol,
+		TTL:      time.Duration(fields[fieldTTL].varint),
+	}
+
+	// DAG-CBOR is canonical: the signed data must be the encoding of the protobuf fields
+	if !bytes.Equal(data, cborData(r, fields[fieldValidity].bytes)) {
+		return nil, errors.New("ipns: signed data does not match record")
+	}
+	if time.Now().After(eol) {
+		return r, ErrExpired
+	}
+	return r, nil
+}
+
+// libp2p PublicKey protobuf: Type = Ed25519 (1), Data = raw key
+func marshalPublicKey(pub ed25519.PublicKey) []byte {
+	var buf []byte
+	buf = appendVarint(buf, 1, 1)
+	return appendBytes(buf, 2, pub)
+}
+
+// DAG-CBOR map of the signed fields. Keys are sorted by length, then bytewise.
+func cborData(r *Record, validity []byte) []byte {
+	buf := []byte{0xa5}
+	buf = cborText(buf, "TTL")
+	buf = cborHead(buf, 0, uint64(r.TTL))
+	buf = cborText(buf, "Value")
+	buf = cborHead(buf, 2, uint64(len(r.Value)))
+	buf = append(buf, r.Value...)
+	buf = cborText(buf, "Sequence")
+	buf = cborHead(buf, 0, r.Sequence)
+	buf = cborText(buf, "Validity")
+	buf = cborHead(buf, 2, uint64(len(validity)))
+	buf = append(buf, validity...)
+	buf = cborText(buf, "ValidityType")
+	return cborHead(buf, 0, 0)
+}
+
+func cborText(buf []byte, s string) []byte {
+	return append(cborHead(buf, 3, uint64(len(s))), s...)
+}
+
+// Shortest encoding of a CBOR major type and its argument
+func cborHead(buf []byte, major byte, n uint64) []byte {
+	m := major << 5
+	switch {
+	case n < 24:
+		return append(buf, m|byte(n))
+	case n <= 0xff:
+		return append(buf, m|24, byte(n))
+	case n <= 0xffff:
+		return append(buf, m|25, byte(n>>8), byte(n))
+	case n <= 0xffffffff:
+		return append(buf, m|26, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	default:
+		buf = append(buf, m|27)
+		for i := 7; i >= 0; i-- {
+			buf = append(buf, byte(n>>(8*uint(i))))
+		}
+		return buf
+	}
+}
+
+func appendVarint(buf []byte, field int, x uint64) []byte {
+	buf = cid.PutUvarint(buf, uint64(field)<<3)
+	return cid.PutUvarint(buf, x)
+}
+
+func appendBytes(buf []byte, field int, data []byte) []byte {
+	buf = cid.PutUvarint(buf, uint64(field)<<3|2)
+	buf = cid.PutUvarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+type field struct {
+	varint uint64
+	bytes  []byte
+}
+
+// Parse a flat protobuf message made of varint and length-delimited fields
+func parseFields(buf []byte) (map[int]field, error) {
+	fields := map[int]field{}
+	for len(buf) > 0 {
+		key, n, err := cid.Uvarint(buf)
+		if err != nil {
+			return nil, err
+		}
+		buf = buf[n:]
+
+		num, wireType := int(key>>3), key&7
+		x, n, err := cid.Uvarint(buf)
+		if err != nil {
+			return nil, err
+		}
+		buf = buf[n:]
+
+		switch wireType {
+		case 0:
+			fields[num] = field{varint: x}
+		case 2:
+			if uint64(len(buf)) < x {
+				return nil, errors.New("ipns: truncated record")
+			}
+			fields[num] = field{bytes: buf[:x]}
+			buf = buf[x:]
+		default:
+			return nil, errors.New("ipns: unsupported protobuf wire type")
+		}
+	}
+	return fields, nil
+}
@@ -0,0 +1,74 @@
+package ipns
+
+import (
+	"crypto/ed25519"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testKey() ed25519.PrivateKey {
+	return ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+}
+
+func TestName(t *testing.T) {
+	pub := testKey().Public().(ed25519.PublicKey)
+	name := Name(pub)
+
+	// Every Ed25519 IPNS name in base36 starts with this prefix
+	if !strings.HasPrefix(name, "k51qzi5uqu5d") {
+		t.Errorf("Unexpected name format: %s", name)
+	}
+	if name != Name(pub) {
+		t.Errorf("Name is not deterministic")
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	priv := testKey()
+	pub := priv.Public().(ed25519.PublicKey)
+
+	want := &Record{
+		Value:    "/ipfs/bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi",
+		Sequence: 3,
+		EOL:      time.Now().Add(time.Hour).UTC(),
+		TTL:      5 * time.Minute,
+	}
+	record, err := Sign(priv, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Verify(pub, record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Value != want.Value || r.Sequence != want.Sequence || r.TTL != want.TTL || !r.EOL.Equal(want.EOL) {
+		t.Errorf("Record content was not recovered: %+v", r)
+	}
+
+	other := ed25519.NewKeyFromSeed([]byte("another 32 byte seed for testing"))
+	if _, err := Verify(other.Public().(ed25519.PublicKey), record); err == nil {
+		t.Errorf("Record verified under the wrong key")
+	}
+
+	// Changing the sequence number in the protobuf fields breaks the signed data
+	forged, err := Sign(other, &Record{Value: want.Value, Sequence: 4, EOL: want.EOL, TTL: want.TTL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(pub, forged); err == nil {
+		t.Errorf("Record signed by another key was accepted")
+	}
+}
+
+func TestExpired(t *testing.T) {
+	priv := testKey()
+	record, err := Sign(priv, &Record{Value: "/ipfs/bafy", EOL: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(priv.Public().(ed25519.PublicKey), record); err != ErrExpired {
+		t.Errorf("Expired record: got %v, want ErrExpired", err)
+	}
+}
@@ -0,0 +1,94 @@
+// Package joux implements Joux's one-round tripartite Diffie-Hellman key agreement over an
+// asymmetric pairing. Each party picks a secret a and publishes the share (a*B1, a*B2). Given
+// the shares (b*B1, b*B2) and (c*B1, c*B2) of the two others, every party computes the same
+// value e(b*B1, c*B2)^a = e(B1, B2)^(abc) in GT.
+//
+// Shares are not authenticated: callers must sign them (e.g. with package ibs).
+package joux
+
+import (
+	"crypto/cipher"
+	"errors"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/pairing"
+)
+
+// Share is the public contribution a*B1, a*B2 of a party to the key agreement
+type Share struct {
+	P1 kyber.Point
+	P2 kyber.Point
+}
+
+// Ephemeral holds the secret a of a party together with its public share
+type Ephemeral struct {
+	secret kyber.Scalar
+	Share
+}
+
+// NewEphemeral picks a fresh secret and computes the corresponding share
+func NewEphemeral(suite pairing.Suite, random cipher.Stream) *Ephemeral {
+	a := suite.G1().Scalar().Pick(random)
+	return &Ephemeral{
+		secret: a,
+		Share: Share{
+			P1: suite.G1().Point().Mul(a, nil),
+			P2: suite.G2().Point().Mul(a, nil),
+		},
+	}
+}
+
+// Check verifies that both halves of the share use the same secret, i.e. e(P1, B2) == e(B1, P2)
+func (s *Share) Check(suite pairing.Suite) error {
+	left := suite.Pair(s.P1, suite.G2().Point().Base())
+	right := suite.Pair(suite.G1().Point().Base(), s.P2)
+	if !left.Equal(right) {
+		return errors.New("joux: inconsistent share")
+	}
+	return nil
+}
+
+// MarshalBinary encodes the share as P1 || P2
+func (s *Share) MarshalBinary() ([]byte, error) {
+	p1, err := s.P1.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	p2, err := s.P2.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append(p1, p2...), nil
+}
+
+// UnmarshalShare decodes a share encoded with MarshalBinary
+func UnmarshalShare(suite pairing.Suite, data []byte) (*Share, error) {
+	size1 := suite.G1().PointLen()
+	if len(data) != size1+suite.G2().PointLen() {
+		return nil, errors.New("joux: wrong share length")
+	}
+	s := &Share{P1: suite.G1().Point(), P2: suite.G2().Point()}
+	if err := s.P1.UnmarshalBinary(data[:size1]); err != nil {
+		return nil, err
+	}
+	if err := s.P2.UnmarshalBinary(data[size1:]); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Agree computes the common secret e(B1, B2)^(abc) from our ephemeral and the shares of the
+// two other parties. The result does not depend on the order of the two shares.
+func Agree(suite pairing.Suite, e *Ephemeral, first, second *Share) (kyber.Point, error) {
+	for _, s := range []*Share{first, second} {
+		if err := s.Check(suite); err != nil {
+			return nil, err
+		}
+		if s.P1.Equal(suite.G1().Point().Null()) {
+			return nil, errors.New("joux: degenerate share")
+		}
+	}
+
+	K := suite.Pair(first.P1, second.P2)
+	return K.Mul(e.secret, K), nil
+}
@@ -0,0 +1,73 @@
+package joux
+
+import (
+	"testing"
+
+	"go.dedis.ch/kyber/v3/pairing/bn256"
+	"go.dedis.ch/kyber/v3/util/random"
+)
+
+func TestAgree(t *testing.T) {
+	suite := bn256.NewSuite()
+	a := NewEphemeral(suite, random.New())
+	b := NewEphemeral(suite, random.New())
+	c := NewEphemeral(suite, random.New())
+
+	kA, err := Agree(suite, a, &b.Share, &c.Share)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kB, err := Agree(suite, b, &c.Share, &a.Share)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kC, err := Agree(suite, c, &a.Share, &b.Share)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !kA.Equal(kB) || !kB.Equal(kC) {
+		t.Errorf("Parties did not agree on the same secret")
+	}
+
+	// Swapping the order of the shares gives the same secret
+	kA2, err := Agree(suite, a, &c.Share, &b.Share)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !kA.Equal(kA2) {
+		t.Errorf("Secret depends on the order of the shares")
+	}
+}
+
+func TestInconsistentShare(t *testing.T) {
+	suite := bn256.NewSuite()
+	a := NewEphemeral(suite, random.New())
+	b := NewEphemeral(suite, random.New())
+	c := NewEphemeral(suite, random.New())
+
+	bad := &Share{P1: b.P1, P2: c.P2}
+	if _, err := Agree(suite, a, bad, &c.Share); err == nil {
+		t.Errorf("Accepted an inconsistent share")
+	}
+}
+
+func TestMarshalShare(t *testing.T) {
+	suite := bn256.NewSuite()
+	a := NewEphemeral(suite, random.New())
+
+	buf, err := a.Share.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	test, err := UnmarshalShare(suite, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !test.P1.Equal(a.P1) || !test.P2.Equal(a.P2) {
+		t.Errorf("Share was not recovered")
+	}
+	if _, err := UnmarshalShare(suite, buf[1:]); err == nil {
+		t.Errorf("Accepted a truncated share")
+	}
+}
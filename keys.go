@@ -0,0 +1,295 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/nmohnblatt/cd_client/identifier"
+	"github.com/nmohnblatt/cd_client/keystore"
+	"github.com/nmohnblatt/cd_client/mailbox"
+	"github.com/nmohnblatt/cd_client/ratchet"
+	"github.com/nmohnblatt/cd_client/x3dh"
+	"go.dedis.ch/kyber/v3"
+)
+
+// Describe the user and their private keys for the keystore
+func (u *user) manifest() (*keystore.Manifest, error) {
+	if u.groupKey1 == nil || u.groupKey2 == nil {
+		return nil, errors.New("keystore: group public key unknown, fetch private keys first")
+	}
+	m := keystore.Manifest{Name: u.name, Region: u.region, Epoch: u.epoch}
+	for _, r := range u.registrations {
+		if r.sk1 == nil || r.sk2 == nil {
+			return nil, errors.New("keystore: private key of " + r.id.String() + " unknown, fetch private keys first")
+		}
+		sk1, err := r.sk1.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		sk2, err := r.sk2.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		m.Identities = append(m.Identities, keystore.Identity{Identifier: r.id.String(), SK1: sk1, SK2: sk2})
+	}
+
+	var err error
+	if m.GroupKey1, err = u.groupKey1.MarshalBinary(); err != nil {
+		return nil, err
+	}
+	if m.GroupKey2, err = u.groupKey2.MarshalBinary(); err != nil {
+		return nil, err
+	}
+
+	if u.identity != nil {
+		m.SessionKeys = &keystore.SessionKeys{
+			IdentityKey:  append([]byte(nil), u.identity.DH.Private[:]...),
+			SignedPreKey: append([]byte(nil), u.signedPreKey.Private[:]...),
+			SigningKey:   append([]byte(nil), u.identity.Signing...),
+		}
+	}
+	for _, s := range u.sessions {
+		m.Sessions = append(m.Sessions, s)
+	}
+	sort.Slice(m.Sessions, func(i, j int) bool {
+		a, b := m.Sessions[i], m.Sessions[j]
+		return a.Local < b.Local || a.Local == b.Local && a.Contact < b.Contact
+	})
+	return &m, nil
+}
+
+// Restore a user from a keystore. Public keys are derived again from the identifiers.
+func userFromManifest(m *keystore.Manifest) (*user, error) {
+	if len(m.Identities) == 0 {
+		return nil, errors.New("keystore: no identifier")
+	}
+	u := user{name: m.Name, region: m.Region, epoch: m.Epoch, cache: newPairingCache(defaultCacheSize)}
+	for _, ident := range m.Identities {
+		id, err := identifier.Parse(ident.Identifier, "")
+		if err != nil {
+			return nil, fmt.Errorf("keystore: %s: %v", ident.Identifier, err)
+		}
+		r := newRegistration(id)
+		if r.sk1, err = unmarshalPoint(suite.G1().Point(), ident.SK1); err != nil {
+			return nil, err
+		}
+		if r.sk2, err = unmarshalPoint(suite.G2().Point(), ident.SK2); err != nil {
+			return nil, err
+		}
+		u.registrations = append(u.registrations, r)
+	}
+	u.registration = u.registrations[0]
+
+	var err error
+	if u.groupKey1, err = unmarshalPoint(suite.G2().Point(), m.GroupKey1); err != nil {
+		return nil, err
+	}
+	if u.groupKey2, err = unmarshalPoint(suite.G1().Point(), m.GroupKey2); err != nil {
+		return nil, err
+	}
+
+	if k := m.SessionKeys; k != nil {
+		if len(k.IdentityKey) != x3dh.KeySize || len(k.SignedPreKey) != x3dh.KeySize || len(k.SigningKey) != ed25519.PrivateKeySize {
+			return nil, errors.New("keystore: malformed session keys")
+		}
+		var identity, signedPreKey [x3dh.KeySize]byte
+		copy(identity[:], k.IdentityKey)
+		copy(signedPreKey[:], k.SignedPreKey)
+		u.identity = &x3dh.Identity{DH: x3dh.NewKeyPair(identity), Signing: ed25519.PrivateKey(k.SigningKey)}
+		u.signedPreKey = x3dh.NewKeyPair(signedPreKey)
+	}
+	u.sessions = map[sessionID]keystore.Session{}
+	for _, s := range m.Sessions {
+		local, err := identifier.Parse(s.Local, "")
+		if err != nil {
+			return nil, fmt.Errorf("keystore: session from %s: %v", s.Local, err)
+		}
+		contact, err := identifier.Parse(s.Contact, "")
+		if err != nil {
+			return nil, fmt.Errorf("keystore: session with %s: %v", s.Contact, err)
+		}
+		if _, _, err := decodeSession(s); err != nil {
+			return nil, fmt.Errorf("keystore: session with %s: %v", s.Contact, err)
+		}
+		u.sessions[sessionID{local, contact}] = s
+	}
+	return &u, nil
+}
+
+// Sessions are kept per identifier of ours and of the contact, as each pair meets at a
+// meeting point of its own
+type sessionID struct {
+	local, contact identifier.Identifier
+}
+
+// Where and under which passphrase the user is kept between runs
+type keystoreFile struct {
+	path       string
+	passphrase []byte
+}
+
+// The cache of hashes and shared keys is kept next to the keystore
+func (k *keystoreFile) cachePath() string {
+	return k.path + ".cache"
+}
+
+// Write the user back to their keystore, if they keep one
+func (u *user) save() error {
+	if u.keystore == nil {
+		return nil
+	}
+	m, err := u.manifest()
+	if err != nil {
+		return err
+	}
+	return keystore.Save(u.keystore.path, u.keystore.passphrase, m)
+}
+
+// Write the pairing cache next to the keystore, if the user keeps one, so that the next runs do
+// not hash the identifiers of known contacts and derive shared keys with them again
+func (u *user) saveCache() error {
+	if u.keystore == nil {
+		return nil
+	}
+	data, err := u.cache.marshal()
+	if err != nil {
+		return err
+	}
+	return keystore.SaveData(u.keystore.cachePath(), u.keystore.passphrase, data)
+}
+
+// Restore the pairing cache saved with the keystore, if any
+func (u *user) loadCache() error {
+	data, err := keystore.LoadData(u.keystore.cachePath(), u.keystore.passphrase)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return u.cache.unmarshal(data, u.epoch)
+}
+
+// Remember the session with a contact and write the keystore back. The double ratchet must be
+// saved after every message it encrypts or decrypts: a ratchet restored from an earlier state
+// would encrypt new messages under message keys already used.
+func (u *user) saveSession(c *contact) error {
+	s := keystore.Session{
+		Local:   c.local.id.String(),
+		Contact: c.id.String(),
+		Epoch:   c.epoch,
+		Mailbox: keystore.Sequence{NextSend: c.mailbox.NextSend, NextReceive: c.mailbox.NextReceive},
+	}
+	if c.session != nil {
+		var err error
+		if s.Ratchet, err = c.session.MarshalBinary(); err != nil {
+			return err
+		}
+	}
+	if c.oneTimePreKey != nil {
+		s.OneTimePreKeyID = c.oneTimePreKey.ID
+		s.OneTimePreKey = append([]byte(nil), c.oneTimePreKey.Private[:]...)
+	}
+	if u.sessions == nil {
+		u.sessions = map[sessionID]keystore.Session{}
+	}
+	u.sessions[sessionID{c.local.id, c.id}] = s
+
+	return u.save()
+}
+
+// Restore the session with a contact saved in the same key epoch, if any. Sessions from
+// earlier epochs belong to meeting points that are gone.
+func (u *user) restoreSession(c *contact) {
+	s, ok := u.sessions[sessionID{c.local.id, c.id}]
+	if !ok || s.Epoch != c.epoch {
+		return
+	}
+	// Sessions were checked when the keystore was loaded
+	c.session, c.oneTimePreKey, _ = decodeSession(s)
+	c.mailbox = mailbox.State{NextSend: s.Mailbox.NextSend, NextReceive: s.Mailbox.NextReceive}
+}
+
+func decodeSession(s keystore.Session) (*ratchet.State, *x3dh.PreKey, error) {
+	var r *ratchet.State
+	if s.Ratchet != nil {
+		r = new(ratchet.State)
+		if err := r.UnmarshalBinary(s.Ratchet); err != nil {
+			return nil, nil, err
+		}
+	}
+	var otk *x3dh.PreKey
+	if s.OneTimePreKey != nil {
+		if len(s.OneTimePreKey) != x3dh.KeySize {
+			return nil, nil, errors.New("malformed one-time prekey")
+		}
+		var private [x3dh.KeySize]byte
+		copy(private[:], s.OneTimePreKey)
+		otk = &x3dh.PreKey{ID: s.OneTimePreKeyID, KeyPair: x3dh.NewKeyPair(private)}
+	}
+	return r, otk, nil
+}
+
+func unmarshalPoint(p kyber.Point, data []byte) (kyber.Point, error) {
+	if err := p.UnmarshalBinary(data); err != nil {
+		return nil, errors.New("keystore: malformed key: " + err.Error())
+	}
+	return p, nil
+}
+
+// How many times the passphrase of a keystore is asked before giving up
+const passphraseAttempts = 3
+
+// Load the user from the keystore at path, asking for its passphrase until it opens, at most
+// passphraseAttempts times. Returns nil if there is no keystore yet, and keystore.ErrDecrypt
+// once every attempt failed.
+func loadUser(path string) (*user, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+	fmt.Println(prompt + "Enter the passphrase of your keystore " + path + ":")
+	for attempt := 1; ; attempt++ {
+		passphrase := readPassphrase()
+		m, err := keystore.Load(path, passphrase)
+		if err == keystore.ErrDecrypt && attempt < passphraseAttempts {
+			fmt.Println(prompt + "Wrong passphrase. Enter the passphrase of your keystore:")
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		u, err := userFromManifest(m)
+		if err != nil {
+			return nil, err
+		}
+		u.keystore = &keystoreFile{path: path, passphrase: passphrase}
+		// The cache only saves work, so the user is loaded without it if it cannot be read
+		if err := u.loadCache(); err != nil {
+			fmt.Println(prompt + "Could not load the cache of contact keys: " + err.Error())
+		}
+		return u, nil
+	}
+}
+
+// Offer to keep the identifiers and private keys of the user in a keystore at path, so that
+// they do not need to be fetched from the servers again. The passphrase is not echoed, so it is
+// asked twice.
+func saveUser(path string, u *user) error {
+	fmt.Println(prompt + "Choose a passphrase to keep your keys in " + path + " (empty to skip):")
+	for {
+		passphrase := readPassphrase()
+		if len(passphrase) == 0 {
+			return nil
+		}
+		fmt.Println(prompt + "Enter the passphrase again:")
+		if string(readPassphrase()) != string(passphrase) {
+			fmt.Println(prompt + "Passphrases do not match. Choose a passphrase (empty to skip):")
+			continue
+		}
+		u.keystore = &keystoreFile{path: path, passphrase: passphrase}
+		return u.save()
+	}
+}
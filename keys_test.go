@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nmohnblatt/cd_client/keyschedule"
+	"github.com/nmohnblatt/cd_client/keystore"
+	"github.com/nmohnblatt/cd_client/rendezvous"
+	"go.dedis.ch/kyber/v3/util/random"
+	"golang.org/x/term"
+)
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	n, thr := 3, 2
+	secret := suite.GT().Scalar().Pick(random.New())
+	serverList, pubPoly1, pubPoly2 := setupThresholdServers(suite, secret, n, thr)
+
+	alice := testUser(t, "Alice", "07111111111")
+	if _, err := alice.manifest(); err == nil {
+		t.Errorf("Saved a user without private keys")
+	}
+	if err := alice.addIdentifier("alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	bob := testUser(t, "Bob", "07222222222")
+	for _, u := range []*user{alice, bob} {
+		if err := u.obtainPrivateKeysThreshold(suite, serverList[:thr], pubPoly1, pubPoly2, thr, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := alice.manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := keystore.Seal([]byte("pass"), m, keystore.Params{LogN: 10, R: 8, P: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, err = keystore.Open([]byte("pass"), data); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := userFromManifest(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.name != "Alice" || restored.region != "GB" || len(restored.registrations) != 2 || restored.registrations[1].id != alice.registrations[1].id || restored.epoch != alice.epoch {
+		t.Fatalf("Wrong user restored: %+v", restored)
+	}
+	if !restored.issuedUnder(pubPoly1.Commit(), pubPoly2.Commit()) {
+		t.Errorf("Restored keys not issued under the group keys of the servers")
+	}
+	// Keys must be fetched again once the servers rotated their master keys
+	_, rotated1, rotated2 := setupThresholdServers(suite, suite.GT().Scalar().Pick(random.New()), n, thr)
+	if restored.issuedUnder(rotated1.Commit(), rotated2.Commit()) {
+		t.Errorf("Restored keys taken for keys issued under rotated group keys")
+	}
+
+	// The restored user meets Bob from both identifiers and signs posts he accepts
+	for i, r := range restored.registrations {
+		if string(newContactAs(restored, r, bob.id).meetingPoint) != string(newContactAs(alice, alice.registrations[i], bob.id).meetingPoint) {
+			t.Errorf("%v: restored keys do not meet Bob", r.id)
+		}
+	}
+	post, err := signPost(restored.registration, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifyPost(bob, alice.id, post); err != nil {
+		t.Errorf("Post signed with restored keys rejected: %v", err)
+	}
+	if post, err = signPost(bob.registration, []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifyPost(restored, bob.id, post); err != nil {
+		t.Errorf("Restored group key rejects Bob's post: %v", err)
+	}
+}
+
+func TestKeystoreSessions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	alice, bob := newSessionUsers(t)
+	path := filepath.Join(dir, "alice.keys")
+	alice.keystore = &keystoreFile{path: path, passphrase: []byte("pass")}
+	if err := alice.save(); err != nil {
+		t.Fatal(err)
+	}
+	users := []*user{alice, bob}
+	contacts := confirmAll(t, users, [][2]int{{0, 1}})
+	aliceView, bobView := contacts[alice][0], contacts[bob][0]
+	store := rendezvous.NewMemory()
+
+	for i := 0; i < 3; i++ {
+		for _, u := range users {
+			if _, err := establishSession(store, u, contacts[u][0]); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	exchange := func(from, to *user, fromView, toView *contact, body string) {
+		t.Helper()
+		if err := sendMessage(store, from, fromView, []byte(body)); err != nil {
+			t.Fatal(err)
+		}
+		messages, err := readMessages(store, to, toView)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(messages) != 1 || string(messages[0].Body) != body {
+			t.Fatalf("Wrong messages: %v", messages)
+		}
+	}
+	// The initiator speaks first
+	if aliceView.schedule.Role() == keyschedule.Initiator {
+		exchange(alice, bob, aliceView, bobView, "hello")
+		exchange(bob, alice, bobView, aliceView, "hi Alice")
+	} else {
+		exchange(bob, alice, bobView, aliceView, "hello")
+		exchange(alice, bob, aliceView, bobView, "hi Bob")
+	}
+
+	// Alice runs the client again: her X3DH keys and the session with Bob are read back from
+	// the keystore, which was written after every message
+	m, err := keystore.Load(path, []byte("pass"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := userFromManifest(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.identity == nil || restored.identity.DH.Public != alice.identity.DH.Public || !restored.identity.Signing.Equal(alice.identity.Signing) {
+		t.Errorf("X3DH identity not restored")
+	}
+	if restored.signedPreKey == nil || *restored.signedPreKey != *alice.signedPreKey {
+		t.Errorf("Signed prekey not restored")
+	}
+	restoredView := newContact(restored, bob.id)
+	if restoredView.session == nil || restoredView.mailbox != aliceView.mailbox {
+		t.Fatalf("Session with Bob not restored: %+v", restoredView.mailbox)
+	}
+	restoredView.confirmationPosted()
+	if err := restoredView.checkConfirmation(bobView.confirmationTag()); err != nil {
+		t.Fatal(err)
+	}
+
+	exchange(bob, restored, bobView, restoredView, "still there?")
+	exchange(restored, bob, restoredView, bobView, "yes")
+}
+
+func TestLoadUserAttempts(t *testing.T) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		t.Skip("passphrases are read from the terminal")
+	}
+	defer func(saved *bufio.Reader) { stdin = saved }(stdin)
+
+	alice := testUser(t, "Alice", "07111111111")
+	issueKeys(t, alice)
+	m, err := alice.manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "cd_client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "keys")
+	if err := keystore.Save(path, []byte("pass"), m); err != nil {
+		t.Fatal(err)
+	}
+
+	stdin = bufio.NewReader(strings.NewReader("wrong\npass\n"))
+	if u, err := loadUser(path); err != nil || u == nil || u.name != "Alice" {
+		t.Errorf("Could not load the keystore after a wrong passphrase: %v", err)
+	}
+
+	// Give up after the last attempt rather than asking forever
+	stdin = bufio.NewReader(strings.NewReader(strings.Repeat("wrong\n", passphraseAttempts) + "pass\n"))
+	if _, err := loadUser(path); err != keystore.ErrDecrypt {
+		t.Errorf("Expected to give up after %d attempts, got %v", passphraseAttempts, err)
+	}
+}
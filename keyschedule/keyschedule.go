@@ -0,0 +1,190 @@
+// Package keyschedule derives purpose-specific keys from the key material shared by two
+// contacts. Every key is obtained with HKDF-SHA256 under its own label so that keys used by
+// different protocols are independent of each other.
+package keyschedule
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// KeySize is the size in bytes of the symmetric keys output by the schedule
+const KeySize = 32
+
+const (
+	labelConfirmation = "cd_client confirmation key v1"
+	labelMutual       = "cd_client mutual discovery key v1"
+	labelRecordName   = "cd_client record name key v1"
+	labelIPNS         = "cd_client ipns key v1"
+	labelTopic        = "cd_client pubsub topic v1"
+	labelChannel      = "cd_client channel key v1"
+	labelWrite        = "cd_client write key v1"
+	labelEnvelope     = "cd_client envelope key v1"
+	labelSession      = "cd_client session psk v1"
+	labelNoise        = "cd_client noise psk v1"
+	labelDirection    = "cd_client direction key v1"
+)
+
+// Role tells which contact speaks first in protocols where both cannot
+type Role int
+
+const (
+	// RoleUnknown is the role in schedules without directional values
+	RoleUnknown Role = iota
+	// Initiator writes the first message
+	Initiator
+	// Responder waits for the initiator's first message
+	Responder
+)
+
+func (r Role) String() string {
+	switch r {
+	case Initiator:
+		return "initiator"
+	case Responder:
+		return "responder"
+	default:
+		return "unknown"
+	}
+}
+
+// Schedule holds the key material shared by two contacts
+type Schedule struct {
+	secret []byte
+	// Canonical encodings of the two directional values, ours and the contact's
+	own, peer []byte
+}
+
+// New creates a key schedule from the key material shared by two contacts
+func New(keymaterial []byte) *Schedule {
+	secret := make([]byte, len(keymaterial))
+	copy(secret, keymaterial)
+
+	return &Schedule{secret: secret}
+}
+
+// NewDirectional creates a key schedule that also knows the two directional values the key
+// material was derived from: own is the value in which our identifier comes first, and peer
+// the one in which the contact's does. The contact passes the same values the other way round,
+// which lets both sides agree on roles and on per-direction keys.
+func NewDirectional(keymaterial, own, peer []byte) *Schedule {
+	s := New(keymaterial)
+	s.own = append([]byte(nil), own...)
+	s.peer = append([]byte(nil), peer...)
+
+	return s
+}
+
+// Role returns our role. The contact whose own directional value is lower in lexical order is
+// the initiator. Schedules created with New, or with equal values, have no role.
+func (s *Schedule) Role() Role {
+	switch c := bytes.Compare(s.own, s.peer); {
+	case s.own == nil || c == 0:
+		return RoleUnknown
+	case c < 0:
+		return Initiator
+	default:
+		return Responder
+	}
+}
+
+// SendKey returns the key for content that we send to the contact. It is the contact's
+// ReceiveKey. Returns nil if the schedule has no directional values.
+func (s *Schedule) SendKey() []byte {
+	return s.directionKey(s.own, s.peer)
+}
+
+// ReceiveKey returns the key for content that the contact sends to us. It is the contact's
+// SendKey. Returns nil if the schedule has no directional values.
+func (s *Schedule) ReceiveKey() []byte {
+	return s.directionKey(s.peer, s.own)
+}
+
+func (s *Schedule) directionKey(from, to []byte) []byte {
+	if s.own == nil {
+		return nil
+	}
+	label := make([]byte, 0, len(labelDirection)+4+len(from)+len(to))
+	label = append(label, labelDirection...)
+	label = append(label, byte(len(from)>>8), byte(len(from)))
+	label = append(label, from...)
+	label = append(label, byte(len(to)>>8), byte(len(to)))
+	label = append(label, to...)
+
+	return s.derive(string(label), KeySize)
+}
+
+// MeetingPoint returns the SHA-256 digest of the shared key material
+func (s *Schedule) MeetingPoint() []byte {
+	h := sha256.Sum256(s.secret)
+	return h[:]
+}
+
+// ConfirmationKey returns the MAC key used to confirm that both contacts derived the same secret
+func (s *Schedule) ConfirmationKey() []byte {
+	return s.derive(labelConfirmation, KeySize)
+}
+
+// MutualDiscoveryKey returns the key used to compute tags during mutual-contact discovery
+func (s *Schedule) MutualDiscoveryKey() []byte {
+	return s.derive(labelMutual, KeySize)
+}
+
+// RecordNameKey returns the key used to name the records written at the meeting point, so that
+// names do not reveal who wrote them
+func (s *Schedule) RecordNameKey() []byte {
+	return s.derive(labelRecordName, KeySize)
+}
+
+// IPNSKey returns the Ed25519 key of the IPNS name that both contacts publish their records to
+func (s *Schedule) IPNSKey() ed25519.PrivateKey {
+	return ed25519.NewKeyFromSeed(s.derive(labelIPNS, ed25519.SeedSize))
+}
+
+// PubsubTopic returns the name of the pubsub topic of the live channel between the contacts
+func (s *Schedule) PubsubTopic() string {
+	return "cd_client/" + hex.EncodeToString(s.derive(labelTopic, 16))
+}
+
+// ChannelKey returns the key that encrypts the frames of the live channel
+func (s *Schedule) ChannelKey() []byte {
+	return s.derive(labelChannel, KeySize)
+}
+
+// WriteKey returns the Ed25519 key that proves to a rendezvous server that a writer knows the
+// shared secret behind the meeting point
+func (s *Schedule) WriteKey() ed25519.PrivateKey {
+	return ed25519.NewKeyFromSeed(s.derive(labelWrite, ed25519.SeedSize))
+}
+
+// EnvelopeKey returns the key that seals the envelopes posted at the meeting point when the
+// schedule has no directional values. Otherwise each direction is sealed under its SendKey.
+func (s *Schedule) EnvelopeKey() []byte {
+	return s.derive(labelEnvelope, KeySize)
+}
+
+// SessionKey returns the pre-shared key mixed into the handshake of end-to-end encrypted
+// sessions, so that only the holders of the contact secret can complete it
+func (s *Schedule) SessionKey() []byte {
+	return s.derive(labelSession, KeySize)
+}
+
+// NoiseKey returns the pre-shared key of Noise handshakes between the contacts
+func (s *Schedule) NoiseKey() []byte {
+	return s.derive(labelNoise, KeySize)
+}
+
+func (s *Schedule) derive(label string, size int) []byte {
+	out := make([]byte, size)
+	kdf := hkdf.New(sha256.New, s.secret, nil, []byte(label))
+	if _, err := io.ReadFull(kdf, out); err != nil {
+		// HKDF-SHA256 can output up to 255*32 bytes
+		panic(err)
+	}
+	return out
+}
@@ -0,0 +1,99 @@
+package keyschedule
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestMeetingPoint(t *testing.T) {
+	keymaterial := []byte("some shared key material")
+	want := sha256.Sum256(keymaterial)
+
+	if !bytes.Equal(New(keymaterial).MeetingPoint(), want[:]) {
+		t.Errorf("Meeting point is not the digest of the key material")
+	}
+}
+
+func TestDerivedKeys(t *testing.T) {
+	s1 := New([]byte("some shared key material"))
+	s2 := New([]byte("some shared key material"))
+	s3 := New([]byte("other key material"))
+
+	if len(s1.ConfirmationKey()) != KeySize {
+		t.Errorf("Wrong key size")
+	}
+	if !bytes.Equal(s1.ConfirmationKey(), s2.ConfirmationKey()) {
+		t.Errorf("Same key material gave different confirmation keys")
+	}
+	if bytes.Equal(s1.ConfirmationKey(), s3.ConfirmationKey()) {
+		t.Errorf("Different key material gave the same confirmation key")
+	}
+	if bytes.Equal(s1.ConfirmationKey(), s1.ChannelKey()) {
+		t.Errorf("Confirmation key is equal to the channel key")
+	}
+	if s1.PubsubTopic() != s2.PubsubTopic() || s1.PubsubTopic() == s3.PubsubTopic() {
+		t.Errorf("Pubsub topic does not depend on the key material only")
+	}
+	if bytes.Equal(s1.ConfirmationKey(), s1.MutualDiscoveryKey()) {
+		t.Errorf("Confirmation key is equal to the mutual discovery key")
+	}
+	if bytes.Equal(s1.EnvelopeKey(), s1.ChannelKey()) {
+		t.Errorf("Envelope key is equal to the channel key")
+	}
+	if bytes.Equal(s1.SessionKey(), s1.NoiseKey()) {
+		t.Errorf("Session key is equal to the Noise key")
+	}
+	if bytes.Equal(s1.SessionKey(), s1.EnvelopeKey()) {
+		t.Errorf("Session key is equal to the envelope key")
+	}
+	if bytes.Equal(s1.ConfirmationKey(), s1.MeetingPoint()) {
+		t.Errorf("Confirmation key is equal to the meeting point")
+	}
+}
+
+func TestIPNSKey(t *testing.T) {
+	s1 := New([]byte("some shared key material"))
+	s2 := New([]byte("some shared key material"))
+
+	if !s1.IPNSKey().Equal(s2.IPNSKey()) {
+		t.Errorf("Same key material gave different IPNS keys")
+	}
+	if s1.IPNSKey().Equal(New([]byte("other key material")).IPNSKey()) {
+		t.Errorf("Different key material gave the same IPNS key")
+	}
+	if s1.IPNSKey().Equal(s1.WriteKey()) {
+		t.Errorf("IPNS key is equal to the write key")
+	}
+	if !s1.WriteKey().Equal(s2.WriteKey()) {
+		t.Errorf("Same key material gave different write keys")
+	}
+}
+
+func TestDirections(t *testing.T) {
+	keymaterial := []byte("some shared key material")
+	ab, ba := []byte("value of Alice first"), []byte("value of Bob first")
+	alice := NewDirectional(keymaterial, ab, ba)
+	bob := NewDirectional(keymaterial, ba, ab)
+
+	if alice.Role() == RoleUnknown || bob.Role() == RoleUnknown || alice.Role() == bob.Role() {
+		t.Errorf("Contacts did not agree on roles: %s and %s", alice.Role(), bob.Role())
+	}
+	if !bytes.Equal(alice.SendKey(), bob.ReceiveKey()) || !bytes.Equal(bob.SendKey(), alice.ReceiveKey()) {
+		t.Errorf("Directional keys do not match")
+	}
+	if bytes.Equal(alice.SendKey(), alice.ReceiveKey()) {
+		t.Errorf("Send and receive keys are equal")
+	}
+	if !bytes.Equal(alice.MeetingPoint(), bob.MeetingPoint()) || !bytes.Equal(alice.MeetingPoint(), New(keymaterial).MeetingPoint()) {
+		t.Errorf("Directional values changed the meeting point")
+	}
+
+	// Schedules without distinct directional values have no role
+	if New(keymaterial).Role() != RoleUnknown || New(keymaterial).SendKey() != nil {
+		t.Errorf("Schedule without directional values has a role")
+	}
+	if NewDirectional(keymaterial, ab, ab).Role() != RoleUnknown {
+		t.Errorf("Schedule with equal directional values has a role")
+	}
+}
@@ -0,0 +1,291 @@
+// Package keystore stores the secrets of a user on disk, encrypted under a passphrase.
+//
+// A keystore is a clear header followed by an AEAD ciphertext of the manifest:
+//
+//	magic "cdks" (4) | version (1) | kdf (1) | log2 N (1) | r (1) | p (1) | salt (16) | nonce (24) | ciphertext
+//
+// The key is derived from the passphrase with scrypt, using the parameters and salt of the
+// header, and the manifest is sealed with XChaCha20-Poly1305 with the header as additional data.
+// The manifest is JSON and carries its own version, so that manifests written by older clients
+// can be migrated when they are loaded. Data kept next to a keystore, such as caches, is sealed
+// the same way under the same passphrase.
+package keystore
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Version is the version of the keystore format produced by this package
+const Version = 1
+
+// KDF identifies the function deriving the key from the passphrase
+type KDF uint8
+
+// KDFScrypt derives the key with scrypt
+const KDFScrypt KDF = 1
+
+// Params are the cost parameters of scrypt
+type Params struct {
+	LogN, R, P uint8
+}
+
+// DefaultParams are the scrypt parameters recommended for interactive logins
+var DefaultParams = Params{LogN: 15, R: 8, P: 1}
+
+// Bounds on the scrypt parameters, which are read from the header before the passphrase can
+// be checked, so that a crafted keystore cannot make loading it exhaust time or memory
+const (
+	MaxLogN = 20
+	// MaxRP bounds the product of r and p, which scales the time scrypt takes
+	MaxRP = 64
+	// MaxMemory bounds the memory scrypt takes, 128·r·N bytes
+	MaxMemory = 1 << 30
+)
+
+const (
+	magic      = "cdks"
+	saltSize   = 16
+	headerSize = 4 + 1 + 1 + 3 + saltSize + chacha20poly1305.NonceSizeX
+)
+
+var (
+	// ErrDecrypt is returned when the passphrase is wrong or the keystore was altered
+	ErrDecrypt = errors.New("keystore: wrong passphrase or corrupted keystore")
+	// ErrUnsupported is returned for keystores written by a newer client
+	ErrUnsupported = errors.New("keystore: unsupported version")
+)
+
+// Identity is an identifier the user registered with and the private keys issued for it
+type Identity struct {
+	// Identifier in the "kind:value" form
+	Identifier string `json:"identifier"`
+	// Marshalled private keys
+	SK1 []byte `json:"sk1"`
+	SK2 []byte `json:"sk2"`
+}
+
+// Manifest is the content of a keystore
+type Manifest struct {
+	// Version of the manifest. Manifests of older versions are migrated when loaded.
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	Region  string `json:"region"`
+	// Epoch the private keys were issued in
+	Epoch uint32 `json:"epoch"`
+	// Identities of the user, the primary one first
+	Identities []Identity `json:"identities"`
+	// Marshalled group public keys of the servers that issued the private keys
+	GroupKey1 []byte `json:"group_key1"`
+	GroupKey2 []byte `json:"group_key2"`
+	// X3DH keys of the user, absent until their first session
+	SessionKeys *SessionKeys `json:"session_keys,omitempty"`
+	// Sessions with contacts
+	Sessions []Session `json:"sessions,omitempty"`
+}
+
+// SessionKeys are the X3DH identity and signed prekey of the user. Public keys are derived
+// again from the private ones.
+type SessionKeys struct {
+	// X25519 private keys
+	IdentityKey  []byte `json:"identity_key"`
+	SignedPreKey []byte `json:"signed_prekey"`
+	// Ed25519 private key
+	SigningKey []byte `json:"signing_key"`
+}
+
+// Session is what the user must remember of a contact between runs to keep exchanging
+// messages with them
+type Session struct {
+	// Our identifier the contact is met from and the contact's, in the "kind:value" form
+	Local   string `json:"local"`
+	Contact string `json:"contact"`
+	// Epoch the shared keys with the contact were derived in
+	Epoch uint32 `json:"epoch"`
+	// Marshalled double ratchet, absent until the session is established
+	Ratchet []byte `json:"ratchet,omitempty"`
+	// One-time prekey published for the contact and its X25519 private key, absent once used
+	OneTimePreKeyID uint32 `json:"one_time_prekey_id,omitempty"`
+	OneTimePreKey   []byte `json:"one_time_prekey,omitempty"`
+	// Sequence numbers of the mailbox with the contact
+	Mailbox Sequence `json:"mailbox"`
+}
+
+// Sequence holds the sequence numbers of a mailbox
+type Sequence struct {
+	NextSend    uint64 `json:"next_send"`
+	NextReceive uint64 `json:"next_receive"`
+}
+
+// Migrations of the manifest, in order: migrations[i] turns a manifest of version i+1 into
+// one of version i+2. The manifest is given as its JSON fields.
+var migrations []func(fields map[string]json.RawMessage) error
+
+// ManifestVersion is the version of the manifests written by this package
+func ManifestVersion() int {
+	return len(migrations) + 1
+}
+
+// Seal encrypts a manifest under a passphrase. The manifest is written in the current version.
+func Seal(passphrase []byte, m *Manifest, params Params) ([]byte, error) {
+	current := *m
+	current.Version = ManifestVersion()
+	plaintext, err := json.Marshal(&current)
+	if err != nil {
+		return nil, err
+	}
+	return seal(passphrase, plaintext, params)
+}
+
+// Open decrypts a keystore and migrates its manifest to the current version
+func Open(passphrase []byte, data []byte) (*Manifest, error) {
+	plaintext, err := open(passphrase, data)
+	if err != nil {
+		return nil, err
+	}
+	return migrate(plaintext)
+}
+
+func seal(passphrase, plaintext []byte, params Params) ([]byte, error) {
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	header[4], header[5] = Version, byte(KDFScrypt)
+	header[6], header[7], header[8] = params.LogN, params.R, params.P
+	if _, err := rand.Read(header[9:]); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(passphrase, header)
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(header, header[9+saltSize:], plaintext, header), nil
+}
+
+func open(passphrase, data []byte) ([]byte, error) {
+	if len(data) < headerSize || !bytes.Equal(data[:4], []byte(magic)) {
+		return nil, errors.New("keystore: not a keystore")
+	}
+	header := data[:headerSize]
+	if header[4] != Version || KDF(header[5]) != KDFScrypt {
+		return nil, ErrUnsupported
+	}
+	aead, err := newAEAD(passphrase, header)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, header[9+saltSize:], data[headerSize:], header)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// Derive the key of a keystore from the passphrase and the parameters of its header
+func newAEAD(passphrase, header []byte) (cipher.AEAD, error) {
+	logN, r, p := header[6], int(header[7]), int(header[8])
+	if logN < 1 || logN > MaxLogN || r < 1 || p < 1 || r*p > MaxRP || 128*r<<logN > MaxMemory {
+		return nil, errors.New("keystore: invalid scrypt parameters")
+	}
+	key, err := scrypt.Key(passphrase, header[9:9+saltSize], 1<<logN, r, p, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+	return chacha20poly1305.NewX(key)
+}
+
+// Apply the migrations from the version of the manifest to the current one
+func migrate(plaintext []byte) (*Manifest, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(plaintext, &fields); err != nil {
+		return nil, errors.New("keystore: malformed manifest")
+	}
+	var version int
+	if err := json.Unmarshal(fields["version"], &version); err != nil || version < 1 {
+		return nil, errors.New("keystore: manifest without a version")
+	}
+	if version > ManifestVersion() {
+		return nil, ErrUnsupported
+	}
+	for v := version; v < ManifestVersion(); v++ {
+		if err := migrations[v-1](fields); err != nil {
+			return nil, fmt.Errorf("keystore: migrating manifest version %d: %v", v, err)
+		}
+	}
+
+	migrated, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(migrated, &m); err != nil {
+		return nil, errors.New("keystore: malformed manifest")
+	}
+	m.Version = ManifestVersion()
+	return &m, nil
+}
+
+// Save seals a manifest with the default parameters and writes it to path. The file is
+// replaced atomically and only readable by its owner.
+func Save(path string, passphrase []byte, m *Manifest) error {
+	data, err := Seal(passphrase, m, DefaultParams)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, data)
+}
+
+// Load reads and opens the keystore at path
+func Load(path string, passphrase []byte) (*Manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Open(passphrase, data)
+}
+
+// SaveData seals data kept next to a keystore with the default parameters and writes it to
+// path, as Save does for manifests
+func SaveData(path string, passphrase, data []byte) error {
+	sealed, err := seal(passphrase, data, DefaultParams)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, sealed)
+}
+
+// LoadData reads and opens data written by SaveData
+func LoadData(path string, passphrase []byte) ([]byte, error) {
+	sealed, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return open(passphrase, sealed)
+}
+
+// Replace the file at path atomically. Temporary files are only readable by their owner.
+func writeFile(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,150 @@
+package keystore
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Cheap parameters so that tests run quickly
+var testParams = Params{LogN: 10, R: 8, P: 1}
+
+func testManifest() *Manifest {
+	return &Manifest{
+		Name:   "Alice",
+		Region: "GB",
+		Epoch:  3,
+		Identities: []Identity{
+			{Identifier: "phone:+447111111111", SK1: []byte{1, 2}, SK2: []byte{3, 4}},
+			{Identifier: "email:alice@example.com", SK1: []byte{5}, SK2: []byte{6}},
+		},
+		GroupKey1:   []byte{7},
+		GroupKey2:   []byte{8},
+		SessionKeys: &SessionKeys{IdentityKey: []byte{9}, SignedPreKey: []byte{10}, SigningKey: []byte{11}},
+		Sessions: []Session{
+			{Local: "phone:+447111111111", Contact: "phone:+447222222222", Epoch: 3, Ratchet: []byte{12}, Mailbox: Sequence{NextSend: 2, NextReceive: 1}},
+			{Local: "phone:+447111111111", Contact: "username:bob", Epoch: 3, OneTimePreKeyID: 13, OneTimePreKey: []byte{14}},
+		},
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	m := testManifest()
+	data, err := Seal([]byte("correct horse"), m, testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened, err := Open([]byte("correct horse"), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Version = ManifestVersion()
+	if !reflect.DeepEqual(opened, m) {
+		t.Errorf("Got %+v, expected %+v", opened, m)
+	}
+
+	if _, err := Open([]byte("battery staple"), data); err != ErrDecrypt {
+		t.Errorf("Opened with the wrong passphrase: %v", err)
+	}
+	// The header is authenticated
+	tampered := append([]byte(nil), data...)
+	tampered[9] ^= 1
+	if _, err := Open([]byte("correct horse"), tampered); err != ErrDecrypt {
+		t.Errorf("Opened a keystore with a tampered salt: %v", err)
+	}
+	tampered = append([]byte(nil), data...)
+	tampered[4] = Version + 1
+	if _, err := Open([]byte("correct horse"), tampered); err != ErrUnsupported {
+		t.Errorf("Opened a keystore of an unknown version: %v", err)
+	}
+}
+
+func TestCostBounds(t *testing.T) {
+	data, err := Seal([]byte("pass"), testManifest(), testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Headers asking for more work than the bounds are rejected before running scrypt
+	for _, params := range []Params{{LogN: MaxLogN + 1, R: 1, P: 1}, {LogN: 10, R: 16, P: 8}, {LogN: MaxLogN, R: 16, P: 1}} {
+		tampered := append([]byte(nil), data...)
+		tampered[6], tampered[7], tampered[8] = params.LogN, params.R, params.P
+		if _, err := Open([]byte("pass"), tampered); err == nil || err == ErrDecrypt {
+			t.Errorf("Parameters %+v were not rejected: %v", params, err)
+		}
+		if _, err := Seal([]byte("pass"), testManifest(), params); err == nil {
+			t.Errorf("Sealed with parameters %+v", params)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	defer func(saved []func(map[string]json.RawMessage) error) { migrations = saved }(migrations)
+
+	data, err := Seal([]byte("pass"), testManifest(), testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A later version renames the user
+	migrations = append(migrations, func(fields map[string]json.RawMessage) error {
+		fields["name"] = json.RawMessage(`"Alice Liddell"`)
+		return nil
+	})
+	m, err := Open([]byte("pass"), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Version != 2 || m.Name != "Alice Liddell" || len(m.Identities) != 2 {
+		t.Errorf("Manifest not migrated: %+v", m)
+	}
+
+	// Manifests of versions newer than ours are rejected
+	newer, err := Seal([]byte("pass"), testManifest(), testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrations = migrations[:0]
+	if _, err := Open([]byte("pass"), newer); err != ErrUnsupported {
+		t.Errorf("Opened a manifest of a newer version: %v", err)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "keys")
+	if err := Save(path, []byte("pass"), testManifest()); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Keystore not private: %v %v", info.Mode(), err)
+	}
+	m, err := Load(path, []byte("pass"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "Alice" || m.Identities[1].Identifier != "email:alice@example.com" {
+		t.Errorf("Wrong manifest loaded: %+v", m)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("Temporary files left behind")
+	}
+
+	// Data kept next to the keystore is sealed under the same passphrase
+	path = filepath.Join(dir, "keys.cache")
+	if err := SaveData(path, []byte("pass"), []byte("cached")); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := LoadData(path, []byte("pass")); err != nil || string(data) != "cached" {
+		t.Errorf("Wrong data loaded: %q, %v", data, err)
+	}
+	if _, err := LoadData(path, []byte("wrong")); err != ErrDecrypt {
+		t.Errorf("Opened data with the wrong passphrase: %v", err)
+	}
+}
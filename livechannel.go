@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"github.com/nmohnblatt/cd_client/channel"
+	"github.com/nmohnblatt/cd_client/identifier"
+)
+
+// Payload of the presence frames sent in answer to the contact's, which are not answered
+var presenceAnswer = []byte("answer")
+
+// Open the live channel with a contact. Topic and key come from the contact's key schedule.
+func openLiveChannel(ps channel.PubSub, c *contact) (*channel.Channel, error) {
+	return channel.Open(ps, c.schedule.PubsubTopic(), c.schedule.ChannelKey())
+}
+
+// Subscribe to a live channel, then tell the contact we are online. The contact's frames are
+// passed to report until ctx is cancelled. Their presence is answered with ours, so that
+// whichever of the two comes online first learns about the other.
+func watchLiveChannel(ctx context.Context, ch *channel.Channel, report func(channel.Frame)) error {
+	frames, err := ch.Receive(ctx)
+	if err != nil {
+		return err
+	}
+	if err := ch.AnnouncePresence(); err != nil {
+		return err
+	}
+
+	go func() {
+		for f := range frames {
+			if f.Type == channel.Presence && !bytes.Equal(f.Payload, presenceAnswer) {
+				ch.Send(channel.Presence, presenceAnswer)
+			}
+			report(f)
+		}
+	}()
+	return nil
+}
+
+// Invite a contact to the three-party group we form with them and another of our contacts.
+// The invite names the other member, so that the contact can form the group too.
+func sendGroupInvite(ch *channel.Channel, other identifier.Identifier) error {
+	return ch.Send(channel.Invite, []byte(other.String()))
+}
+
+// Read the other member of the group a contact invites us to
+func openGroupInvite(f channel.Frame) (identifier.Identifier, error) {
+	if f.Type != channel.Invite {
+		return identifier.Identifier{}, errors.New("live channel: not an invite")
+	}
+	return identifier.Parse(string(f.Payload), "")
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nmohnblatt/cd_client/channel"
+)
+
+func TestLiveChannel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s1 := newDummyServer(1)
+	alice := testUser(t, "Alice", "07111111111")
+	bob := testUser(t, "Bob", "07222222222")
+	charlie := testUser(t, "Charlie", "07333333333")
+	for _, u := range []*user{alice, bob, charlie} {
+		u.obtainPrivateKeys(s1)
+	}
+	broker := channel.NewBroker()
+
+	aliceChannel, err := openLiveChannel(broker, newContact(alice, bob.id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobChannel, err := openLiveChannel(broker, newContact(bob, alice.id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	charlieChannel, err := openLiveChannel(broker, newContact(charlie, alice.id))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bobFrames, err := bobChannel.Receive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	charlieFrames, err := charlieChannel.Receive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := aliceChannel.Send(channel.Invite, []byte("group invite")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case f := <-bobFrames:
+		if f.Type != channel.Invite || !bytes.Equal(f.Payload, []byte("group invite")) {
+			t.Errorf("Bob received the wrong frame")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Bob did not receive Alice's invite")
+	}
+
+	select {
+	case <-charlieFrames:
+		t.Errorf("Charlie received a frame on Alice and Bob's channel")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWatchLiveChannel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s1 := newDummyServer(1)
+	alice := testUser(t, "Alice", "07111111111")
+	bob := testUser(t, "Bob", "07222222222")
+	charlie := testUser(t, "Charlie", "07333333333")
+	for _, u := range []*user{alice, bob, charlie} {
+		u.obtainPrivateKeys(s1)
+	}
+	broker := channel.NewBroker()
+
+	watch := func(u, other *user) (*channel.Channel, <-chan channel.Frame) {
+		ch, err := openLiveChannel(broker, newContact(u, other.id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames := make(chan channel.Frame, 10)
+		if err := watchLiveChannel(ctx, ch, func(f channel.Frame) { frames <- f }); err != nil {
+			t.Fatal(err)
+		}
+		return ch, frames
+	}
+	next := func(frames <-chan channel.Frame, who string) channel.Frame {
+		select {
+		case f := <-frames:
+			return f
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s did not receive a frame", who)
+		}
+		return channel.Frame{}
+	}
+
+	// Bob comes online first, and answers Alice's presence with his
+	_, bobFrames := watch(bob, alice)
+	aliceChannel, aliceFrames := watch(alice, bob)
+	if f := next(bobFrames, "Bob"); f.Type != channel.Presence {
+		t.Errorf("Bob did not learn that Alice is online")
+	}
+	if f := next(aliceFrames, "Alice"); f.Type != channel.Presence {
+		t.Errorf("Alice did not learn that Bob is online")
+	}
+
+	if err := sendGroupInvite(aliceChannel, charlie.id); err != nil {
+		t.Fatal(err)
+	}
+	f := next(bobFrames, "Bob")
+	other, err := openGroupInvite(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other != charlie.id {
+		t.Errorf("Invite names %v instead of Charlie", other)
+	}
+}
@@ -0,0 +1,284 @@
+// Package mailbox uses a meeting point as an asynchronous mailbox between two contacts.
+//
+// Every message is sealed in an envelope (see package envelope) under the key of the direction
+// it travels in and a fresh random nonce, and
+// stored as its own record at the meeting point. Records are named after a keyed tag of the
+// sender and a sequence number, so the rendezvous backend learns how many messages each side
+// sent but not who the contacts are:
+//
+//	msg-<sender tag>-<sequence number>
+//
+// The sequence number is also sealed in the envelope. Receivers deliver messages in order,
+// drop anything at or below the last acknowledged sequence number, and delete messages once
+// they are acknowledged.
+//
+// On backends with an append-only mailbox (see rendezvous.Appender), messages are appended to
+// it instead, so that they cannot be replaced once posted, and the backend names them. Messages
+// can also be signed by their sender, inside the envelope, with a Signer.
+package mailbox
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nmohnblatt/cd_client/envelope"
+	"github.com/nmohnblatt/cd_client/rendezvous"
+)
+
+const (
+	recordPrefix = "msg-"
+	tagSize      = 8
+	headerSize   = 8 + 8 + tagSize
+)
+
+// Keys used by a mailbox, all derived from the contacts' key schedule
+type Keys struct {
+	// Send seals the messages we post, and is the contact's Receive key
+	Send []byte
+	// Receive opens the messages the contact posts, and is the contact's Send key
+	Receive []byte
+	// Name keys the sender tags in record names
+	Name []byte
+}
+
+// Signer signs the messages we post and checks that those of the contact were signed by them
+type Signer interface {
+	// Sign returns the signed form of a message payload
+	Sign(payload []byte) ([]byte, error)
+	// Verify checks a payload signed by the contact and returns it
+	Verify(signed []byte) ([]byte, error)
+}
+
+// Message is a message received from the contact
+type Message struct {
+	Seq  uint64
+	Sent time.Time
+	Body []byte
+}
+
+// State is what a mailbox must remember across runs
+type State struct {
+	// Sequence number of the next message we send
+	NextSend uint64
+	// Sequence number of the next message we expect; lower ones are replays
+	NextReceive uint64
+}
+
+// Mailbox is one side of the mailbox between two contacts
+type Mailbox struct {
+	store    rendezvous.Rendezvous
+	id       string
+	keys     Keys
+	epoch    uint32
+	nextSend uint64
+	nextRecv uint64
+	ownTag   string
+	peerTag  string
+	signer   Signer
+
+	// Names of the appended records of the contact's messages last listed, by sequence number
+	appended map[uint64]string
+}
+
+// New returns our side of the mailbox at meeting point id. self and peer identify the two
+// contacts, typically by phone number. Messages are signed and checked with signer, unless it
+// is nil.
+func New(store rendezvous.Rendezvous, id string, keys Keys, epoch uint32, self, peer string, state State, signer Signer) *Mailbox {
+	return &Mailbox{
+		store:    store,
+		id:       id,
+		keys:     keys,
+		epoch:    epoch,
+		nextSend: state.NextSend,
+		nextRecv: state.NextReceive,
+		ownTag:   senderTag(keys.Name, self),
+		peerTag:  senderTag(keys.Name, peer),
+		signer:   signer,
+		appended: map[uint64]string{},
+	}
+}
+
+// State returns the sequence numbers to persist
+func (m *Mailbox) State() State {
+	return State{NextSend: m.nextSend, NextReceive: m.nextRecv}
+}
+
+// Post seals a message for the contact and stores it at the meeting point.
+// It returns the sequence number of the message.
+func (m *Mailbox) Post(body []byte) (uint64, error) {
+	seq := m.nextSend
+	payload := make([]byte, headerSize, headerSize+len(body))
+	binary.BigEndian.PutUint64(payload, seq)
+	binary.BigEndian.PutUint64(payload[8:], uint64(time.Now().UnixNano()))
+	tag, _ := hex.DecodeString(m.ownTag)
+	copy(payload[16:], tag)
+	payload = append(payload, body...)
+	if m.signer != nil {
+		var err error
+		if payload, err = m.signer.Sign(payload); err != nil {
+			return 0, err
+		}
+	}
+
+	data, err := envelope.Seal(m.keys.Send, m.epoch, envelope.Message, payload)
+	if err != nil {
+		return 0, err
+	}
+	if a, ok := m.store.(rendezvous.Appender); ok {
+		_, err = a.Append(m.id, data)
+	} else {
+		err = m.store.Put(m.id, recordName(m.ownTag, seq), data)
+	}
+	if err != nil {
+		return 0, err
+	}
+	m.nextSend++
+
+	return seq, nil
+}
+
+// List returns the contact's unacknowledged messages, in order. Replayed messages are deleted
+// and records that do not open are skipped.
+func (m *Mailbox) List() ([]Message, error) {
+	names, err := m.store.List(m.id)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []Message
+	delivered := map[uint64]bool{}
+	for _, name := range names {
+		// Appended records are named by the backend: their sequence number is only known
+		// once they are opened
+		seq, ok := parseRecordName(name, m.peerTag)
+		appended := !ok && strings.HasPrefix(name, rendezvous.MailboxPrefix)
+		if !ok && !appended {
+			continue
+		}
+		if ok && seq < m.nextRecv {
+			if err := m.store.Delete(m.id, name); err != nil && err != rendezvous.ErrNotFound {
+				return nil, err
+			}
+			continue
+		}
+
+		data, err := m.store.Get(m.id, name)
+		if err == rendezvous.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		msg, err := m.open(data)
+		if err != nil {
+			continue
+		}
+		if ok && msg.Seq != seq {
+			// The record name is not authenticated
+			continue
+		}
+		if appended && msg.Seq < m.nextRecv {
+			if err := m.store.Delete(m.id, name); err != nil && err != rendezvous.ErrNotFound {
+				return nil, err
+			}
+			continue
+		}
+		if delivered[msg.Seq] {
+			continue
+		}
+		delivered[msg.Seq] = true
+		if appended {
+			m.appended[msg.Seq] = name
+		}
+		messages = append(messages, *msg)
+	}
+
+	sort.Slice(messages, func(i, j int) bool { return messages[i].Seq < messages[j].Seq })
+	return messages, nil
+}
+
+// Ack marks every message up to seq as read and deletes them from the meeting point
+func (m *Mailbox) Ack(seq uint64) error {
+	if seq < m.nextRecv {
+		return errors.New("mailbox: message already acknowledged")
+	}
+	names, err := m.store.List(m.id)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if s, ok := parseRecordName(name, m.peerTag); ok && s <= seq {
+			if err := m.store.Delete(m.id, name); err != nil && err != rendezvous.ErrNotFound {
+				return err
+			}
+		}
+	}
+	for s, name := range m.appended {
+		if s <= seq {
+			if err := m.store.Delete(m.id, name); err != nil && err != rendezvous.ErrNotFound {
+				return err
+			}
+			delete(m.appended, s)
+		}
+	}
+	m.nextRecv = seq + 1
+
+	return nil
+}
+
+// Open a message of the contact. Its sequence number is read from the sealed header.
+func (m *Mailbox) open(data []byte) (*Message, error) {
+	e, err := envelope.Open(m.keys.Receive, data)
+	if err != nil {
+		return nil, err
+	}
+	if e.Type != envelope.Message || e.Epoch != m.epoch {
+		return nil, errors.New("mailbox: not a message")
+	}
+	payload := e.Payload
+	if m.signer != nil {
+		if payload, err = m.signer.Verify(payload); err != nil {
+			return nil, err
+		}
+	}
+	if len(payload) < headerSize || hex.EncodeToString(payload[16:headerSize]) != m.peerTag {
+		return nil, errors.New("mailbox: not a message from the contact")
+	}
+
+	return &Message{
+		Seq:  binary.BigEndian.Uint64(payload),
+		Sent: time.Unix(0, int64(binary.BigEndian.Uint64(payload[8:]))),
+		Body: payload[headerSize:],
+	}, nil
+}
+
+func senderTag(key []byte, sender string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("mailbox"))
+	mac.Write([]byte{0})
+	mac.Write([]byte(sender))
+
+	return hex.EncodeToString(mac.Sum(nil)[:tagSize])
+}
+
+// Sequence numbers are zero-padded so that records list in order
+func recordName(tag string, seq uint64) string {
+	return fmt.Sprintf("%s%s-%016x", recordPrefix, tag, seq)
+}
+
+func parseRecordName(name, tag string) (uint64, bool) {
+	prefix := recordPrefix + tag + "-"
+	if !strings.HasPrefix(name, prefix) {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(name[len(prefix):], 16, 64)
+	return seq, err == nil
+}
@@ -0,0 +1,241 @@
+package mailbox
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nmohnblatt/cd_client/envelope"
+	"github.com/nmohnblatt/cd_client/rendezvous"
+)
+
+// Alice's keys. Bob's are the same with the directions swapped.
+var testKeys = Keys{Send: bytes.Repeat([]byte{1}, 32), Receive: bytes.Repeat([]byte{4}, 32), Name: bytes.Repeat([]byte{2}, 32)}
+
+var peerKeys = Keys{Send: testKeys.Receive, Receive: testKeys.Send, Name: testKeys.Name}
+
+func newPair(store rendezvous.Rendezvous) (*Mailbox, *Mailbox) {
+	id := rendezvous.ID([]byte("meeting point"))
+	return New(store, id, testKeys, 0, "alice", "bob", State{}, nil), New(store, id, peerKeys, 0, "bob", "alice", State{}, nil)
+}
+
+func TestPostListAck(t *testing.T) {
+	store := rendezvous.NewMemory()
+	alice, bob := newPair(store)
+
+	for _, body := range []string{"first", "second", "third"} {
+		if _, err := alice.Post([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if messages, err := alice.List(); err != nil || len(messages) != 0 {
+		t.Errorf("Alice sees her own messages: %v, %v", messages, err)
+	}
+
+	messages, err := bob.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 3 {
+		t.Fatalf("Expected 3 messages, got %d", len(messages))
+	}
+	for i, body := range []string{"first", "second", "third"} {
+		if messages[i].Seq != uint64(i) || string(messages[i].Body) != body {
+			t.Errorf("Message %d: got %d %q", i, messages[i].Seq, messages[i].Body)
+		}
+	}
+
+	// Acknowledged messages are deleted from the meeting point
+	if err := bob.Ack(1); err != nil {
+		t.Fatal(err)
+	}
+	names, _ := store.List(rendezvous.ID([]byte("meeting point")))
+	if len(names) != 1 {
+		t.Errorf("Acknowledged messages were not deleted: %v", names)
+	}
+	messages, _ = bob.List()
+	if len(messages) != 1 || string(messages[0].Body) != "third" {
+		t.Errorf("Wrong messages after ack: %v", messages)
+	}
+	if err := bob.Ack(0); err == nil {
+		t.Errorf("Acknowledged a message twice")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	store := rendezvous.NewMemory()
+	alice, bob := newPair(store)
+	id := rendezvous.ID([]byte("meeting point"))
+
+	if _, err := alice.Post([]byte("once")); err != nil {
+		t.Fatal(err)
+	}
+	name := recordName(alice.ownTag, 0)
+	record, _ := store.Get(id, name)
+
+	if err := bob.Ack(0); err != nil {
+		t.Fatal(err)
+	}
+
+	// The backend puts the record back, then renames it to a fresh sequence number
+	store.Put(id, name, record)
+	if messages, _ := bob.List(); len(messages) != 0 {
+		t.Errorf("Replayed message was delivered")
+	}
+	if _, err := store.Get(id, name); err != rendezvous.ErrNotFound {
+		t.Errorf("Replayed message was not deleted")
+	}
+	store.Put(id, recordName(alice.ownTag, 5), record)
+	if messages, _ := bob.List(); len(messages) != 0 {
+		t.Errorf("Renamed message was delivered")
+	}
+}
+
+func TestState(t *testing.T) {
+	store := rendezvous.NewMemory()
+	alice, bob := newPair(store)
+	id := rendezvous.ID([]byte("meeting point"))
+
+	alice.Post([]byte("before restart"))
+	bob.Ack(0)
+
+	// Both sides restart from their persisted state
+	alice = New(store, id, testKeys, 0, "alice", "bob", alice.State(), nil)
+	bob = New(store, id, peerKeys, 0, "bob", "alice", bob.State(), nil)
+
+	seq, err := alice.Post([]byte("after restart"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq != 1 {
+		t.Errorf("Sequence number was reused: %d", seq)
+	}
+	messages, _ := bob.List()
+	if len(messages) != 1 || string(messages[0].Body) != "after restart" {
+		t.Errorf("Wrong messages after restart: %v", messages)
+	}
+}
+
+func TestForeignRecords(t *testing.T) {
+	store := rendezvous.NewMemory()
+	alice, bob := newPair(store)
+	id := rendezvous.ID([]byte("meeting point"))
+
+	// Envelopes under another key, of another type or another epoch are ignored
+	wrongKey, _ := envelope.Seal(bytes.Repeat([]byte{3}, 32), 0, envelope.Message, make([]byte, headerSize))
+	store.Put(id, recordName(alice.ownTag, 0), wrongKey)
+	wrongType, _ := envelope.Seal(testKeys.Send, 0, envelope.Profile, make([]byte, headerSize))
+	store.Put(id, recordName(alice.ownTag, 1), wrongType)
+	store.Put(id, "confirm-0123", []byte("not a message"))
+
+	if messages, err := bob.List(); err != nil || len(messages) != 0 {
+		t.Errorf("Foreign records were delivered: %v, %v", messages, err)
+	}
+
+	// A message under Bob's name but sealed in Alice's direction is not taken for Bob's
+	reflected := make([]byte, headerSize)
+	tag, _ := hex.DecodeString(bob.ownTag)
+	copy(reflected[16:], tag)
+	sealed, _ := envelope.Seal(testKeys.Send, 0, envelope.Message, reflected)
+	store.Put(id, recordName(bob.ownTag, 0), sealed)
+	if messages, err := alice.List(); err != nil || len(messages) != 0 {
+		t.Errorf("Message sealed in our own direction was delivered: %v, %v", messages, err)
+	}
+
+	rotated := New(store, id, testKeys, 1, "alice", "bob", State{NextSend: 2}, nil)
+	rotated.Post([]byte("next epoch"))
+	if messages, _ := bob.List(); len(messages) != 0 {
+		t.Errorf("Message from another epoch was delivered")
+	}
+}
+
+func TestAppend(t *testing.T) {
+	s := httptest.NewServer(rendezvous.NewServer(rendezvous.DefaultServerConfig))
+	defer s.Close()
+	store := rendezvous.NewHTTP(s.URL)
+	id := store.Authorize(ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize)))
+	alice := New(store, id, testKeys, 0, "alice", "bob", State{}, nil)
+	bob := New(store, id, peerKeys, 0, "bob", "alice", State{}, nil)
+
+	for _, body := range []string{"first", "second"} {
+		if _, err := alice.Post([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names, _ := store.List(id)
+	if len(names) != 2 || names[0] != rendezvous.MailboxPrefix+"0000000000000000" {
+		t.Fatalf("Messages were not appended to the mailbox: %v", names)
+	}
+
+	// A copy of a message appended again is only delivered once
+	record, _ := store.Get(id, names[0])
+	if _, err := store.Append(id, record); err != nil {
+		t.Fatal(err)
+	}
+	messages, err := bob.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || string(messages[0].Body) != "first" || string(messages[1].Body) != "second" {
+		t.Fatalf("Wrong messages: %v", messages)
+	}
+	if err := bob.Ack(1); err != nil {
+		t.Fatal(err)
+	}
+	if messages, _ := bob.List(); len(messages) != 0 {
+		t.Errorf("Acknowledged messages were delivered again: %v", messages)
+	}
+	if names, _ := store.List(id); len(names) != 0 {
+		t.Errorf("Acknowledged messages were not deleted: %v", names)
+	}
+}
+
+// Signs with a MAC under the name of the signer, to stand in for signatures in tests
+type macSigner struct {
+	self, peer string
+}
+
+func (s macSigner) mac(signer string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(signer))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+func (s macSigner) Sign(payload []byte) ([]byte, error) {
+	return append(s.mac(s.self, payload), payload...), nil
+}
+
+func (s macSigner) Verify(signed []byte) ([]byte, error) {
+	if len(signed) < sha256.Size || !hmac.Equal(signed[:sha256.Size], s.mac(s.peer, signed[sha256.Size:])) {
+		return nil, errors.New("bad signature")
+	}
+	return signed[sha256.Size:], nil
+}
+
+func TestSigner(t *testing.T) {
+	store := rendezvous.NewMemory()
+	id := rendezvous.ID([]byte("meeting point"))
+	alice := New(store, id, testKeys, 0, "alice", "bob", State{}, macSigner{"alice", "bob"})
+	bob := New(store, id, peerKeys, 0, "bob", "alice", State{}, macSigner{"bob", "alice"})
+	// Someone who knows the mailbox keys but signs under another name
+	mallory := New(store, id, testKeys, 0, "alice", "bob", State{NextSend: 1}, macSigner{"mallory", "bob"})
+
+	if _, err := alice.Post([]byte("signed")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mallory.Post([]byte("forged")); err != nil {
+		t.Fatal(err)
+	}
+	messages, err := bob.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || string(messages[0].Body) != "signed" {
+		t.Errorf("Wrong messages: %v", messages)
+	}
+}
@@ -14,9 +14,9 @@ import (
 func TestKeyDerivationLocal(t *testing.T) {
 	s1 := newDummyServer(1)
 	// setup three users: Alice, Bob and Charlie
-	alice := newUser("Alice", "07111111111")
-	bob := newUser("Bob", "07222222222")
-	charlie := newUser("Charlie", "07333333333")
+	alice := testUser(t, "Alice", "07111111111")
+	bob := testUser(t, "Bob", "07222222222")
+	charlie := testUser(t, "Charlie", "07333333333")
 
 	alice.obtainPrivateKeys(s1)
 	bob.obtainPrivateKeys(s1)
@@ -24,10 +24,10 @@ func TestKeyDerivationLocal(t *testing.T) {
 
 	// Alice and Bob compute shared keys. Charlie tries to use his key material to find A and B's shared keys
 	// Format xSharedxy = e(H(x)^s, H(y)) i.e. the shared point in GT with x in G1 and y in G2 computed using x's private key
-	aSharedab, aSharedba := deriveSharedKeys(alice, bob.phoneNumber)
-	bSharedba, bSharedab := deriveSharedKeys(bob, alice.phoneNumber)
-	cSharedca, cSharedac := deriveSharedKeys(charlie, alice.phoneNumber)
-	cSharedcb, cSharedbc := deriveSharedKeys(charlie, bob.phoneNumber)
+	aSharedab, aSharedba := deriveSharedKeys(alice.registration, bob.id)
+	bSharedba, bSharedab := deriveSharedKeys(bob.registration, alice.id)
+	cSharedca, cSharedac := deriveSharedKeys(charlie.registration, alice.id)
+	cSharedcb, cSharedbc := deriveSharedKeys(charlie.registration, bob.id)
 
 	// Check that Alice and Bob's computatins match
 	if !aSharedab.Equal(bSharedab) {
@@ -59,9 +59,9 @@ func TestKeyDerivationMultiLocal(t *testing.T) {
 	secret := suite.GT().Scalar().Pick(random.New())
 	serverList, pubPoly1, pubPoly2 := setupThresholdServers(suite, secret, n, thr)
 
-	alice := newUser("Alice", "07111111111")
-	bob := newUser("Bob", "07222222222")
-	charlie := newUser("Charlie", "07333333333")
+	alice := testUser(t, "Alice", "07111111111")
+	bob := testUser(t, "Bob", "07222222222")
+	charlie := testUser(t, "Charlie", "07333333333")
 
 	alice.obtainPrivateKeysBlindThreshold(suite, serverList, pubPoly1, pubPoly2, thr, n)
 	bob.obtainPrivateKeysBlindThreshold(suite, serverList, pubPoly1, pubPoly2, thr, n)
@@ -69,10 +69,10 @@ func TestKeyDerivationMultiLocal(t *testing.T) {
 
 	// Alice and Bob compute shared keys. Charlie tries to use his key material to find A and B's shared keys
 	// Format xSharedxy = e(H(x)^s, H(y)) i.e. the shared point in GT with x in G1 and y in G2 computed using x's private key
-	aSharedab, aSharedba := deriveSharedKeys(alice, bob.phoneNumber)
-	bSharedba, bSharedab := deriveSharedKeys(bob, alice.phoneNumber)
-	cSharedca, cSharedac := deriveSharedKeys(charlie, alice.phoneNumber)
-	cSharedcb, cSharedbc := deriveSharedKeys(charlie, bob.phoneNumber)
+	aSharedab, aSharedba := deriveSharedKeys(alice.registration, bob.id)
+	bSharedba, bSharedab := deriveSharedKeys(bob.registration, alice.id)
+	cSharedca, cSharedac := deriveSharedKeys(charlie.registration, alice.id)
+	cSharedcb, cSharedbc := deriveSharedKeys(charlie.registration, bob.id)
 
 	// Check that Alice and Bob's computatins match
 	if !aSharedab.Equal(bSharedab) {
@@ -96,8 +96,8 @@ func TestKeyDerivationMultiLocal(t *testing.T) {
 
 func TestThresholdG1(t *testing.T) {
 	// Initialise client
-	alice := newUser("Alice", "07111111111")
-	msg := []byte(alice.phoneNumber)
+	alice := testUser(t, "Alice", "07111111111")
+	msg := alice.id.Bytes()
 
 	// Set number of servers and threshold
 	n := 10
@@ -144,8 +144,8 @@ func TestThresholdG1(t *testing.T) {
 
 func TestThresholdG2(t *testing.T) {
 	// Initialise client
-	alice := newUser("Alice", "07111111111")
-	msg := []byte(alice.phoneNumber)
+	alice := testUser(t, "Alice", "07111111111")
+	msg := alice.id.Bytes()
 
 	// Set number of servers and threshold
 	n := 10
@@ -192,7 +192,7 @@ func TestThresholdG2(t *testing.T) {
 
 func TestThresholdUserKeys(t *testing.T) {
 	// Initialise client
-	alice := newUser("Alice", "07111111111")
+	alice := testUser(t, "Alice", "07111111111")
 
 	// Set number of servers and threshold
 	n := 10
@@ -221,7 +221,7 @@ func TestThresholdUserKeys(t *testing.T) {
 
 func TestBlindThresholdUserKeys(t *testing.T) {
 	// Initialise client
-	alice := newUser("Alice", "07111111111")
+	alice := testUser(t, "Alice", "07111111111")
 
 	// Set number of servers and threshold
 	n := 10
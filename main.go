@@ -1,22 +1,55 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 
-	"go.dedis.ch/kyber/v3"
+	"github.com/nmohnblatt/cd_client/addressbook"
+	"github.com/nmohnblatt/cd_client/channel"
+	"github.com/nmohnblatt/cd_client/identifier"
+	"github.com/nmohnblatt/cd_client/ipfsapi"
+	"github.com/nmohnblatt/cd_client/keystore"
+	"github.com/nmohnblatt/cd_client/rendezvous"
 	"go.dedis.ch/kyber/v3/pairing/bn256"
 	"go.dedis.ch/kyber/v3/xof/blake2xb"
+	"golang.org/x/term"
 )
 
 var suite = bn256.NewSuite()
 
 const prompt string = "> "
 
+var stdin = bufio.NewReader(os.Stdin)
+
+var (
+	rendezvousFlag = flag.String("rendezvous", "ipfs", "where meeting points are published: \"ipfs\", \"memory\", the URL of a cd_rendezvous server, or \"dir:\" followed by a directory path")
+	ipfsAPIFlag    = flag.String("ipfs-api", ipfsapi.DefaultURL, "address of the HTTP API of the IPFS daemon")
+	contactsFlag   = flag.String("contacts", "", "address book (.vcf or .csv) to import contacts from, instead of entering a single number")
+	csvColumnsFlag = flag.String("csv-columns", "", "columns of a CSV address book, such as \"name=Nom;phone:mobile=Portable;email=Courriel\", if they are not detected from its header")
+	regionFlag     = flag.String("region", "GB", "region of your phone number if you enter it without a country calling code, such as \"GB\" or \"US\"")
+	discoverFlag   = flag.Bool("discover", false, "ask the contacts of the address book which of your contacts they know, to suggest groups on the next syncs")
+	groupFlag      = flag.String("group", "", "two contacts of the address book, such as \"07222 222222,bob@example.com\", to form a three-party group with")
+	keystoreFlag   = flag.String("keystore", "cd_client.keys", "encrypted file your identifiers and private keys are kept in between runs, empty to fetch keys on every run")
+)
+
 // Create a simple UI
 // User will be able to enter their details and contact lists.
 // Program should find existing rendez-vous points and create new ones where needed.
 func main() {
+	flag.Parse()
+	store, err := openRendezvous(*rendezvousFlag)
+	if err != nil {
+		panic(err)
+	}
+
 	// Setup Phase:
 	n := 10
 	t := n/2 + 1
@@ -26,49 +59,440 @@ func main() {
 	masterSecret := suite.GT().Scalar().Pick(rng)
 	serverList, pubPoly1, pubPoly2 := setupThresholdServers(suite, masterSecret, n, t)
 
-	// Initialise the service's user
-	u1 := initialiseUser()
+	// Restore the service's user from their keystore, or initialise them and communicate with
+	// servers to obtain their private keys
+	var u1 *user
+	if *keystoreFlag != "" {
+		u1, err = loadUser(*keystoreFlag)
+		if err == keystore.ErrDecrypt {
+			fmt.Println(prompt + "Too many wrong passphrases.")
+			os.Exit(1)
+		}
+		if err != nil {
+			panic(err)
+		}
+	}
+	if u1 != nil && !u1.issuedUnder(pubPoly1.Commit(), pubPoly2.Commit()) {
+		// Contacts only meet with keys of the same epoch, so the keys loaded are of no use
+		fmt.Printf(prompt+"Welcome back %s. The servers changed their keys since yours were issued.\n", u1.name)
+		fmt.Printf(prompt+"Fetching new private keys from %d out of %d servers... \n", t, n)
+		if err := u1.obtainPrivateKeysBlindThreshold(suite, serverList[0:t], pubPoly1, pubPoly2, t, n); err != nil {
+			panic(err)
+		}
+		fmt.Println(prompt + "Keys successfully received.")
+		if err := u1.save(); err != nil {
+			fmt.Println(prompt + "Could not save your keys: " + err.Error())
+		}
+	} else if u1 != nil {
+		fmt.Printf(prompt+"Welcome back %s. Keys loaded from %s.\n", u1.name, *keystoreFlag)
+	} else {
+		u1 = initialiseUser(*regionFlag)
+
+		fmt.Printf(prompt+"Fetching private keys from %d out of %d servers... \n", t, n)
+		if err := u1.obtainPrivateKeysBlindThreshold(suite, serverList[0:t], pubPoly1, pubPoly2, t, n); err != nil {
+			panic(err)
+		}
+		fmt.Println(prompt + "Keys successfully received.")
+
+		if *keystoreFlag != "" {
+			if err := saveUser(*keystoreFlag, u1); err != nil {
+				fmt.Println(prompt + "Could not save your keys: " + err.Error())
+			}
+		}
+	}
+
+	if *contactsFlag != "" {
+		// Stop syncing on Ctrl-C, keeping the meeting points established so far. A second
+		// Ctrl-C exits right away.
+		ctx, cancel := context.WithCancel(context.Background())
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		go func() {
+			<-interrupt
+			signal.Stop(interrupt)
+			cancel()
+		}()
+		syncAddressBook(ctx, store, u1, *contactsFlag)
+		cancel()
+		return
+	}
 
-	// Communicate with servers to obtain the user's private keys
-	fmt.Printf(prompt+"Fetching private keys from %d out of %d servers... \n", t, n)
-	u1.obtainPrivateKeysBlindThreshold(suite, serverList[0:t], pubPoly1, pubPoly2, t, n)
-	fmt.Println(prompt + "Keys successfully received.")
+	// Compute shared key material with a manually entered contact, from each of our identifiers
+	candidates := processSingleContactManualInput(u1)
+	if err := u1.saveCache(); err != nil {
+		fmt.Println(prompt + "Could not save the cache of contact keys: " + err.Error())
+	}
 
-	// Compute shared key material with a manually entered contact number
-	sharedAB, sharedBA := processSingleContactManualInput(u1)
-	// fmt.Println(prompt + "Derived the following keys:\n" + sharedAB.String() + "\n" + sharedBA.String())
+	// Publish our confirmations and look for the contact's. We keep the meeting point of the
+	// identifier they registered with.
+	c, found, err := meetPerson(store, u1, candidates)
+	if c == nil {
+		panic(err)
+	}
+
+	mp, cidErr := meetingPointCID(store, c)
+	if cidErr != nil {
+		panic(cidErr)
+	}
+	output := []byte("Meeting point " + mp + "\n")
+	if err := ioutil.WriteFile("mp.txt", output, 0644); err != nil {
+		panic(fmt.Errorf("Could not generate file"))
+	}
 
-	meetingPoint := createMeetingPoint(u1, sharedAB, sharedBA)
-	output := append([]byte("Meeting point "), meetingPoint...)
+	if *rendezvousFlag == "ipfs" {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		goLive(ctx, c)
+	}
+	if err != nil {
+		fmt.Println(prompt + "Could not confirm the meeting point: " + err.Error())
+		return
+	}
+	if !found {
+		fmt.Println(prompt + "Meeting point established. Waiting for your contact to join.")
+		return
+	}
+	fmt.Printf(prompt+"Your contact joined the meeting point. Contact is %s.\n", c.status)
+
+	// Bootstrap an end-to-end encrypted session. The key schedule tells who starts it.
+	established, err := establishSession(store, u1, c)
+	if err != nil {
+		fmt.Println(prompt + "Could not establish a session: " + err.Error())
+		return
+	}
+	if established {
+		fmt.Printf(prompt+"End-to-end encrypted session established (you are the %s).\n", c.schedule.Role())
+	}
+
+	// Use the meeting point as a mailbox
+	messages, err := readMessages(store, u1, c)
+	if err != nil {
+		fmt.Println(prompt + "Could not read messages: " + err.Error())
+		return
+	}
+	for _, m := range messages {
+		fmt.Printf(prompt+"[%s] %s\n", m.Sent.Format("2006-01-02 15:04"), m.Body)
+	}
+	fmt.Println(prompt + "Leave a message for your contact (empty to skip):")
+	text, _ := stdin.ReadString('\n')
+	if text = strings.TrimSpace(text); text != "" {
+		if err := sendMessage(store, u1, c, []byte(text)); err != nil {
+			fmt.Println(prompt + "Could not send message: " + err.Error())
+			return
+		}
+		fmt.Println(prompt + "Message sent.")
+	}
+}
+
+// Import an address book and establish a meeting point with every contact in it, as soon as the
+// shared keys with the contact are derived. Contacts not reached when ctx is cancelled are left
+// for the next sync.
+func syncAddressBook(ctx context.Context, store rendezvous.Rendezvous, u *user, path string) {
+	var mapping *addressbook.CSVMapping
+	if *csvColumnsFlag != "" {
+		var err error
+		if mapping, err = addressbook.ParseCSVMapping(*csvColumnsFlag); err != nil {
+			fmt.Println(prompt + "Could not import contacts: " + err.Error())
+			return
+		}
+	}
+	records, err := readAddressBook(path, mapping)
+	if errs, ok := err.(addressbook.Errors); ok {
+		for _, e := range errs {
+			fmt.Println(prompt + "Skipped " + e.Error())
+		}
+	} else if err != nil {
+		fmt.Println(prompt + "Could not import contacts: " + err.Error())
+		return
+	}
+	contacts, rejected := processContacts(ctx, u, records)
+	for _, err := range rejected {
+		fmt.Println(prompt + "Skipped " + err.Error())
+	}
+
+	var output []byte
+	var met []*contact
+	names := map[string]string{u.id.String(): "you"}
+	imported := 0
+	for c := range contacts {
+		imported++
+		kept, found, err := meetPerson(store, u, c.candidates)
+		if kept == nil {
+			fmt.Printf(prompt+"%s (%s): could not establish the meeting point: %v\n", c.name, c.id.Value, err)
+			continue
+		}
+		c.contact = kept
+		mp, cidErr := meetingPointCID(store, kept)
+		if cidErr != nil {
+			fmt.Printf(prompt+"%s (%s): could not read back the meeting point: %v\n", c.name, c.id.Value, cidErr)
+			continue
+		}
+		output = append(output, c.name+" "+c.id.Value+": meeting point "+mp+"\n"...)
+		switch {
+		case err != nil:
+			fmt.Printf(prompt+"%s (%s): could not confirm the meeting point: %v\n", c.name, c.id.Value, err)
+		case found:
+			fmt.Printf(prompt+"%s (%s) joined the meeting point. Contact is %s.\n", c.name, c.id.Value, c.status)
+			met = append(met, c.contact)
+			names[c.id.String()] = c.name
+		default:
+			fmt.Printf(prompt+"%s (%s): waiting for the contact to join.\n", c.name, c.id.Value)
+		}
+	}
+	if ctx.Err() == nil {
+		discoverMutualContacts(store, u, met, names)
+	}
+	if *groupFlag != "" && ctx.Err() == nil {
+		mp, members, err := formGroup(store, u, met, *groupFlag)
+		switch {
+		case err != nil:
+			fmt.Println(prompt + "Could not form the group: " + err.Error())
+		case mp == "":
+			fmt.Println(prompt + "Group share published. Waiting for the other members to publish theirs.")
+			if *rendezvousFlag == "ipfs" {
+				inviteToGroup(members)
+			}
+		default:
+			fmt.Println(prompt + "Group meeting point " + mp + ".")
+			output = append(output, "Group "+*groupFlag+": meeting point "+mp+"\n"...)
+		}
+	}
+	if err := u.saveCache(); err != nil {
+		fmt.Println(prompt + "Could not save the cache of contact keys: " + err.Error())
+	}
+	if ctx.Err() != nil {
+		fmt.Printf(prompt+"Interrupted after %d contacts.\n", imported)
+	} else {
+		fmt.Printf(prompt+"Imported %d contacts.\n", imported)
+	}
 	if err := ioutil.WriteFile("mp.txt", output, 0644); err != nil {
 		panic(fmt.Errorf("Could not generate file"))
 	}
 }
 
-// A function that promts the user for their name and number.
-// The function returns a pointer to a new user created with the name and number provided.
+// Take part in discoveries of mutual contacts with the contacts met during the sync: answer
+// their requests, show what they found, and collect the answers to our own requests. A new
+// discovery is requested with -discover. Members are shown by their name in names.
+func discoverMutualContacts(store rendezvous.Rendezvous, u *user, met []*contact, names map[string]string) {
+	label := func(id string) string {
+		if name, ok := names[id]; ok {
+			return name
+		}
+		return id
+	}
+
+	if n, err := answerMutualDiscoveryRequests(store, u, met); err != nil {
+		fmt.Println(prompt + "Could not answer requests for mutual contacts: " + err.Error())
+	} else if n > 0 {
+		fmt.Printf(prompt+"Answered %d requests for mutual contacts.\n", n)
+	}
+	for _, c := range met {
+		edges, err := readMutualView(store, u, c)
+		if err != nil {
+			fmt.Printf(prompt+"Could not read the mutual contacts found by %s: %v\n", label(c.id.String()), err)
+			continue
+		}
+		for _, e := range edges {
+			other := e.A
+			if other == c.local.id.String() {
+				other = e.B
+			}
+			if other != c.id.String() {
+				fmt.Printf(prompt+"You and %s both know %s.\n", label(c.id.String()), label(other))
+			}
+		}
+	}
+
+	g, err := collectMutualDiscovery(store, u, met)
+	if err != nil {
+		fmt.Println(prompt + "Could not collect mutual contacts: " + err.Error())
+	} else if g != nil {
+		for _, roster := range g.Rosters(3) {
+			var members []string
+			for _, m := range roster {
+				members = append(members, label(m))
+			}
+			fmt.Println(prompt + "Suggested group: " + strings.Join(members, ", ") + ".")
+		}
+	}
+
+	if *discoverFlag {
+		if err := requestMutualDiscovery(store, u, met); err != nil {
+			fmt.Println(prompt + "Could not ask for mutual contacts: " + err.Error())
+			return
+		}
+		fmt.Printf(prompt+"Asked %d contacts which of your contacts they know. Groups are suggested once they synced.\n", len(met))
+	}
+}
+
+// Form the three-party group given as two identifiers separated by a comma with contacts met
+// during the sync. Returns the ID of the group meeting point, which holds no content yet to
+// address by CID, or "" until both contacts published their share of the group, along with the
+// two members.
+func formGroup(store rendezvous.Rendezvous, u *user, met []*contact, spec string) (string, []*contact, error) {
+	ids := strings.Split(spec, ",")
+	if len(ids) != 2 {
+		return "", nil, errors.New("expected two contacts separated by a comma")
+	}
+	var members []*contact
+	for _, s := range ids {
+		id, err := identifier.Parse(s, u.region)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %v", strings.TrimSpace(s), err)
+		}
+		var member *contact
+		for _, c := range met {
+			if c.id == id {
+				member = c
+			}
+		}
+		if member == nil {
+			return "", nil, fmt.Errorf("%s %s has not joined its meeting point", id.Kind, id.Value)
+		}
+		members = append(members, member)
+	}
+	schedule, err := meetGroup(store, u, members[0], members[1])
+	if err != nil || schedule == nil {
+		return "", members, err
+	}
+	return rendezvous.ID(schedule.MeetingPoint()), members, nil
+}
+
+// Tell the contact we are online through the live channel, and report what they send on it
+// until ctx is cancelled. Requires pubsub to be enabled on the IPFS daemon, so failures are
+// reported but not fatal.
+func goLive(ctx context.Context, c *contact) {
+	ch, err := openLiveChannel(channel.NewIPFSPubSub(ipfsapi.NewClient(*ipfsAPIFlag)), c)
+	if err == nil {
+		err = watchLiveChannel(ctx, ch, reportFrame)
+	}
+	if err != nil {
+		fmt.Println(prompt + "Live channel unavailable: " + err.Error())
+	}
+}
+
+// Show a frame received from the contact on the live channel. Stream frames belong to
+// encrypted streams and are not shown.
+func reportFrame(f channel.Frame) {
+	switch f.Type {
+	case channel.Presence:
+		fmt.Println(prompt + "Your contact is online.")
+	case channel.Invite:
+		other, err := openGroupInvite(f)
+		if err != nil {
+			return
+		}
+		fmt.Printf(prompt+"Your contact invites you to a group with %s %s. Sync your address book with -group to join.\n", other.Kind, other.Value)
+	case channel.Message:
+		fmt.Printf(prompt+"[%s] %s\n", f.Sent.Format("2006-01-02 15:04"), f.Payload)
+	}
+}
+
+// Invite each member of a group we are forming through their live channel, in case they are
+// online, so that they form the group too without waiting for their next sync
+func inviteToGroup(members []*contact) {
+	ps := channel.NewIPFSPubSub(ipfsapi.NewClient(*ipfsAPIFlag))
+	for i, c := range members {
+		ch, err := openLiveChannel(ps, c)
+		if err == nil {
+			err = sendGroupInvite(ch, members[1-i].id)
+		}
+		if err != nil {
+			fmt.Println(prompt + "Live channel unavailable: " + err.Error())
+			return
+		}
+	}
+}
+
+// Open the rendezvous backend selected on the command line. Directories are given with a
+// "dir:" prefix, which creates them if needed, or as the path of an existing directory, so that
+// a mistyped backend name is not taken for a new directory.
+func openRendezvous(spec string) (rendezvous.Rendezvous, error) {
+	switch spec {
+	case "ipfs":
+		return rendezvous.NewIPFS(*ipfsAPIFlag), nil
+	case "memory":
+		return rendezvous.NewMemory(), nil
+	}
+	if strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://") {
+		return rendezvous.NewHTTP(spec), nil
+	}
+	if strings.HasPrefix(spec, "dir:") {
+		return rendezvous.NewDir(strings.TrimPrefix(spec, "dir:"))
+	}
+	if info, err := os.Stat(spec); err == nil && info.IsDir() {
+		return rendezvous.NewDir(spec)
+	}
+	return nil, errors.New("unknown rendezvous " + strconv.Quote(spec) + ": expected \"ipfs\", \"memory\", an http(s) URL, \"dir:\" followed by a path or an existing directory")
+}
+
+// A function that promts the user for their name and identifiers.
+// The function returns a pointer to a new user created with the name and identifiers provided.
+// Identifiers that are not valid are explained and asked again.
+// Phone numbers without a country calling code are read in region.
 // Public keys are automatically computed. Private keys will need to be fetched from server
-func initialiseUser() *user {
+func initialiseUser(region string) *user {
 	fmt.Println(prompt + "Initialising. Please enter your name:")
-	var Name string
-	fmt.Scanf("%s", &Name)
-	fmt.Printf(prompt+"Thank you %s. Please enter your phone number:\n", Name)
-	var Number string
-	fmt.Scanf("%s", &Number)
-	u1 := newUser(Name, Number)
-	fmt.Println(prompt + "You have been registered as a user.")
+	Name := readLine()
+	fmt.Printf(prompt+"Thank you %s. Please enter your phone number, email address or username:\n", Name)
+	var u1 *user
+	for u1 == nil {
+		var err error
+		if u1, err = newUser(Name, readLine(), region); err != nil {
+			fmt.Println(prompt + "Invalid identifier, " + err.Error() + ". Please enter your phone number, email address or username:")
+		}
+	}
+	fmt.Printf(prompt+"You have been registered as a user with %s %s.\n", u1.id.Kind, u1.id.Value)
 
+	fmt.Println(prompt + "Enter any other phone number, email address or username of yours (empty when done):")
+	for ID := readLine(); ID != ""; ID = readLine() {
+		if err := u1.addIdentifier(ID); err != nil {
+			fmt.Println(prompt + "Invalid identifier, " + err.Error() + ".")
+			continue
+		}
+		r := u1.registrations[len(u1.registrations)-1]
+		fmt.Printf(prompt+"Also registered with %s %s.\n", r.id.Kind, r.id.Value)
+	}
 	return u1
 }
 
-// A function that prompts the user for their contact's phone number.
-// The function computes the contact's corresponding public key and derives shared keys
-func processSingleContactManualInput(u *user) (kyber.Point, kyber.Point) {
-	fmt.Println(prompt + "Enter your contact's phone number:")
-	var contactNumber string
-	fmt.Scanf("%s", &contactNumber)
+// A function that prompts the user for their contact's phone number, email address or username.
+// The function computes the contact's corresponding public key and derives shared keys from
+// each of the user's identifiers
+func processSingleContactManualInput(u *user) []*contact {
+	fmt.Println(prompt + "Enter your contact's phone number, email address or username:")
+	for {
+		id, err := identifier.Parse(readLine(), u.region)
+		if err == nil {
+			if candidates := contactCandidates(u, []identifier.Identifier{id}); len(candidates) > 0 {
+				return candidates
+			}
+			err = errors.New("this is one of your own identifiers")
+		}
+		fmt.Println(prompt + "Invalid identifier, " + err.Error() + ". Enter your contact's phone number, email address or username:")
+	}
+}
 
-	sharedAB, sharedBA := deriveSharedKeys(u, contactNumber)
+// Read a line from the terminal. Numbers are often typed with spaces. Panics once the input
+// is closed, as the prompts cannot carry on without an answer.
+func readLine() string {
+	text, err := stdin.ReadString('\n')
+	if err != nil && text == "" {
+		panic(err)
+	}
+	return strings.TrimSpace(text)
+}
 
-	return sharedAB, sharedBA
+// Read a passphrase without echoing it, or a line if the input is not a terminal
+func readPassphrase() []byte {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return []byte(readLine())
+	}
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		panic(err)
+	}
+	return passphrase
 }
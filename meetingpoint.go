@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/nmohnblatt/cd_client/envelope"
+	"github.com/nmohnblatt/cd_client/identifier"
+	"github.com/nmohnblatt/cd_client/rendezvous"
+)
+
+// Kinds of records written at a meeting point
+const recordConfirmation = "confirm"
+
+// Name of a record of the given kind written by sender. The rendezvous backend sees the
+// meeting-point ID, so names are keyed to prevent it from guessing the numbers involved. A kind
+// may name what the record is about after a slash, as in "group/<roster>": only the part
+// before the slash appears in clear.
+func recordName(c *contact, kind, sender string) string {
+	mac := hmac.New(sha256.New, c.schedule.RecordNameKey())
+	mac.Write([]byte(kind))
+	mac.Write([]byte{0})
+	mac.Write([]byte(sender))
+
+	if i := strings.IndexByte(kind, '/'); i >= 0 {
+		kind = kind[:i]
+	}
+	return kind + "-" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// Keys of the envelopes we post and of those the contact posts. Each direction has its own key,
+// so that our records are never taken for the contact's. Schedules without directional values
+// seal both directions under the envelope key.
+func envelopeKeys(c *contact) (send, receive []byte) {
+	if send, receive = c.schedule.SendKey(), c.schedule.ReceiveKey(); send == nil {
+		key := c.schedule.EnvelopeKey()
+		return key, key
+	}
+	return send, receive
+}
+
+// Seal content posted at the meeting point in an envelope keyed from the contact secret
+func sealEnvelope(c *contact, t envelope.Type, payload []byte) ([]byte, error) {
+	send, _ := envelopeKeys(c)
+	return envelope.Seal(send, c.epoch, t, payload)
+}
+
+// Open an envelope posted by the contact and check that it carries content of type t
+func openEnvelope(c *contact, t envelope.Type, data []byte) ([]byte, error) {
+	_, receive := envelopeKeys(c)
+	return openEnvelopeWith(receive, c, t, data)
+}
+
+func openEnvelopeWith(key []byte, c *contact, t envelope.Type, data []byte) ([]byte, error) {
+	e, err := envelope.Open(key, data)
+	if err != nil {
+		return nil, err
+	}
+	if e.Epoch != c.epoch {
+		return nil, errors.New("meeting point: envelope from another key epoch")
+	}
+	if e.Type != t {
+		return nil, errors.New("meeting point: unexpected " + e.Type.String() + " envelope")
+	}
+	return e.Payload, nil
+}
+
+// Sign content, seal it in an envelope and write it at the meeting point under our record of
+// the given kind
+func putSigned(store rendezvous.Rendezvous, u *user, c *contact, kind string, t envelope.Type, content []byte) error {
+	signed, err := signPost(c.local, content)
+	if err != nil {
+		return err
+	}
+	post, err := sealEnvelope(c, t, signed)
+	if err != nil {
+		return err
+	}
+	return store.Put(meetingPointID(store, c), recordName(c, kind, c.local.id.String()), post)
+}
+
+// Read the contact's record of the given kind and check that they signed it
+func getSigned(store rendezvous.Rendezvous, u *user, c *contact, kind string, t envelope.Type) ([]byte, error) {
+	return getSignedBy(store, u, c, c.id, kind, t)
+}
+
+// Read back our own record of the given kind, as written by putSigned
+func getOwnSigned(store rendezvous.Rendezvous, u *user, c *contact, kind string, t envelope.Type) ([]byte, error) {
+	return getSignedBy(store, u, c, c.local.id, kind, t)
+}
+
+func getSignedBy(store rendezvous.Rendezvous, u *user, c *contact, sender identifier.Identifier, kind string, t envelope.Type) ([]byte, error) {
+	post, err := store.Get(meetingPointID(store, c), recordName(c, kind, sender.String()))
+	if err != nil {
+		return nil, err
+	}
+	key, receive := envelopeKeys(c)
+	if sender != c.local.id {
+		key = receive
+	}
+	signed, err := openEnvelopeWith(key, c, t, post)
+	if err != nil {
+		return nil, err
+	}
+	return verifyPost(u, sender, signed)
+}
+
+// Establish the meeting point with a contact by publishing our signed confirmation tag
+func establishMeetingPoint(store rendezvous.Rendezvous, u *user, c *contact) error {
+	if err := putSigned(store, u, c, recordConfirmation, envelope.KeyConfirmation, c.confirmationTag()); err != nil {
+		return err
+	}
+	if err := syncMeetingPoint(store, c); err != nil {
+		return err
+	}
+	c.confirmationPosted()
+
+	return nil
+}
+
+// Establish the meeting points with every candidate contact of one person and keep one the
+// person joined too, so that we keep a single meeting point per person. When the person joined
+// several, both sides keep the lowest one, whatever order they listed each other's identifiers
+// in. Returns the first candidate and false if the person has not joined any yet.
+func meetPerson(store rendezvous.Rendezvous, u *user, candidates []*contact) (*contact, bool, error) {
+	if len(candidates) == 0 {
+		return nil, false, errors.New("meeting point: no identifier to meet")
+	}
+	for _, c := range candidates {
+		if err := establishMeetingPoint(store, u, c); err != nil {
+			return nil, false, err
+		}
+	}
+	// A confirmation that does not check out at one meeting point does not rule out the others
+	var kept *contact
+	var firstErr error
+	for _, c := range candidates {
+		found, err := checkMeetingPoint(store, u, c)
+		if found && (kept == nil || bytes.Compare(c.meetingPoint, kept.meetingPoint) < 0) {
+			kept = c
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if kept != nil {
+		return kept, true, nil
+	}
+	return candidates[0], false, firstErr
+}
+
+// Return the ID of the meeting point with a contact. On backends that require proof of
+// knowledge of the write key, the ID is that of the write key and writes under it are authorized.
+func meetingPointID(store rendezvous.Rendezvous, c *contact) string {
+	if a, ok := store.(rendezvous.Authorizer); ok {
+		return a.Authorize(c.schedule.WriteKey())
+	}
+	return rendezvous.ID(c.meetingPoint)
+}
+
+// Exchange records with the contact on backends where they must be published explicitly
+func syncMeetingPoint(store rendezvous.Rendezvous, c *contact) error {
+	if p, ok := store.(rendezvous.Publisher); ok {
+		return p.Sync(rendezvous.ID(c.meetingPoint), c.schedule.IPNSKey())
+	}
+	return nil
+}
+
+// Check whether the contact has established the meeting point too. Returns false if the
+// contact has not posted yet, and an error if their confirmation does not check out.
+func checkMeetingPoint(store rendezvous.Rendezvous, u *user, c *contact) (bool, error) {
+	if err := syncMeetingPoint(store, c); err != nil {
+		return false, err
+	}
+	tag, err := getSigned(store, u, c, recordConfirmation, envelope.KeyConfirmation)
+	if err == rendezvous.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := c.checkConfirmation(tag); err != nil {
+		return false, errors.New("meeting point: " + err.Error())
+	}
+
+	return true, nil
+}
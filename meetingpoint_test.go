@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nmohnblatt/cd_client/envelope"
+	"github.com/nmohnblatt/cd_client/ipfsapi/ipfstest"
+	"github.com/nmohnblatt/cd_client/keyschedule"
+	"github.com/nmohnblatt/cd_client/rendezvous"
+	"go.dedis.ch/kyber/v3/util/random"
+)
+
+func TestEstablishMeetingPoint(t *testing.T) {
+	store := rendezvous.NewMemory()
+	testEstablishMeetingPoint(t, store, store)
+}
+
+func TestEstablishMeetingPointIPFS(t *testing.T) {
+	// Alice and Bob run their own IPFS node
+	s := ipfstest.NewServer()
+	defer s.Close()
+	peer := s.NewPeer()
+	defer peer.Close()
+
+	testEstablishMeetingPoint(t, rendezvous.NewIPFS(s.URL), rendezvous.NewIPFS(peer.URL))
+}
+
+func TestEstablishMeetingPointHTTP(t *testing.T) {
+	s := httptest.NewServer(rendezvous.NewServer(rendezvous.DefaultServerConfig))
+	defer s.Close()
+
+	testEstablishMeetingPoint(t, rendezvous.NewHTTP(s.URL), rendezvous.NewHTTP(s.URL))
+}
+
+func testEstablishMeetingPoint(t *testing.T, aliceStore, bobStore rendezvous.Rendezvous) {
+	n := 10
+	thr := n/2 + 1
+
+	secret := suite.GT().Scalar().Pick(random.New())
+	serverList, pubPoly1, pubPoly2 := setupThresholdServers(suite, secret, n, thr)
+
+	alice := testUser(t, "Alice", "07111111111")
+	bob := testUser(t, "Bob", "07222222222")
+	for _, u := range []*user{alice, bob} {
+		if err := u.obtainPrivateKeysBlindThreshold(suite, serverList[:thr], pubPoly1, pubPoly2, thr, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	aliceView := newContact(alice, bob.id)
+	bobView := newContact(bob, alice.id)
+
+	if err := establishMeetingPoint(aliceStore, alice, aliceView); err != nil {
+		t.Fatal(err)
+	}
+	found, err := checkMeetingPoint(aliceStore, alice, aliceView)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found {
+		t.Errorf("Alice found a confirmation before Bob posted")
+	}
+
+	if err := establishMeetingPoint(bobStore, bob, bobView); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		u     *user
+		c     *contact
+		store rendezvous.Rendezvous
+	}{{bob, bobView, bobStore}, {alice, aliceView, aliceStore}} {
+		found, err := checkMeetingPoint(tc.store, tc.u, tc.c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !found || tc.c.status != contactConfirmed {
+			t.Errorf("%s did not confirm the meeting point", tc.u.name)
+		}
+	}
+
+	names, err := aliceStore.List(meetingPointID(aliceStore, aliceView))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 {
+		t.Errorf("Expected two records at the meeting point, got %v", names)
+	}
+}
+
+// A backend that refuses writes
+type readOnlyStore struct {
+	rendezvous.Rendezvous
+}
+
+func (readOnlyStore) Put(id, name string, data []byte) error {
+	return errors.New("read only")
+}
+
+func TestEstablishMeetingPointFailedPost(t *testing.T) {
+	secret := suite.GT().Scalar().Pick(random.New())
+	serverList, pubPoly1, pubPoly2 := setupThresholdServers(suite, secret, 3, 2)
+	alice := testUser(t, "Alice", "07111111111")
+	bob := testUser(t, "Bob", "07222222222")
+	for _, u := range []*user{alice, bob} {
+		if err := u.obtainPrivateKeysThreshold(suite, serverList[:2], pubPoly1, pubPoly2, 2, 3); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store := rendezvous.NewMemory()
+	aliceView := newContact(alice, bob.id)
+	if err := establishMeetingPoint(store, bob, newContact(bob, alice.id)); err != nil {
+		t.Fatal(err)
+	}
+	if err := establishMeetingPoint(readOnlyStore{store}, alice, aliceView); err == nil {
+		t.Fatal("Posting to a read-only store succeeded")
+	}
+	// Alice reads Bob's tag, but Bob never got hers
+	if found, err := checkMeetingPoint(store, alice, aliceView); err != nil || !found {
+		t.Fatalf("Alice did not find Bob's confirmation: %v", err)
+	}
+	if aliceView.status != contactPending {
+		t.Errorf("Alice confirmed Bob without posting her tag")
+	}
+}
+
+func TestOpenEnvelope(t *testing.T) {
+	c := &contact{schedule: keyschedule.New([]byte("key material")), epoch: 2}
+
+	data, err := sealEnvelope(c, envelope.Message, []byte("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload, err := openEnvelope(c, envelope.Message, data); err != nil || string(payload) != "hi" {
+		t.Errorf("Could not open envelope: %v", err)
+	}
+	if _, err := openEnvelope(c, envelope.KeyConfirmation, data); err == nil {
+		t.Errorf("Opened an envelope of the wrong type")
+	}
+
+	rotated := &contact{schedule: c.schedule, epoch: 3}
+	if _, err := openEnvelope(rotated, envelope.Message, data); err == nil {
+		t.Errorf("Opened an envelope from another epoch")
+	}
+}
+
+func TestOpenEnvelopeDirection(t *testing.T) {
+	s1 := newDummyServer(1)
+	alice := testUser(t, "Alice", "07111111111")
+	bob := testUser(t, "Bob", "07222222222")
+	alice.obtainPrivateKeys(s1)
+	bob.obtainPrivateKeys(s1)
+	aliceView, bobView := newContact(alice, bob.id), newContact(bob, alice.id)
+
+	data, err := sealEnvelope(aliceView, envelope.Message, []byte("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload, err := openEnvelope(bobView, envelope.Message, data); err != nil || string(payload) != "hi" {
+		t.Errorf("Bob could not open Alice's envelope: %v", err)
+	}
+	// Alice's envelopes cannot be passed off to her as Bob's
+	if _, err := openEnvelope(aliceView, envelope.Message, data); err == nil {
+		t.Errorf("Alice opened her own envelope as Bob's")
+	}
+}
+
+func TestOpenRendezvous(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cd_client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, spec := range []string{"memory", "http://127.0.0.1:8080", dir, "dir:" + filepath.Join(dir, "new")} {
+		if _, err := openRendezvous(spec); err != nil {
+			t.Errorf("%q: %v", spec, err)
+		}
+	}
+	for _, spec := range []string{"ipfss", filepath.Join(dir, "missing")} {
+		if _, err := openRendezvous(spec); err == nil {
+			t.Errorf("%q was taken for a directory", spec)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("Created a directory for an unknown rendezvous")
+	}
+}
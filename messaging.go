@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/nmohnblatt/cd_client/mailbox"
+	"github.com/nmohnblatt/cd_client/rendezvous"
+)
+
+// Mailbox message bodies start with a byte telling how the rest is encrypted
+const (
+	// Only sealed under the envelope key of the meeting point
+	messagePlain byte = iota
+	// Additionally encrypted with the double ratchet of the session with the contact
+	messageSession
+)
+
+// Open our side of the mailbox at the meeting point with a contact
+func openMailbox(store rendezvous.Rendezvous, u *user, c *contact) (*mailbox.Mailbox, error) {
+	return openContactMailbox(store, u, c, "", c.mailbox)
+}
+
+// Open a mailbox at the meeting point with a contact. Mailboxes with different suffixes use
+// different record names, so their messages do not mix.
+func openContactMailbox(store rendezvous.Rendezvous, u *user, c *contact, suffix string, state mailbox.State) (*mailbox.Mailbox, error) {
+	if c.status != contactConfirmed {
+		return nil, errors.New("mailbox: contact is not confirmed")
+	}
+	send, receive := envelopeKeys(c)
+	keys := mailbox.Keys{Send: send, Receive: receive, Name: c.schedule.RecordNameKey()}
+	signer := &postSigner{u: u, c: c}
+	return mailbox.New(store, meetingPointID(store, c), keys, c.epoch, c.local.id.String()+suffix, c.id.String()+suffix, state, signer), nil
+}
+
+// Signs mailbox messages like posts, under the identifier the contact knows us by, and checks
+// that the contact's were signed under theirs
+type postSigner struct {
+	u *user
+	c *contact
+}
+
+func (s *postSigner) Sign(payload []byte) ([]byte, error) {
+	return signPost(s.c.local, payload)
+}
+
+func (s *postSigner) Verify(signed []byte) ([]byte, error) {
+	return verifyPost(s.u, s.c.id, signed)
+}
+
+// Leave a message for a contact at our meeting point. Once a session is established with the
+// contact, messages are encrypted with its double ratchet for forward secrecy.
+func sendMessage(store rendezvous.Rendezvous, u *user, c *contact, body []byte) error {
+	m, err := openMailbox(store, u, c)
+	if err != nil {
+		return err
+	}
+	payload := append([]byte{messagePlain}, body...)
+	if c.session != nil {
+		ct, err := c.session.Encrypt(body)
+		if err != nil {
+			return err
+		}
+		// The message key is used up whether or not the message gets posted
+		if err := u.saveSession(c); err != nil {
+			return err
+		}
+		payload = append([]byte{messageSession}, ct...)
+	}
+	if _, err := m.Post(payload); err != nil {
+		return err
+	}
+	c.mailbox = m.State()
+	if err := u.saveSession(c); err != nil {
+		return err
+	}
+
+	return syncMeetingPoint(store, c)
+}
+
+// Fetch the messages the contact left at our meeting point. Messages are delivered in order
+// and deleted once read. Those following a message that has not arrived yet, or a session
+// message that does not decrypt yet, are kept for the next read.
+func readMessages(store rendezvous.Rendezvous, u *user, c *contact) ([]mailbox.Message, error) {
+	if err := syncMeetingPoint(store, c); err != nil {
+		return nil, err
+	}
+	m, err := openMailbox(store, u, c)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []mailbox.Message
+	for _, msg := range inOrder(messages, m.State().NextReceive) {
+		body, err := decryptMessage(store, u, c, msg.Body)
+		if err != nil {
+			break
+		}
+		msg.Body = body
+		out = append(out, msg)
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	if err := m.Ack(out[len(out)-1].Seq); err != nil {
+		return nil, err
+	}
+	c.mailbox = m.State()
+	if err := u.saveSession(c); err != nil {
+		return nil, err
+	}
+
+	return out, syncMeetingPoint(store, c)
+}
+
+// Keep the run of messages numbered from next on, up to the first missing one. Acknowledging
+// a message acknowledges every earlier one, so later messages must wait for the gap to fill.
+func inOrder(messages []mailbox.Message, next uint64) []mailbox.Message {
+	n := 0
+	for n < len(messages) && messages[n].Seq == next+uint64(n) {
+		n++
+	}
+	return messages[:n]
+}
+
+func decryptMessage(store rendezvous.Rendezvous, u *user, c *contact, body []byte) ([]byte, error) {
+	if len(body) == 0 {
+		return nil, errors.New("mailbox: empty message")
+	}
+	switch body[0] {
+	case messagePlain:
+		return body[1:], nil
+	case messageSession:
+		// The first session message may arrive before we looked for the contact's handshake
+		if c.session == nil {
+			if _, err := acceptSession(store, u, c); err != nil {
+				return nil, err
+			}
+		}
+		if c.session == nil {
+			return nil, errors.New("mailbox: no session with the contact")
+		}
+		return c.session.Decrypt(body[1:])
+	default:
+		return nil, errors.New("mailbox: unknown message encryption")
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nmohnblatt/cd_client/ipfsapi/ipfstest"
+	"github.com/nmohnblatt/cd_client/mailbox"
+	"github.com/nmohnblatt/cd_client/rendezvous"
+)
+
+func TestMessaging(t *testing.T) {
+	store := rendezvous.NewMemory()
+	testMessaging(t, store, store)
+}
+
+func TestMessagingHTTP(t *testing.T) {
+	s := httptest.NewServer(rendezvous.NewServer(rendezvous.DefaultServerConfig))
+	defer s.Close()
+
+	testMessaging(t, rendezvous.NewHTTP(s.URL), rendezvous.NewHTTP(s.URL))
+}
+
+func TestMessagingIPFS(t *testing.T) {
+	s := ipfstest.NewServer()
+	defer s.Close()
+	peer := s.NewPeer()
+	defer peer.Close()
+
+	testMessaging(t, rendezvous.NewIPFS(s.URL), rendezvous.NewIPFS(peer.URL))
+}
+
+func testMessaging(t *testing.T, aliceStore, bobStore rendezvous.Rendezvous) {
+	alice := testUser(t, "Alice", "07111111111")
+	bob := testUser(t, "Bob", "07222222222")
+	users := []*user{alice, bob}
+	issueKeys(t, users...)
+
+	// Messages cannot be left before key confirmation
+	if err := sendMessage(aliceStore, alice, newContact(alice, bob.id), []byte("too early")); err == nil {
+		t.Errorf("Sent a message to a pending contact")
+	}
+
+	contacts := confirmAll(t, users, [][2]int{{0, 1}})
+	aliceView, bobView := contacts[alice][0], contacts[bob][0]
+
+	for _, body := range []string{"hello", "are you there?"} {
+		if err := sendMessage(aliceStore, alice, aliceView, []byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	messages, err := readMessages(bobStore, bob, bobView)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || string(messages[0].Body) != "hello" || string(messages[1].Body) != "are you there?" {
+		t.Fatalf("Wrong messages: %v", messages)
+	}
+
+	// Messages are read once
+	if messages, err := readMessages(bobStore, bob, bobView); err != nil || len(messages) != 0 {
+		t.Errorf("Messages were delivered twice: %v, %v", messages, err)
+	}
+
+	if err := sendMessage(bobStore, bob, bobView, []byte("yes")); err != nil {
+		t.Fatal(err)
+	}
+	messages, err = readMessages(aliceStore, alice, aliceView)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || string(messages[0].Body) != "yes" {
+		t.Errorf("Wrong reply: %v", messages)
+	}
+}
+
+func TestMessagingOutOfOrder(t *testing.T) {
+	store := rendezvous.NewMemory()
+	alice := testUser(t, "Alice", "07111111111")
+	bob := testUser(t, "Bob", "07222222222")
+	users := []*user{alice, bob}
+	issueKeys(t, users...)
+	contacts := confirmAll(t, users, [][2]int{{0, 1}})
+	aliceView, bobView := contacts[alice][0], contacts[bob][0]
+
+	// Alice's messages reach the meeting point out of order, the second one last
+	post := func(seq uint64, body string) {
+		m, err := openContactMailbox(store, alice, aliceView, "", mailbox.State{NextSend: seq})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.Post(append([]byte{messagePlain}, body...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	post(0, "first")
+	post(2, "third")
+
+	messages, err := readMessages(store, bob, bobView)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || string(messages[0].Body) != "first" {
+		t.Fatalf("Wrong messages before the gap: %v", messages)
+	}
+
+	post(1, "second")
+	messages, err = readMessages(store, bob, bobView)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || string(messages[0].Body) != "second" || string(messages[1].Body) != "third" {
+		t.Errorf("Wrong messages once the gap filled: %v", messages)
+	}
+}
+
+func TestMessagingForged(t *testing.T) {
+	store := rendezvous.NewMemory()
+	alice := testUser(t, "Alice", "07111111111")
+	bob := testUser(t, "Bob", "07222222222")
+	mallory := testUser(t, "Mallory", "07333333333")
+	users := []*user{alice, bob}
+	issueKeys(t, append(users, mallory)...)
+	contacts := confirmAll(t, users, [][2]int{{0, 1}})
+	aliceView, bobView := contacts[alice][0], contacts[bob][0]
+
+	// Mallory learned the meeting point and posts as Alice, but signs under her own identifier
+	forged := *aliceView
+	forged.local = mallory.registration
+	send, receive := envelopeKeys(aliceView)
+	keys := mailbox.Keys{Send: send, Receive: receive, Name: aliceView.schedule.RecordNameKey()}
+	m := mailbox.New(store, meetingPointID(store, aliceView), keys, aliceView.epoch, alice.id.String(), bob.id.String(), mailbox.State{}, &postSigner{u: mallory, c: &forged})
+	if _, err := m.Post(append([]byte{messagePlain}, "forged"...)); err != nil {
+		t.Fatal(err)
+	}
+
+	if messages, err := readMessages(store, bob, bobView); err != nil || len(messages) != 0 {
+		t.Errorf("Forged message was delivered: %v, %v", messages, err)
+	}
+}
@@ -0,0 +1,215 @@
+// Package mutual lets a user discover which of their contacts know each other, in order to
+// suggest group rosters.
+//
+// The coordinator sends a fresh session identifier to each of its contacts through their
+// meeting point. Every contact answers with one tag per confirmed contact of theirs, where
+// tag = HMAC(k, session) and k is a key derived from the meeting point of that pair. Two
+// contacts who know each other compute the same tag, so the coordinator learns that edge when
+// their tags collide. All other tags are pseudorandom, unlinkable across sessions, and
+// responses are padded with random tags so that their size does not leak the number of contacts.
+//
+// The coordinator only learns edges between its own contacts, and each member is then only
+// sent the edges they are part of.
+package mutual
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"sort"
+)
+
+// TagSize is the size in bytes of a discovery tag
+const TagSize = sha256.Size
+
+// SessionSize is the size in bytes of a session identifier
+const SessionSize = 32
+
+// Edge records that two members know each other. Members are sorted: A < B.
+type Edge struct {
+	A, B string
+}
+
+// Response holds the tags returned by a contact of the coordinator
+type Response struct {
+	Member string
+	Tags   [][]byte
+}
+
+// NewSession returns a fresh random session identifier
+func NewSession() ([]byte, error) {
+	session := make([]byte, SessionSize)
+	if _, err := rand.Read(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Tag computes the discovery tag of a pair of contacts for the given session
+func Tag(pairKey, session []byte) []byte {
+	mac := hmac.New(sha256.New, pairKey)
+	mac.Write(session)
+	return mac.Sum(nil)
+}
+
+// Pad shuffles tags and pads them with random tags up to the next multiple of blockSize
+func Pad(tags [][]byte, blockSize int) ([][]byte, error) {
+	if blockSize <= 0 {
+		return nil, errors.New("mutual: block size must be positive")
+	}
+	size := blockSize
+	for size < len(tags) {
+		size += blockSize
+	}
+
+	padded := make([][]byte, 0, size)
+	padded = append(padded, tags...)
+	for len(padded) < size {
+		dummy := make([]byte, TagSize)
+		if _, err := rand.Read(dummy); err != nil {
+			return nil, err
+		}
+		padded = append(padded, dummy)
+	}
+
+	// Sorting random-looking tags hides the order in which contacts were processed
+	sort.Slice(padded, func(i, j int) bool { return string(padded[i]) < string(padded[j]) })
+
+	return padded, nil
+}
+
+// Graph is the mutual-contact graph computed by a coordinator
+type Graph struct {
+	self string
+	adj  map[string]map[string]bool
+}
+
+// Build computes the mutual-contact graph from the responses of the coordinator's contacts.
+// The coordinator is linked to every responder, and two responders are linked when they
+// returned a common tag.
+func Build(self string, responses []Response) *Graph {
+	g := &Graph{self: self, adj: map[string]map[string]bool{}}
+
+	owner := map[string]string{}
+	for _, r := range responses {
+		g.addEdge(self, r.Member)
+		for _, tag := range r.Tags {
+			other, ok := owner[string(tag)]
+			if ok && other != r.Member {
+				g.addEdge(other, r.Member)
+				continue
+			}
+			owner[string(tag)] = r.Member
+		}
+	}
+
+	return g
+}
+
+func (g *Graph) addEdge(a, b string) {
+	if a == b {
+		return
+	}
+	if g.adj[a] == nil {
+		g.adj[a] = map[string]bool{}
+	}
+	if g.adj[b] == nil {
+		g.adj[b] = map[string]bool{}
+	}
+	g.adj[a][b] = true
+	g.adj[b][a] = true
+}
+
+// Edges returns every edge known to the coordinator
+func (g *Graph) Edges() []Edge {
+	var edges []Edge
+	for a, neighbours := range g.adj {
+		for b := range neighbours {
+			if a < b {
+				edges = append(edges, Edge{a, b})
+			}
+		}
+	}
+	sortEdges(edges)
+	return edges
+}
+
+// View returns the edges that member is part of. This is all a member should be told.
+func (g *Graph) View(member string) []Edge {
+	var edges []Edge
+	for other := range g.adj[member] {
+		if member < other {
+			edges = append(edges, Edge{member, other})
+		} else {
+			edges = append(edges, Edge{other, member})
+		}
+	}
+	sortEdges(edges)
+	return edges
+}
+
+// Rosters suggests groups in which every member knows every other member: the maximal cliques
+// that contain the coordinator and have at least minSize members
+func (g *Graph) Rosters(minSize int) [][]string {
+	var candidates []string
+	for m := range g.adj[g.self] {
+		candidates = append(candidates, m)
+	}
+
+	var rosters [][]string
+	g.bronKerbosch([]string{g.self}, candidates, nil, func(clique []string) {
+		if len(clique) >= minSize {
+			roster := make([]string, len(clique))
+			copy(roster, clique)
+			sort.Strings(roster)
+			rosters = append(rosters, roster)
+		}
+	})
+
+	sort.Slice(rosters, func(i, j int) bool {
+		if len(rosters[i]) != len(rosters[j]) {
+			return len(rosters[i]) > len(rosters[j])
+		}
+		for k := range rosters[i] {
+			if rosters[i][k] != rosters[j][k] {
+				return rosters[i][k] < rosters[j][k]
+			}
+		}
+		return false
+	})
+	return rosters
+}
+
+// Enumerate the maximal cliques extending r with vertices from p, excluding those in x
+func (g *Graph) bronKerbosch(r, p, x []string, report func([]string)) {
+	if len(p) == 0 && len(x) == 0 {
+		report(r)
+		return
+	}
+	for len(p) > 0 {
+		v := p[0]
+		g.bronKerbosch(append(r[:len(r):len(r)], v), g.neighboursIn(v, p), g.neighboursIn(v, x), report)
+		p = p[1:]
+		x = append(x, v)
+	}
+}
+
+func (g *Graph) neighboursIn(v string, set []string) []string {
+	var out []string
+	for _, w := range set {
+		if g.adj[v][w] {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+func sortEdges(edges []Edge) {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].A != edges[j].A {
+			return edges[i].A < edges[j].A
+		}
+		return edges[i].B < edges[j].B
+	})
+}
@@ -0,0 +1,85 @@
+package mutual
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Pair keys indexed by the two members of each pair
+func pairKey(a, b string) []byte {
+	if a > b {
+		a, b = b, a
+	}
+	return []byte("key " + a + " " + b)
+}
+
+func respond(member string, contacts []string, session []byte) Response {
+	var tags [][]byte
+	for _, c := range contacts {
+		tags = append(tags, Tag(pairKey(member, c), session))
+	}
+	padded, _ := Pad(tags, 8)
+	return Response{Member: member, Tags: padded}
+}
+
+func TestDiscovery(t *testing.T) {
+	session, err := NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Alice coordinates. Bob, Charlie and Dave know each other, Eve only knows Alice and Frank.
+	responses := []Response{
+		respond("bob", []string{"alice", "charlie", "dave"}, session),
+		respond("charlie", []string{"alice", "bob", "dave"}, session),
+		respond("dave", []string{"alice", "bob", "charlie"}, session),
+		respond("eve", []string{"alice", "frank"}, session),
+	}
+	g := Build("alice", responses)
+
+	wantEdges := []Edge{
+		{"alice", "bob"}, {"alice", "charlie"}, {"alice", "dave"}, {"alice", "eve"},
+		{"bob", "charlie"}, {"bob", "dave"}, {"charlie", "dave"},
+	}
+	if !reflect.DeepEqual(g.Edges(), wantEdges) {
+		t.Errorf("Wrong edges: got %v", g.Edges())
+	}
+
+	// Eve is only told about her edge with Alice. Frank is never revealed.
+	if view := g.View("eve"); !reflect.DeepEqual(view, []Edge{{"alice", "eve"}}) {
+		t.Errorf("Wrong view for eve: %v", view)
+	}
+
+	wantRosters := [][]string{{"alice", "bob", "charlie", "dave"}}
+	if rosters := g.Rosters(3); !reflect.DeepEqual(rosters, wantRosters) {
+		t.Errorf("Wrong rosters: got %v", rosters)
+	}
+}
+
+func TestTagsDependOnSession(t *testing.T) {
+	s1, _ := NewSession()
+	s2, _ := NewSession()
+	key := pairKey("bob", "charlie")
+
+	if reflect.DeepEqual(Tag(key, s1), Tag(key, s2)) {
+		t.Errorf("Tags can be linked across sessions")
+	}
+}
+
+func TestPad(t *testing.T) {
+	tags := [][]byte{Tag([]byte("k1"), []byte("s")), Tag([]byte("k2"), []byte("s"))}
+
+	for _, tc := range []struct{ n, block, want int }{{2, 8, 8}, {0, 8, 8}, {2, 2, 2}, {2, 1, 2}} {
+		padded, err := Pad(tags[:tc.n], tc.block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(padded) != tc.want {
+			t.Errorf("Pad(%d, %d): got %d tags, want %d", tc.n, tc.block, len(padded), tc.want)
+		}
+	}
+
+	if _, err := Pad(tags, 0); err == nil {
+		t.Errorf("Accepted a zero block size")
+	}
+}
@@ -0,0 +1,269 @@
+package noise
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"sync"
+)
+
+// Transport carries whole messages between the two sides, reliably and in order
+type Transport interface {
+	Send(msg []byte) error
+	// Receive blocks until the next message from the other side arrives
+	Receive() ([]byte, error)
+}
+
+// Config describes one side of a handshake
+type Config struct {
+	Pattern   Pattern
+	Initiator bool
+	// PSK is the 32-byte pre-shared key, typically derived from the contact secret
+	PSK []byte
+	// Prologue is data that both sides must agree on, e.g. the meeting point
+	Prologue []byte
+	// Static is our long-term key, required by XXpsk3
+	Static *KeyPair
+	// Random is the source of ephemeral keys, crypto/rand by default
+	Random io.Reader
+	// MaxMessageSize caps the size of transport messages, for transports that cannot carry
+	// messages of MaxMessageSize bytes. Zero means MaxMessageSize.
+	MaxMessageSize int
+}
+
+type handshakeState struct {
+	*symmetricState
+	cfg    Config
+	e      *KeyPair
+	re, rs *[DHLen]byte
+}
+
+// Handshake runs the handshake described by cfg over t and returns the resulting connection
+func Handshake(t Transport, cfg Config) (*Conn, error) {
+	messages, ok := patterns[cfg.Pattern]
+	if !ok {
+		return nil, errors.New("noise: unknown pattern")
+	}
+	if len(cfg.PSK) != 32 {
+		return nil, errors.New("noise: PSK must be 32 bytes long")
+	}
+	if cfg.Pattern == XXpsk3 && cfg.Static == nil {
+		return nil, errors.New("noise: XXpsk3 requires a static key")
+	}
+	if cfg.Random == nil {
+		cfg.Random = rand.Reader
+	}
+	if cfg.MaxMessageSize == 0 {
+		cfg.MaxMessageSize = MaxMessageSize
+	}
+	if cfg.MaxMessageSize <= tagSize || cfg.MaxMessageSize > MaxMessageSize {
+		return nil, errors.New("noise: invalid maximum message size")
+	}
+
+	hs := newHandshakeState(cfg)
+	for i, tokens := range messages {
+		if (i%2 == 0) == cfg.Initiator {
+			msg, err := hs.writeMessage(tokens, nil)
+			if err != nil {
+				return nil, err
+			}
+			if err := t.Send(msg); err != nil {
+				return nil, err
+			}
+		} else {
+			msg, err := t.Receive()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := hs.readMessage(tokens, msg); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	c := &Conn{t: t, maxData: cfg.MaxMessageSize - tagSize}
+	c1, c2 := hs.split()
+	if cfg.Initiator {
+		c.send, c.receive = c1, c2
+	} else {
+		c.send, c.receive = c2, c1
+	}
+	if hs.rs != nil {
+		c.remoteStatic = append([]byte(nil), hs.rs[:]...)
+	}
+	return c, nil
+}
+
+func newHandshakeState(cfg Config) *handshakeState {
+	hs := &handshakeState{
+		symmetricState: newSymmetricState("Noise_" + cfg.Pattern.String() + "_25519_ChaChaPoly_SHA256"),
+		cfg:            cfg,
+	}
+	hs.mixHash(cfg.Prologue)
+	return hs
+}
+
+// Write the handshake message made of tokens, carrying payload. Handshake sends empty payloads.
+func (hs *handshakeState) writeMessage(tokens []token, payload []byte) ([]byte, error) {
+	var msg []byte
+	for _, tok := range tokens {
+		switch tok {
+		case tokenE:
+			e, err := GenerateKeyPair(hs.cfg.Random)
+			if err != nil {
+				return nil, err
+			}
+			hs.e = e
+			msg = append(msg, e.Public[:]...)
+			hs.mixHash(e.Public[:])
+			// Both patterns use a PSK, in which case ephemeral keys are also mixed into the key
+			hs.mixKey(e.Public[:])
+		case tokenS:
+			ct, err := hs.encryptAndHash(hs.cfg.Static.Public[:])
+			if err != nil {
+				return nil, err
+			}
+			msg = append(msg, ct...)
+		default:
+			if err := hs.mixToken(tok); err != nil {
+				return nil, err
+			}
+		}
+	}
+	ct, err := hs.encryptAndHash(payload)
+	if err != nil {
+		return nil, err
+	}
+	return append(msg, ct...), nil
+}
+
+// Read the handshake message made of tokens and return its payload
+func (hs *handshakeState) readMessage(tokens []token, msg []byte) ([]byte, error) {
+	for _, tok := range tokens {
+		switch tok {
+		case tokenE:
+			if len(msg) < DHLen {
+				return nil, errors.New("noise: handshake message too short")
+			}
+			hs.re = new([DHLen]byte)
+			copy(hs.re[:], msg)
+			msg = msg[DHLen:]
+			hs.mixHash(hs.re[:])
+			hs.mixKey(hs.re[:])
+		case tokenS:
+			n := DHLen
+			if hs.aead != nil {
+				n += tagSize
+			}
+			if len(msg) < n {
+				return nil, errors.New("noise: handshake message too short")
+			}
+			pt, err := hs.decryptAndHash(msg[:n])
+			if err != nil {
+				return nil, err
+			}
+			hs.rs = new([DHLen]byte)
+			copy(hs.rs[:], pt)
+			msg = msg[n:]
+		default:
+			if err := hs.mixToken(tok); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return hs.decryptAndHash(msg)
+}
+
+// Mix the DH and PSK tokens, which are processed the same way on both sides
+func (hs *handshakeState) mixToken(tok token) error {
+	if tok == tokenPSK {
+		hs.mixKeyAndHash(hs.cfg.PSK)
+		return nil
+	}
+
+	var private, public *[DHLen]byte
+	switch {
+	case tok == tokenEE:
+		private, public = &hs.e.Private, hs.re
+	case tok == tokenES && hs.cfg.Initiator, tok == tokenSE && !hs.cfg.Initiator:
+		private, public = &hs.e.Private, hs.rs
+	default:
+		private, public = &hs.cfg.Static.Private, hs.re
+	}
+	if public == nil {
+		return errors.New("noise: missing remote key")
+	}
+	shared, err := dh(private, public)
+	if err != nil {
+		return err
+	}
+	hs.mixKey(shared)
+	return nil
+}
+
+// Conn is an encrypted byte stream established by a handshake. One goroutine may read while
+// another writes.
+type Conn struct {
+	t            Transport
+	remoteStatic []byte
+	maxData      int
+
+	wmu  sync.Mutex
+	send *cipherState
+
+	rmu     sync.Mutex
+	receive *cipherState
+	pending []byte
+}
+
+// RemoteStatic returns the static key of the other side, or nil if the pattern has none
+func (c *Conn) RemoteStatic() []byte {
+	return c.remoteStatic
+}
+
+// Write encrypts p and sends it in as many messages as needed
+func (c *Conn) Write(p []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > c.maxData {
+			n = c.maxData
+		}
+		msg, err := c.send.encrypt(nil, p[:n])
+		if err != nil {
+			return written, err
+		}
+		if err := c.t.Send(msg); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Read returns decrypted data from the other side, waiting for the next message if none is
+// buffered. A message that does not decrypt breaks the connection.
+func (c *Conn) Read(p []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	for len(c.pending) == 0 {
+		msg, err := c.t.Receive()
+		if err != nil {
+			return 0, err
+		}
+		if len(msg) > MaxMessageSize {
+			return 0, errors.New("noise: message too large")
+		}
+		if c.pending, err = c.receive.decrypt(nil, msg); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
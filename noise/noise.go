@@ -0,0 +1,229 @@
+// Package noise implements the NNpsk0 and XXpsk3 handshakes of the Noise protocol framework
+// with X25519, ChaCha20-Poly1305 and SHA-256, keyed with a pre-shared key derived from the
+// contact secret.
+//
+//	Noise_NNpsk0_25519_ChaChaPoly_SHA256    Noise_XXpsk3_25519_ChaChaPoly_SHA256
+//	  -> psk, e                               -> e
+//	  <- e, ee                                <- e, ee, s, es
+//	                                          -> s, se, psk
+//
+// NNpsk0 authenticates both sides through the PSK only. XXpsk3 additionally exchanges static
+// keys, encrypted, so that each side learns the other's long-term key.
+//
+// The handshake runs over a Transport that carries whole messages. Once it completes, Conn
+// provides an encrypted, authenticated byte stream in both directions.
+package noise
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+)
+
+// Pattern is a Noise handshake pattern
+type Pattern int
+
+const (
+	// NNpsk0 authenticates both sides with the PSK only
+	NNpsk0 Pattern = iota + 1
+	// XXpsk3 authenticates both sides with the PSK and exchanges their static keys
+	XXpsk3
+)
+
+func (p Pattern) String() string {
+	switch p {
+	case NNpsk0:
+		return "NNpsk0"
+	case XXpsk3:
+		return "XXpsk3"
+	default:
+		return "unknown"
+	}
+}
+
+// DHLen is the size of X25519 keys
+const DHLen = 32
+
+// MaxMessageSize is the largest Noise message
+const MaxMessageSize = 65535
+
+const tagSize = 16
+
+type token int
+
+const (
+	tokenE token = iota
+	tokenS
+	tokenEE
+	tokenES
+	tokenSE
+	tokenPSK
+)
+
+// Message patterns, alternating from the initiator
+var patterns = map[Pattern][][]token{
+	NNpsk0: {
+		{tokenPSK, tokenE},
+		{tokenE, tokenEE},
+	},
+	XXpsk3: {
+		{tokenE},
+		{tokenE, tokenEE, tokenS, tokenES},
+		{tokenS, tokenSE, tokenPSK},
+	},
+}
+
+// KeyPair is an X25519 key pair
+type KeyPair struct {
+	Private [DHLen]byte
+	Public  [DHLen]byte
+}
+
+// GenerateKeyPair picks a fresh X25519 key pair
+func GenerateKeyPair(random io.Reader) (*KeyPair, error) {
+	var kp KeyPair
+	if _, err := io.ReadFull(random, kp.Private[:]); err != nil {
+		return nil, err
+	}
+	curve25519.ScalarBaseMult(&kp.Public, &kp.Private)
+	return &kp, nil
+}
+
+type cipherState struct {
+	aead cipher.AEAD
+	n    uint64
+}
+
+func (c *cipherState) initializeKey(k []byte) {
+	// The key is always 32 bytes long
+	c.aead, _ = chacha20poly1305.New(k)
+	c.n = 0
+}
+
+func (c *cipherState) nonce() []byte {
+	var nonce [chacha20poly1305.NonceSize]byte
+	binary.LittleEndian.PutUint64(nonce[4:], c.n)
+	return nonce[:]
+}
+
+func (c *cipherState) encrypt(ad, plaintext []byte) ([]byte, error) {
+	if c.aead == nil {
+		return append([]byte(nil), plaintext...), nil
+	}
+	if c.n == ^uint64(0) {
+		return nil, errors.New("noise: nonces exhausted")
+	}
+	out := c.aead.Seal(nil, c.nonce(), plaintext, ad)
+	c.n++
+	return out, nil
+}
+
+func (c *cipherState) decrypt(ad, ciphertext []byte) ([]byte, error) {
+	if c.aead == nil {
+		return append([]byte(nil), ciphertext...), nil
+	}
+	if c.n == ^uint64(0) {
+		return nil, errors.New("noise: nonces exhausted")
+	}
+	out, err := c.aead.Open(nil, c.nonce(), ciphertext, ad)
+	if err != nil {
+		return nil, errors.New("noise: decryption failed")
+	}
+	c.n++
+	return out, nil
+}
+
+type symmetricState struct {
+	cipherState
+	ck, h [sha256.Size]byte
+}
+
+func newSymmetricState(protocolName string) *symmetricState {
+	var s symmetricState
+	if len(protocolName) <= sha256.Size {
+		copy(s.h[:], protocolName)
+	} else {
+		s.h = sha256.Sum256([]byte(protocolName))
+	}
+	s.ck = s.h
+	return &s
+}
+
+func (s *symmetricState) mixKey(ikm []byte) {
+	out := hkdf(s.ck[:], ikm, 2)
+	copy(s.ck[:], out[0])
+	s.initializeKey(out[1])
+}
+
+func (s *symmetricState) mixHash(data []byte) {
+	h := sha256.New()
+	h.Write(s.h[:])
+	h.Write(data)
+	copy(s.h[:], h.Sum(nil))
+}
+
+func (s *symmetricState) mixKeyAndHash(ikm []byte) {
+	out := hkdf(s.ck[:], ikm, 3)
+	copy(s.ck[:], out[0])
+	s.mixHash(out[1])
+	s.initializeKey(out[2])
+}
+
+func (s *symmetricState) encryptAndHash(plaintext []byte) ([]byte, error) {
+	ciphertext, err := s.encrypt(s.h[:], plaintext)
+	if err != nil {
+		return nil, err
+	}
+	s.mixHash(ciphertext)
+	return ciphertext, nil
+}
+
+func (s *symmetricState) decryptAndHash(ciphertext []byte) ([]byte, error) {
+	plaintext, err := s.decrypt(s.h[:], ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	s.mixHash(ciphertext)
+	return plaintext, nil
+}
+
+func (s *symmetricState) split() (*cipherState, *cipherState) {
+	out := hkdf(s.ck[:], nil, 2)
+	c1, c2 := &cipherState{}, &cipherState{}
+	c1.initializeKey(out[0])
+	c2.initializeKey(out[1])
+	return c1, c2
+}
+
+// HKDF as defined by the Noise specification
+func hkdf(ck, ikm []byte, n int) [][]byte {
+	mac := hmac.New(sha256.New, ck)
+	mac.Write(ikm)
+	tempKey := mac.Sum(nil)
+
+	var out [][]byte
+	var prev []byte
+	for i := 1; i <= n; i++ {
+		mac := hmac.New(sha256.New, tempKey)
+		mac.Write(prev)
+		mac.Write([]byte{byte(i)})
+		prev = mac.Sum(nil)
+		out = append(out, prev)
+	}
+	return out
+}
+
+func dh(private, public *[DHLen]byte) ([]byte, error) {
+	var out, zero [DHLen]byte
+	curve25519.ScalarMult(&out, private, public)
+	if out == zero {
+		return nil, errors.New("noise: invalid public key")
+	}
+	return out[:], nil
+}
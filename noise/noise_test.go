@@ -0,0 +1,275 @@
+package noise
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"testing"
+)
+
+// One end of an in-memory transport
+type pipe struct {
+	in, out chan []byte
+}
+
+func newPipe() (*pipe, *pipe) {
+	a, b := make(chan []byte, 16), make(chan []byte, 16)
+	return &pipe{in: a, out: b}, &pipe{in: b, out: a}
+}
+
+func (p *pipe) Send(msg []byte) error {
+	p.out <- append([]byte(nil), msg...)
+	return nil
+}
+
+func (p *pipe) Receive() ([]byte, error) {
+	msg, ok := <-p.in
+	if !ok {
+		return nil, errors.New("pipe closed")
+	}
+	return msg, nil
+}
+
+var testPSK = bytes.Repeat([]byte{7}, 32)
+
+// Run both sides of a handshake concurrently
+func handshake(t *testing.T, initiator, responder Config) (*Conn, *Conn, error, error) {
+	a, b := newPipe()
+	initiator.Initiator = true
+
+	type result struct {
+		c   *Conn
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		c, err := Handshake(b, responder)
+		if err != nil {
+			// Unblock the initiator
+			close(b.out)
+		}
+		done <- result{c, err}
+	}()
+	c1, err1 := Handshake(a, initiator)
+	if err1 != nil {
+		close(a.out)
+	}
+	r := <-done
+	return c1, r.c, err1, r.err
+}
+
+func TestHandshake(t *testing.T) {
+	aliceStatic, _ := GenerateKeyPair(rand.Reader)
+	bobStatic, _ := GenerateKeyPair(rand.Reader)
+
+	for _, p := range []Pattern{NNpsk0, XXpsk3} {
+		alice := Config{Pattern: p, PSK: testPSK, Prologue: []byte("meeting point"), Static: aliceStatic}
+		bob := Config{Pattern: p, PSK: testPSK, Prologue: []byte("meeting point"), Static: bobStatic}
+		c1, c2, err1, err2 := handshake(t, alice, bob)
+		if err1 != nil || err2 != nil {
+			t.Fatalf("%s handshake failed: %v, %v", p, err1, err2)
+		}
+
+		for _, dir := range [][2]*Conn{{c1, c2}, {c2, c1}} {
+			msg := []byte(p.String() + " says hello")
+			if _, err := dir[0].Write(msg); err != nil {
+				t.Fatal(err)
+			}
+			got := make([]byte, len(msg))
+			if _, err := io.ReadFull(dir[1], got); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, msg) {
+				t.Errorf("%s: got %q, expected %q", p, got, msg)
+			}
+		}
+
+		if p == XXpsk3 {
+			if !bytes.Equal(c1.RemoteStatic(), bobStatic.Public[:]) || !bytes.Equal(c2.RemoteStatic(), aliceStatic.Public[:]) {
+				t.Errorf("Static keys were not exchanged")
+			}
+		} else if c1.RemoteStatic() != nil {
+			t.Errorf("NNpsk0 returned a static key")
+		}
+	}
+}
+
+func TestHandshakeMismatch(t *testing.T) {
+	static, _ := GenerateKeyPair(rand.Reader)
+
+	for _, p := range []Pattern{NNpsk0, XXpsk3} {
+		good := Config{Pattern: p, PSK: testPSK, Prologue: []byte("meeting point"), Static: static}
+
+		wrongPSK := good
+		wrongPSK.PSK = bytes.Repeat([]byte{8}, 32)
+		if _, _, err1, err2 := handshake(t, good, wrongPSK); err1 == nil && err2 == nil {
+			t.Errorf("%s handshake succeeded with different PSKs", p)
+		}
+
+		wrongPrologue := good
+		wrongPrologue.Prologue = []byte("another meeting point")
+		if _, _, err1, err2 := handshake(t, good, wrongPrologue); err1 == nil && err2 == nil {
+			t.Errorf("%s handshake succeeded with different prologues", p)
+		}
+	}
+
+	if _, err := Handshake(nil, Config{Pattern: XXpsk3, PSK: testPSK}); err == nil {
+		t.Errorf("XXpsk3 handshake started without a static key")
+	}
+}
+
+func TestLargeWrite(t *testing.T) {
+	c1, c2, err1, err2 := handshake(t, Config{Pattern: NNpsk0, PSK: testPSK}, Config{Pattern: NNpsk0, PSK: testPSK})
+	if err1 != nil || err2 != nil {
+		t.Fatal(err1, err2)
+	}
+
+	small := Config{Pattern: NNpsk0, PSK: testPSK, MaxMessageSize: 1024}
+	c3, c4, err1, err2 := handshake(t, small, small)
+	if err1 != nil || err2 != nil {
+		t.Fatal(err1, err2)
+	}
+
+	data := make([]byte, 3*MaxMessageSize)
+	rand.Read(data)
+	for _, pair := range [][2]*Conn{{c1, c2}, {c3, c4}} {
+		go func(c *Conn) {
+			if n, err := c.Write(data); err != nil || n != len(data) {
+				t.Errorf("Wrote %d bytes: %v", n, err)
+			}
+		}(pair[0])
+		got := make([]byte, len(data))
+		if _, err := io.ReadFull(pair[1], got); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("Stream was corrupted")
+		}
+	}
+}
+
+func TestReplayedMessage(t *testing.T) {
+	a, b := newPipe()
+	done := make(chan *Conn)
+	go func() {
+		c, _ := Handshake(b, Config{Pattern: NNpsk0, PSK: testPSK})
+		done <- c
+	}()
+	c1, err := Handshake(a, Config{Pattern: NNpsk0, PSK: testPSK, Initiator: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2 := <-done
+
+	// A replayed message is rejected because nonces are sequential
+	c1.Write([]byte("once"))
+	msg := <-b.in
+	b.in <- msg
+	b.in <- msg
+	buf := make([]byte, 16)
+	if n, err := c2.Read(buf); err != nil || string(buf[:n]) != "once" {
+		t.Fatalf("Could not read the first message: %v", err)
+	}
+	if _, err := c2.Read(buf); err == nil {
+		t.Errorf("Replayed message was accepted")
+	}
+}
+
+// Known-answer vectors from the vectors.txt of github.com/flynn/noise v1.1.0, an independent
+// implementation. Messages alternate between the two sides, the initiator first, and continue
+// with transport messages once the handshake completes.
+var testVectors = []struct {
+	pattern                      Pattern
+	initStatic, respStatic       string
+	initEphemeral, respEphemeral string
+	prologue, psk                string
+	messages                     [][2]string
+}{
+	{
+		pattern:       NNpsk0,
+		initEphemeral: "202122232425262728292a2b2c2d2e2f303132333435363738393a3b3c3d3e3f",
+		respEphemeral: "4142434445464748494a4b4c4d4e4f505152535455565758595a5b5c5d5e5f60",
+		prologue:      "6e6f74736563726574",
+		psk:           "2176657279736563726574766572797365637265747665727973656372657421",
+		messages: [][2]string{
+			{"746573745f6d73675f30", "358072d6365880d1aeea329adf9121383851ed21a28e3b75e965d0d2cd1662547c78f22f8cea986f934ab17c2484a24a990a6473d588a4f20e99"},
+			{"746573745f6d73675f31", "64b101b1d0be5a8704bd078f9895001fc03e8e9f9522f188dd128d9846d484666913ea64c74c2f63ee5e32a5358320d459322d624c9ccc975fa0"},
+			{"79656c6c6f777375626d6172696e65", "b349a522c145762c7c737ac1d1425ce1fb25c7cca626177ee4ceed3cd6fb3d"},
+			{"7375626d6172696e6579656c6c6f77", "b41e24399dc3f1ad2faf82868700e4bf31bb89f6616e1d6a92802bb8ad80d6"},
+		},
+	},
+	{
+		pattern:       XXpsk3,
+		initStatic:    "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+		respStatic:    "0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20",
+		initEphemeral: "202122232425262728292a2b2c2d2e2f303132333435363738393a3b3c3d3e3f",
+		respEphemeral: "4142434445464748494a4b4c4d4e4f505152535455565758595a5b5c5d5e5f60",
+		prologue:      "6e6f74736563726574",
+		psk:           "2176657279736563726574766572797365637265747665727973656372657421",
+		messages: [][2]string{
+			{"746573745f6d73675f30", "358072d6365880d1aeea329adf9121383851ed21a28e3b75e965d0d2cd166254653658a6a90feb6404ce2902887f0faf388ff019393d23fd4976"},
+			{"746573745f6d73675f31", "64b101b1d0be5a8704bd078f9895001fc03e8e9f9522f188dd128d9846d4846696a7a5454cc70bb4eec2a2f7c616c143564ff1ae149458f9e70afb3498be7a886ed5d694d493c5867cb2c232205e46bddde1bfec74551b1f083a86e220331181777ca16a1bad616dff5f"},
+			{"746573745f6d73675f32", "f5b6224ea13577089dc14b20ca8e90d0cedede4faff50348d4d0a0f941182ad7e65025d045c6ff1f63a8b63ffe90710e734c20e3dd6c03cf438a6ce9aa9775b05dd5d3b729a9ac78d811"},
+			{"79656c6c6f777375626d6172696e65", "5e80fec73b32f6ff466aa5addbc2b16e2cf062f09c36796ecb2efcc35cac99"},
+			{"7375626d6172696e6579656c6c6f77", "df3c8983cb9f286df65e57d0010dc65eeca3bca44b6b240da8ebf92be581cd"},
+		},
+	},
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestVectors(t *testing.T) {
+	for _, v := range testVectors {
+		initiator := Config{Pattern: v.pattern, Initiator: true, PSK: mustHex(t, v.psk), Prologue: mustHex(t, v.prologue), Random: bytes.NewReader(mustHex(t, v.initEphemeral))}
+		responder := Config{Pattern: v.pattern, PSK: mustHex(t, v.psk), Prologue: mustHex(t, v.prologue), Random: bytes.NewReader(mustHex(t, v.respEphemeral))}
+		if v.initStatic != "" {
+			initiator.Static, _ = GenerateKeyPair(bytes.NewReader(mustHex(t, v.initStatic)))
+			responder.Static, _ = GenerateKeyPair(bytes.NewReader(mustHex(t, v.respStatic)))
+		}
+		hs := [2]*handshakeState{newHandshakeState(initiator), newHandshakeState(responder)}
+
+		messages := patterns[v.pattern]
+		// Cipher states of each side once the handshake completes, to send and to receive
+		var transport [2][2]*cipherState
+		for i, m := range v.messages {
+			payload, expected := mustHex(t, m[0]), mustHex(t, m[1])
+
+			var msg, got []byte
+			var err error
+			if i < len(messages) {
+				writer := i % 2
+				if msg, err = hs[writer].writeMessage(messages[i], payload); err != nil {
+					t.Fatalf("%s message %d: %v", v.pattern, i, err)
+				}
+				got, err = hs[1-writer].readMessage(messages[i], msg)
+			} else {
+				if transport[0][0] == nil {
+					c1, c2 := hs[0].split()
+					transport[0] = [2]*cipherState{c1, c2}
+					c1, c2 = hs[1].split()
+					transport[1] = [2]*cipherState{c2, c1}
+				}
+				// Transport messages start from the initiator again
+				writer := (i - len(messages)) % 2
+				if msg, err = transport[writer][0].encrypt(nil, payload); err != nil {
+					t.Fatalf("%s message %d: %v", v.pattern, i, err)
+				}
+				got, err = transport[1-writer][1].decrypt(nil, msg)
+			}
+			if !bytes.Equal(msg, expected) {
+				t.Errorf("%s message %d: got %x, expected %x", v.pattern, i, msg, expected)
+			}
+			if err != nil || !bytes.Equal(got, payload) {
+				t.Errorf("%s message %d: read %x, %v", v.pattern, i, got, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package phonenumber
+
+import "regexp"
+
+// Numbering plan of a region
+type region struct {
+	code        string
+	countryCode int
+	// Prefix dialled before national numbers, such as "0" in the UK. Not part of the E.164 form.
+	trunkPrefix string
+	// Prefix dialled before international numbers, such as "00" or "011"
+	internationalPrefix string
+	// Shortest and longest national significant numbers
+	minLength, maxLength int
+	// Number ranges, matched in order against the whole national significant number
+	ranges []numberRange
+}
+
+type numberRange struct {
+	typ     Type
+	pattern *regexp.Regexp
+}
+
+func r(typ Type, pattern string) numberRange {
+	return numberRange{typ, regexp.MustCompile(`^(?:` + pattern + `)$`)}
+}
+
+// The North American Numbering Plan does not tell mobile numbers from fixed lines
+var nanp = []numberRange{
+	r(TollFree, `8(?:00|33|44|55|66|77|88)[2-9]\d{6}`),
+	r(PremiumRate, `900[2-9]\d{6}`),
+	r(PersonalNumber, `5(?:00|2[1-9]|33|44|66|77|88)[2-9]\d{6}`),
+	r(FixedLineOrMobile, `[2-9]\d{2}[2-9]\d{6}`),
+}
+
+// Regions share their country calling code with the regions after them: +1 numbers are
+// attributed to the first region listed with that code unless the default region has it too.
+var regions = []*region{
+	{"US", 1, "1", "011", 10, 10, nanp},
+	{"CA", 1, "1", "011", 10, 10, nanp},
+	{"RU", 7, "8", "810", 10, 10, []numberRange{
+		r(TollFree, `800\d{7}`),
+		r(PremiumRate, `80[39]\d{7}`),
+		r(Mobile, `9\d{9}`),
+		r(FixedLine, `[3-8]\d{9}`),
+	}},
+	{"ZA", 27, "0", "00", 9, 9, []numberRange{
+		r(TollFree, `80\d{7}`),
+		r(SharedCost, `86\d{7}`),
+		r(Mobile, `(?:[67]\d|8[1-4])\d{7}`),
+		r(FixedLine, `[1-5]\d{8}`),
+	}},
+	{"NL", 31, "0", "00", 7, 10, []numberRange{
+		r(TollFree, `800\d{4,7}`),
+		r(PremiumRate, `90[069]\d{4,7}`),
+		r(Mobile, `6[1-58]\d{7}`),
+		r(FixedLine, `[1-578]\d{8}`),
+	}},
+	{"BE", 32, "0", "00", 8, 9, []numberRange{
+		r(TollFree, `800\d{5}`),
+		r(PremiumRate, `90\d{6}`),
+		r(Mobile, `4[5-9]\d{7}`),
+		r(FixedLine, `[1-9]\d{7}`),
+	}},
+	{"FR", 33, "0", "00", 9, 9, []numberRange{
+		r(TollFree, `80\d{7}`),
+		r(SharedCost, `8[1-4]\d{7}`),
+		r(PremiumRate, `8[89]\d{7}`),
+		r(Mobile, `[67]\d{8}`),
+		r(VoIP, `9\d{8}`),
+		r(FixedLine, `[1-5]\d{8}`),
+	}},
+	// Spain has no trunk prefix
+	{"ES", 34, "", "00", 9, 9, []numberRange{
+		r(TollFree, `900\d{6}`),
+		r(SharedCost, `90[12]\d{6}`),
+		r(PremiumRate, `80[3-7]\d{6}`),
+		r(Mobile, `[67]\d{8}`),
+		r(FixedLine, `[89]\d{8}`),
+	}},
+	// Italian fixed lines keep their leading zero in international format
+	{"IT", 39, "", "00", 6, 11, []numberRange{
+		r(TollFree, `80[03]\d{3,6}`),
+		r(SharedCost, `84\d{6}`),
+		r(PremiumRate, `89\d{4,7}`),
+		r(Mobile, `3\d{8,9}`),
+		r(FixedLine, `0\d{5,10}`),
+	}},
+	{"CH", 41, "0", "00", 9, 9, []numberRange{
+		r(TollFree, `800\d{6}`),
+		r(SharedCost, `84[0248]\d{6}`),
+		r(PremiumRate, `90[016]\d{6}`),
+		r(Mobile, `7[5-9]\d{7}`),
+		r(FixedLine, `[2-68]\d{8}`),
+	}},
+	{"GB", 44, "0", "00", 9, 10, []numberRange{
+		r(Mobile, `7(?:[1-57-9]\d{8}|624\d{6})`),
+		r(Pager, `76\d{8}`),
+		r(PersonalNumber, `70\d{8}`),
+		r(VoIP, `56\d{8}`),
+		r(TollFree, `80(?:0\d{6,7}|8\d{7})`),
+		r(SharedCost, `8(?:4[2-5]|7[0-3])\d{7}`),
+		r(PremiumRate, `9[018]\d{8}`),
+		r(FixedLine, `[12]\d{8,9}|3\d{9}`),
+	}},
+	{"SE", 46, "0", "00", 7, 9, []numberRange{
+		r(TollFree, `20[0-2]\d{4,6}`),
+		r(PremiumRate, `9[0-4]\d{5,7}`),
+		r(Mobile, `7[02369]\d{7}`),
+		r(FixedLine, `[1-8]\d{6,8}`),
+	}},
+	// Poland has no trunk prefix
+	{"PL", 48, "", "00", 9, 9, []numberRange{
+		r(TollFree, `800\d{6}`),
+		r(PremiumRate, `70\d{7}`),
+		r(Mobile, `(?:45|5[0137]|6[069]|7[2389]|88)\d{7}`),
+		r(FixedLine, `[1-9]\d{8}`),
+	}},
+	{"DE", 49, "0", "00", 6, 11, []numberRange{
+		r(Mobile, `15[0-25-9]\d{8}|1(?:6[023]|7\d)\d{7,8}`),
+		r(PersonalNumber, `700\d{8}`),
+		r(TollFree, `800\d{7}`),
+		r(SharedCost, `180\d{7}`),
+		r(PremiumRate, `900\d{7}`),
+		r(FixedLine, `[2-9]\d{5,10}`),
+	}},
+	// Mexico dropped its trunk prefixes in 2019
+	{"MX", 52, "", "00", 10, 10, []numberRange{
+		r(TollFree, `800\d{7}`),
+		r(PremiumRate, `900\d{7}`),
+		r(FixedLineOrMobile, `[1-9]\d{9}`),
+	}},
+	{"BR", 55, "0", "00", 10, 11, []numberRange{
+		r(TollFree, `800\d{6,7}`),
+		r(Mobile, `[1-9][1-9]9\d{8}`),
+		r(FixedLine, `[1-9][1-9][2-5]\d{7}`),
+	}},
+	{"AU", 61, "0", "0011", 6, 10, []numberRange{
+		r(TollFree, `180\d{6,7}`),
+		r(SharedCost, `13(?:00\d{6}|\d{4})`),
+		r(PremiumRate, `190\d{7}`),
+		r(Mobile, `4\d{8}`),
+		r(FixedLine, `[2378]\d{8}`),
+	}},
+	{"NZ", 64, "0", "00", 8, 10, []numberRange{
+		r(TollFree, `800\d{6,7}`),
+		r(PremiumRate, `900\d{6,7}`),
+		r(Mobile, `2\d{7,9}`),
+		r(FixedLine, `[3-9]\d{7}`),
+	}},
+	{"JP", 81, "0", "010", 9, 10, []numberRange{
+		r(TollFree, `120\d{6}|800\d{7}`),
+		r(PremiumRate, `990\d{6}`),
+		r(Mobile, `[7-9]0\d{8}`),
+		r(VoIP, `50\d{8}`),
+		r(FixedLine, `[1-9]\d{8}`),
+	}},
+	{"CN", 86, "0", "00", 7, 11, []numberRange{
+		r(TollFree, `800\d{7}`),
+		r(SharedCost, `400\d{7}`),
+		r(Mobile, `1[3-9]\d{9}`),
+		r(FixedLine, `[2-9]\d{6,10}`),
+	}},
+	{"IN", 91, "0", "00", 10, 11, []numberRange{
+		r(TollFree, `1800\d{6,7}`),
+		r(Mobile, `[6-9]\d{9}`),
+		r(FixedLine, `[1-5]\d{9}`),
+	}},
+	{"PT", 351, "", "00", 9, 9, []numberRange{
+		r(TollFree, `800\d{6}`),
+		r(SharedCost, `(?:80[89]|70[78])\d{6}`),
+		r(PremiumRate, `76\d{7}`),
+		r(Mobile, `9[1236]\d{7}`),
+		r(FixedLine, `2\d{8}`),
+	}},
+	{"IE", 353, "0", "00", 7, 10, []numberRange{
+		r(TollFree, `1800\d{6}`),
+		r(PremiumRate, `15[12]\d{7}`),
+		r(Mobile, `8[35-9]\d{7}`),
+		r(FixedLine, `1\d{7,8}|[2-9]\d{6,8}`),
+	}},
+}
+
+// Country calling codes assigned by the ITU, including those of the regions above. Numbers
+// with codes of regions without a numbering plan here are only checked against E.164.
+var assignedCountryCodes = []int{
+	1, 7,
+	20, 27, 30, 31, 32, 33, 34, 36, 39, 40, 41, 43, 44, 45, 46, 47, 48, 49,
+	51, 52, 53, 54, 55, 56, 57, 58, 60, 61, 62, 63, 64, 65, 66,
+	81, 82, 84, 86, 90, 91, 92, 93, 94, 95, 98,
+	211, 212, 213, 216, 218,
+	220, 221, 222, 223, 224, 225, 226, 227, 228, 229,
+	230, 231, 232, 233, 234, 235, 236, 237, 238, 239,
+	240, 241, 242, 243, 244, 245, 246, 247, 248, 249,
+	250, 251, 252, 253, 254, 255, 256, 257, 258,
+	260, 261, 262, 263, 264, 265, 266, 267, 268, 269,
+	290, 291, 297, 298, 299,
+	350, 351, 352, 353, 354, 355, 356, 357, 358, 359,
+	370, 371, 372, 373, 374, 375, 376, 377, 378, 379,
+	380, 381, 382, 383, 385, 386, 387, 389,
+	420, 421, 423,
+	500, 501, 502, 503, 504, 505, 506, 507, 508, 509,
+	590, 591, 592, 593, 594, 595, 596, 597, 598, 599,
+	670, 672, 673, 674, 675, 676, 677, 678, 679,
+	680, 681, 682, 683, 685, 686, 687, 688, 689, 690, 691, 692,
+	800, 808, 850, 852, 853, 855, 856, 870, 878,
+	880, 881, 882, 883, 886, 888,
+	960, 961, 962, 963, 964, 965, 966, 967, 968,
+	970, 971, 972, 973, 974, 975, 976, 977, 979,
+	991, 992, 993, 994, 995, 996, 998,
+}
+
+var (
+	byCode        = map[string]*region{}
+	byCountryCode = map[int]*region{}
+	assigned      = map[int]bool{}
+)
+
+func init() {
+	for _, cc := range assignedCountryCodes {
+		assigned[cc] = true
+	}
+	for _, reg := range regions {
+		byCode[reg.code] = reg
+		if _, ok := byCountryCode[reg.countryCode]; !ok {
+			byCountryCode[reg.countryCode] = reg
+		}
+	}
+}
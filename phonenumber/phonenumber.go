@@ -0,0 +1,281 @@
+// Package phonenumber normalizes phone numbers to E.164, the international format in which
+// a number has exactly one spelling: "+", the country calling code and the national
+// significant number, without trunk prefixes or separators. "+44 7700 900123",
+// "07700 900123" dialled in the UK and "00447700900123" are all +447700900123.
+//
+// Numbers are validated against the numbering plan of their region: the length of the
+// national number and the ranges it may fall in, which also tell the type of the number.
+// Regions are identified by their ISO 3166-1 alpha-2 code, such as "GB" or "US". Numbers in
+// international format of the regions without a numbering plan here are only checked to have
+// an assigned country calling code and the length E.164 allows; their region and type are
+// unknown.
+package phonenumber
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Type tells what kind of line a number belongs to
+type Type int
+
+const (
+	// FixedLine is a geographic number
+	FixedLine Type = iota + 1
+	// Mobile is a mobile number
+	Mobile
+	// FixedLineOrMobile is a number of a region where both share the same ranges
+	FixedLineOrMobile
+	// TollFree is free for the caller
+	TollFree
+	// PremiumRate costs the caller more than a regular call
+	PremiumRate
+	// SharedCost is paid partly by the caller and partly by the receiver
+	SharedCost
+	// VoIP is a non-geographic internet telephony number
+	VoIP
+	// PersonalNumber follows its owner to another line
+	PersonalNumber
+	// Pager is a paging service
+	Pager
+)
+
+func (t Type) String() string {
+	switch t {
+	case FixedLine:
+		return "fixed line"
+	case Mobile:
+		return "mobile"
+	case FixedLineOrMobile:
+		return "fixed line or mobile"
+	case TollFree:
+		return "toll free"
+	case PremiumRate:
+		return "premium rate"
+	case SharedCost:
+		return "shared cost"
+	case VoIP:
+		return "VoIP"
+	case PersonalNumber:
+		return "personal"
+	case Pager:
+		return "pager"
+	default:
+		return "unknown"
+	}
+}
+
+// Length of E.164 numbers, country calling code included. The shortest numbers in use are 8
+// digits long.
+const (
+	minE164Length = 8
+	maxE164Length = 15
+)
+
+// Reasons for rejecting a number, wrapped in an Error
+var (
+	ErrEmpty              = errors.New("no digits")
+	ErrInvalidCharacter   = errors.New("invalid character")
+	ErrNoRegion           = errors.New("no country calling code and no default region")
+	ErrUnknownRegion      = errors.New("unknown region")
+	ErrUnknownCountryCode = errors.New("unknown country calling code")
+	ErrTooShort           = errors.New("too short")
+	ErrTooLong            = errors.New("too long")
+	ErrNotInPlan          = errors.New("not in any number range of the region")
+)
+
+// Error reports why a number was rejected
+type Error struct {
+	// Number as it was given
+	Number string
+	// Region it was read in, if known
+	Region string
+	// Err is one of the Err values of this package
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Region == "" {
+		return fmt.Sprintf("phonenumber: %q: %v", e.Number, e.Err)
+	}
+	return fmt.Sprintf("phonenumber: %q (%s): %v", e.Number, e.Region, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Number is a valid phone number
+type Number struct {
+	CountryCode int
+	// National significant number: the digits after the country calling code
+	National string
+	// Region the number belongs to. Numbers of regions that share a country calling code are
+	// attributed to the default region they were parsed in when it has that code. Empty, like
+	// Type, for numbers of regions without a numbering plan.
+	Region string
+	Type   Type
+}
+
+// E164 formats the number as "+" followed by its digits
+func (n Number) E164() string {
+	return "+" + strconv.Itoa(n.CountryCode) + n.National
+}
+
+func (n Number) String() string {
+	return n.E164()
+}
+
+// Parse reads a phone number as people write it. Numbers in international format start with
+// "+" or the international prefix of the default region; other numbers are national numbers
+// of the default region, with or without its trunk prefix. The default region may be empty
+// if every number is in international format.
+func Parse(number, defaultRegion string) (Number, error) {
+	fail := func(region string, err error) (Number, error) {
+		return Number{}, &Error{Number: number, Region: region, Err: err}
+	}
+
+	var home *region
+	if defaultRegion != "" {
+		var ok bool
+		if home, ok = byCode[strings.ToUpper(defaultRegion)]; !ok {
+			return fail(defaultRegion, ErrUnknownRegion)
+		}
+	}
+
+	digits, plus, err := extractDigits(number)
+	if err != nil {
+		return fail("", err)
+	}
+	international := plus
+	if !international && home != nil && strings.HasPrefix(digits, home.internationalPrefix) {
+		digits, international = digits[len(home.internationalPrefix):], true
+	}
+
+	if !international {
+		if home == nil {
+			return fail("", ErrNoRegion)
+		}
+		national := digits
+		if home.trunkPrefix != "" {
+			national = strings.TrimPrefix(digits, home.trunkPrefix)
+		}
+		typ, err := home.validate(national)
+		// People often leave out the "+" in front of the country calling code
+		if err != nil && national == digits {
+			cc := strconv.Itoa(home.countryCode)
+			if strings.HasPrefix(digits, cc) {
+				if t, e := home.validate(digits[len(cc):]); e == nil {
+					national, typ, err = digits[len(cc):], t, nil
+				}
+			}
+		}
+		if err != nil {
+			return fail(home.code, err)
+		}
+		return Number{home.countryCode, national, home.code, typ}, nil
+	}
+
+	// Country calling codes are prefix-free and at most three digits long
+	var reg *region
+	for i := 1; i <= 3 && i <= len(digits) && reg == nil; i++ {
+		cc, _ := strconv.Atoi(digits[:i])
+		if r, ok := byCountryCode[cc]; ok {
+			reg, digits = r, digits[i:]
+		}
+	}
+	if reg == nil {
+		return parseE164(number, digits)
+	}
+	if home != nil && home.countryCode == reg.countryCode {
+		reg = home
+	}
+	typ, err := reg.validate(digits)
+	// "+44 (0)7700 900123" keeps the trunk prefix by mistake
+	if err != nil && reg.trunkPrefix != "" && strings.HasPrefix(digits, reg.trunkPrefix) {
+		if t, e := reg.validate(digits[len(reg.trunkPrefix):]); e == nil {
+			digits, typ, err = digits[len(reg.trunkPrefix):], t, nil
+		}
+	}
+	if err != nil {
+		return fail(reg.code, err)
+	}
+	return Number{reg.countryCode, digits, reg.code, typ}, nil
+}
+
+// Read the digits of a number in international format whose region has no numbering plan here
+func parseE164(number, digits string) (Number, error) {
+	fail := func(err error) (Number, error) {
+		return Number{}, &Error{Number: number, Err: err}
+	}
+	for i := 1; i <= 3 && i <= len(digits); i++ {
+		cc, _ := strconv.Atoi(digits[:i])
+		if !assigned[cc] {
+			continue
+		}
+		switch {
+		case len(digits) < minE164Length:
+			return fail(ErrTooShort)
+		case len(digits) > maxE164Length:
+			return fail(ErrTooLong)
+		}
+		return Number{CountryCode: cc, National: digits[i:]}, nil
+	}
+	return fail(ErrUnknownCountryCode)
+}
+
+// Normalize returns the E.164 form of a number, as read by Parse
+func Normalize(number, defaultRegion string) (string, error) {
+	n, err := Parse(number, defaultRegion)
+	if err != nil {
+		return "", err
+	}
+	return n.E164(), nil
+}
+
+// Keep the digits of a number, dropping the separators people type. Also tells whether the
+// number starts with "+".
+func extractDigits(number string) (string, bool, error) {
+	s := strings.TrimSpace(number)
+	s = strings.TrimPrefix(s, "tel:")
+	// Drop URI parameters such as ;ext=
+	if i := strings.IndexByte(s, ';'); i >= 0 {
+		s = s[:i]
+	}
+
+	var b strings.Builder
+	plus := false
+	for i, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '+' && i == 0:
+			plus = true
+		case r == ' ', r == '\u00a0', r == '-', r == '.', r == '(', r == ')', r == '/':
+		default:
+			return "", false, ErrInvalidCharacter
+		}
+	}
+	if b.Len() == 0 {
+		return "", false, ErrEmpty
+	}
+	return b.String(), plus, nil
+}
+
+// Check a national significant number against the numbering plan
+func (r *region) validate(national string) (Type, error) {
+	switch {
+	case len(national) < r.minLength:
+		return 0, ErrTooShort
+	case len(national) > r.maxLength:
+		return 0, ErrTooLong
+	}
+	for _, nr := range r.ranges {
+		if nr.pattern.MatchString(national) {
+			return nr.typ, nil
+		}
+	}
+	return 0, ErrNotInPlan
+}
@@ -0,0 +1,119 @@
+package phonenumber
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		number, region string
+		e164           string
+		typ            Type
+	}{
+		// The spellings of one UK mobile number
+		{"+44 7700 900123", "", "+447700900123", Mobile},
+		{"07700 900123", "GB", "+447700900123", Mobile},
+		{"447700900123", "GB", "+447700900123", Mobile},
+		{"00447700900123", "GB", "+447700900123", Mobile},
+		{"+44 (0)7700 900123", "US", "+447700900123", Mobile},
+		{"tel:+44-7700-900123;ext=12", "", "+447700900123", Mobile},
+		{"07700 900123", "gb", "+447700900123", Mobile},
+
+		{"020 7946 0018", "GB", "+442079460018", FixedLine},
+		{"0800 123 456", "GB", "+44800123456", TollFree},
+		{"(212) 555-0123", "US", "+12125550123", FixedLineOrMobile},
+		{"1-800-555-0199", "US", "+18005550199", TollFree},
+		{"011 33 6 12 34 56 78", "US", "+33612345678", Mobile},
+		{"06 12 34 56 78", "FR", "+33612345678", Mobile},
+		// Italian fixed lines keep their leading zero
+		{"06 1234 5678", "IT", "+390612345678", FixedLine},
+		{"+39 312 345 6789", "", "+393123456789", Mobile},
+		{"0151 12345678", "DE", "+4915112345678", Mobile},
+		{"0412 345 678", "AU", "+61412345678", Mobile},
+		{"+353 85 123 4567", "GB", "+353851234567", Mobile},
+	} {
+		n, err := Parse(test.number, test.region)
+		if err != nil {
+			t.Errorf("%q in %q: %v", test.number, test.region, err)
+			continue
+		}
+		if n.E164() != test.e164 || n.Type != test.typ {
+			t.Errorf("%q in %q: got %s (%s), expected %s (%s)", test.number, test.region, n, n.Type, test.e164, test.typ)
+		}
+	}
+}
+
+func TestParseWithoutPlan(t *testing.T) {
+	// Denmark and Kenya have no numbering plan here
+	for number, e164 := range map[string]string{
+		"+45 32 12 34 56":  "+4532123456",
+		"+254 712 345678":  "+254712345678",
+		"0045 32 12 34 56": "+4532123456",
+	} {
+		n, err := Parse(number, "GB")
+		if err != nil {
+			t.Errorf("%q: %v", number, err)
+			continue
+		}
+		if n.E164() != e164 || n.Region != "" || n.Type != 0 {
+			t.Errorf("%q: got %s in %q (%s), expected %s", number, n, n.Region, n.Type, e164)
+		}
+	}
+	if n, _ := Parse("+254 712 345678", ""); n.CountryCode != 254 {
+		t.Errorf("Country calling code read as %d", n.CountryCode)
+	}
+}
+
+func TestParseRegion(t *testing.T) {
+	n, err := Parse("+1 416 555 0123", "CA")
+	if err != nil || n.Region != "CA" {
+		t.Errorf("Number of the default region attributed to %q: %v", n.Region, err)
+	}
+	n, err = Parse("+1 416 555 0123", "GB")
+	if err != nil || n.Region != "US" {
+		t.Errorf("Number of a shared country calling code attributed to %q: %v", n.Region, err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, test := range []struct {
+		number, region string
+		err            error
+	}{
+		{"", "GB", ErrEmpty},
+		{" - ", "GB", ErrEmpty},
+		{"0800-FLOWERS", "GB", ErrInvalidCharacter},
+		{"07700 900123", "", ErrNoRegion},
+		{"07700 900123", "XX", ErrUnknownRegion},
+		{"+999 123 456 789", "", ErrUnknownCountryCode},
+		{"+45 1234", "", ErrTooShort},
+		{"+45 1234 5678 9012 34", "", ErrTooLong},
+		{"0770090", "GB", ErrTooShort},
+		{"+44 7700 900123 4", "", ErrTooLong},
+		{"06 7700 9001", "GB", ErrNotInPlan},
+		{"(212) 155-0123", "US", ErrNotInPlan},
+	} {
+		_, err := Parse(test.number, test.region)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%q in %q: got %v, expected %v", test.number, test.region, err, test.err)
+		}
+		if e, ok := err.(*Error); ok && e.Number != test.number {
+			t.Errorf("Error reports number %q instead of %q", e.Number, test.number)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	a, err := Normalize("07700 900123", "GB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Normalize("+44 7700 900 123", "FR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Errorf("Spellings of the same number normalize to %s and %s", a, b)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/nmohnblatt/cd_client/ibs"
+	"github.com/nmohnblatt/cd_client/identifier"
+)
+
+// Sign content before it is written at a meeting point. The contact can then check that it
+// was written by the identifier they expect and not by someone else who learned the meeting point.
+// Posts are signed under the identifier of the registration r.
+// Format: len(content) || content || signature
+func signPost(r *registration, content []byte) ([]byte, error) {
+	if r.sk1 == nil {
+		return nil, errors.New("post: private key unknown, fetch private keys first")
+	}
+
+	sig, err := ibs.Sign(suite, r.sk1, r.id.Bytes(), content)
+	if err != nil {
+		return nil, err
+	}
+
+	post := make([]byte, 4, 4+len(content)+len(sig))
+	binary.BigEndian.PutUint32(post, uint32(len(content)))
+	post = append(post, content...)
+	post = append(post, sig...)
+
+	return post, nil
+}
+
+// Check that a post read at a meeting point was signed by sender and return its content
+func verifyPost(u *user, sender identifier.Identifier, post []byte) ([]byte, error) {
+	if u.groupKey1 == nil {
+		return nil, errors.New("post: group public key unknown, fetch private keys first")
+	}
+
+	if len(post) < 4 {
+		return nil, errors.New("post: malformed post")
+	}
+	n := int(binary.BigEndian.Uint32(post))
+	if len(post)-4 < n {
+		return nil, errors.New("post: malformed post")
+	}
+	content, sig := post[4:4+n], post[4+n:]
+
+	if err := ibs.Verify(suite, u.groupKey1, sender.Bytes(), content, sig); err != nil {
+		return nil, err
+	}
+
+	return content, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"go.dedis.ch/kyber/v3/util/random"
+)
+
+func TestSignedPost(t *testing.T) {
+	n := 10
+	thr := n/2 + 1
+
+	secret := suite.GT().Scalar().Pick(random.New())
+	serverList, pubPoly1, pubPoly2 := setupThresholdServers(suite, secret, n, thr)
+
+	alice := testUser(t, "Alice", "07111111111")
+	bob := testUser(t, "Bob", "07222222222")
+	charlie := testUser(t, "Charlie", "07333333333")
+	for _, u := range []*user{alice, bob, charlie} {
+		if err := u.obtainPrivateKeysBlindThreshold(suite, serverList[:thr], pubPoly1, pubPoly2, thr, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	content := []byte("Hi Bob, it's Alice")
+	post, err := signPost(alice.registration, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test, err := verifyPost(bob, alice.id, post)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(test, content) {
+		t.Errorf("Content does not match")
+	}
+
+	// Charlie learned the meeting point and tries to pass as Alice
+	forged, err := signPost(charlie.registration, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifyPost(bob, alice.id, forged); err == nil {
+		t.Errorf("Accepted a post signed by Charlie as coming from Alice")
+	}
+
+	// Content cannot be altered after signing
+	post[5] ^= 1
+	if _, err := verifyPost(bob, alice.id, post); err == nil {
+		t.Errorf("Accepted a tampered post")
+	}
+}
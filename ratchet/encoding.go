@@ -0,0 +1,109 @@
+package ratchet
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Version of the encoding of the state
+const stateVersion = 1
+
+const (
+	flagRemote = 1 << iota
+	flagSend
+	flagReceive
+)
+
+const (
+	fixedStateSize = 1 + 1 + 6*keySize + 3*4 + 4
+	skippedSize    = keySize + 4 + keySize
+)
+
+// MarshalBinary encodes the state for storage. The encoding holds secret keys and must be
+// stored encrypted.
+//
+//	version (1) | flags (1) | ratchet private key | ratchet public key | remote ratchet key |
+//	root key | sending chain key | receiving chain key | sending message number |
+//	receiving message number | previous chain length | associated data length (4) |
+//	associated data | skipped keys count (4) | (ratchet key | message number | message key)*
+//
+// Skipped keys are listed oldest first.
+func (s *State) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 0, fixedStateSize+len(s.ad)+4+len(s.skippedOrder)*skippedSize)
+	var flags byte
+	if s.hasRemote {
+		flags |= flagRemote
+	}
+	if s.hasSend {
+		flags |= flagSend
+	}
+	if s.hasReceive {
+		flags |= flagReceive
+	}
+	buf = append(buf, stateVersion, flags)
+	for _, k := range []*[keySize]byte{&s.dhPrivate, &s.dhPublic, &s.remote, &s.root, &s.sendChain, &s.receiveChain} {
+		buf = append(buf, k[:]...)
+	}
+	buf = appendUint32(buf, s.sendN, s.receiveN, s.previous, uint32(len(s.ad)))
+	buf = append(buf, s.ad...)
+	buf = appendUint32(buf, uint32(len(s.skippedOrder)))
+	for _, k := range s.skippedOrder {
+		mk := s.skipped[k]
+		buf = append(buf, k.ratchetKey[:]...)
+		buf = appendUint32(buf, k.n)
+		buf = append(buf, mk[:]...)
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary decodes a state encoded by MarshalBinary
+func (s *State) UnmarshalBinary(data []byte) error {
+	if len(data) < fixedStateSize || data[0] != stateVersion {
+		return errors.New("ratchet: malformed state")
+	}
+	var d State
+	flags := data[1]
+	d.hasRemote, d.hasSend, d.hasReceive = flags&flagRemote != 0, flags&flagSend != 0, flags&flagReceive != 0
+	data = data[2:]
+	for _, k := range []*[keySize]byte{&d.dhPrivate, &d.dhPublic, &d.remote, &d.root, &d.sendChain, &d.receiveChain} {
+		copy(k[:], data)
+		data = data[keySize:]
+	}
+	d.sendN, d.receiveN, d.previous = binary.BigEndian.Uint32(data), binary.BigEndian.Uint32(data[4:]), binary.BigEndian.Uint32(data[8:])
+	n := binary.BigEndian.Uint32(data[12:])
+	data = data[16:]
+	if uint64(len(data)) < uint64(n)+4 {
+		return errors.New("ratchet: malformed state")
+	}
+	d.ad = append([]byte(nil), data[:n]...)
+	data = data[n:]
+
+	count := binary.BigEndian.Uint32(data)
+	data = data[4:]
+	if uint64(len(data)) != uint64(count)*skippedSize {
+		return errors.New("ratchet: malformed state")
+	}
+	d.skipped = make(map[skippedKey][keySize]byte, count)
+	for i := uint32(0); i < count; i++ {
+		var k skippedKey
+		var mk [keySize]byte
+		copy(k.ratchetKey[:], data)
+		k.n = binary.BigEndian.Uint32(data[keySize:])
+		copy(mk[:], data[keySize+4:])
+		d.skipped[k] = mk
+		d.skippedOrder = append(d.skippedOrder, k)
+		data = data[skippedSize:]
+	}
+
+	*s = d
+	return nil
+}
+
+func appendUint32(buf []byte, values ...uint32) []byte {
+	var b [4]byte
+	for _, v := range values {
+		binary.BigEndian.PutUint32(b[:], v)
+		buf = append(buf, b[:]...)
+	}
+	return buf
+}
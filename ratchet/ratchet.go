@@ -0,0 +1,337 @@
+// Package ratchet implements the Double Ratchet algorithm of the Signal protocol on top of a
+// session established with package x3dh.
+//
+// Every message carries the sender's current ratchet public key. Receiving a new ratchet key
+// triggers a Diffie-Hellman ratchet step that refreshes the root key, so that a party whose
+// state leaked recovers secrecy as soon as both sides have sent a message. Within a sending
+// chain, every message is sealed under its own key derived by a symmetric KDF chain, so that
+// past messages stay secret even if the current state leaks.
+//
+// Messages are encoded as
+//
+//	ratchet key (32) | previous chain length (4) | message number (4) | ciphertext
+//
+// The header is authenticated together with the associated data of the session.
+package ratchet
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// MaxSkip is the largest number of message keys stored for a single chain, which bounds the
+// work an attacker can force on a receiver by sending a large message number
+const MaxSkip = 1000
+
+// MaxSkipped is the total number of message keys stored for messages not yet received
+const MaxSkipped = 2000
+
+const (
+	keySize    = 32
+	headerSize = keySize + 4 + 4
+
+	labelRoot    = "cd_client ratchet root v1"
+	labelMessage = "cd_client ratchet message v1"
+)
+
+// Header is the clear part of a message
+type Header struct {
+	RatchetKey [keySize]byte
+	// Number of messages in the sender's previous sending chain
+	PreviousChain uint32
+	// Number of the message in the current sending chain
+	N uint32
+}
+
+type skippedKey struct {
+	ratchetKey [keySize]byte
+	n          uint32
+}
+
+// State is the state of one side of a session. It must be persisted after every call to
+// Encrypt or Decrypt, with MarshalBinary.
+type State struct {
+	ad []byte
+
+	dhPrivate, dhPublic [keySize]byte
+	remote              [keySize]byte
+	hasRemote           bool
+
+	root                      [keySize]byte
+	sendChain, receiveChain   [keySize]byte
+	hasSend, hasReceive       bool
+	sendN, receiveN, previous uint32
+
+	skipped map[skippedKey][keySize]byte
+	// Insertion order of the skipped keys, oldest first, for eviction
+	skippedOrder []skippedKey
+}
+
+// NewInitiator starts the session of the party that ran the X3DH handshake as initiator.
+// remote is the responder's signed prekey, which serves as their first ratchet key.
+func NewInitiator(rootKey, ad []byte, remote [keySize]byte) (*State, error) {
+	s, err := newState(rootKey, ad)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.generate(); err != nil {
+		return nil, err
+	}
+	s.remote, s.hasRemote = remote, true
+	if err := s.rootStep(&s.sendChain); err != nil {
+		return nil, err
+	}
+	s.hasSend = true
+
+	return s, nil
+}
+
+// NewResponder starts the session of the party that ran the X3DH handshake as responder, with
+// the private and public parts of the signed prekey that the initiator used.
+func NewResponder(rootKey, ad []byte, private, public [keySize]byte) (*State, error) {
+	s, err := newState(rootKey, ad)
+	if err != nil {
+		return nil, err
+	}
+	s.dhPrivate, s.dhPublic = private, public
+
+	return s, nil
+}
+
+func newState(rootKey, ad []byte) (*State, error) {
+	if len(rootKey) != keySize {
+		return nil, errors.New("ratchet: invalid root key")
+	}
+	s := &State{ad: append([]byte(nil), ad...), skipped: map[skippedKey][keySize]byte{}}
+	copy(s.root[:], rootKey)
+
+	return s, nil
+}
+
+// Encrypt seals a message for the other party
+func (s *State) Encrypt(plaintext []byte) ([]byte, error) {
+	if !s.hasSend {
+		return nil, errors.New("ratchet: waiting for the initiator's first message")
+	}
+	h := Header{RatchetKey: s.dhPublic, PreviousChain: s.previous, N: s.sendN}
+	mk := chainStep(&s.sendChain)
+	s.sendN++
+
+	header := h.marshal()
+	return seal(mk, header, s.associatedData(header), plaintext)
+}
+
+// Decrypt opens a message from the other party. Messages may arrive out of order: keys of
+// skipped messages are kept until they arrive, within MaxSkip per chain. The state is left
+// untouched if the message does not open.
+func (s *State) Decrypt(message []byte) ([]byte, error) {
+	if len(message) < headerSize {
+		return nil, errors.New("ratchet: message too short")
+	}
+	header, ciphertext := message[:headerSize], message[headerSize:]
+	h := parseHeader(header)
+	ad := s.associatedData(header)
+
+	if mk, ok := s.skipped[skippedKey{h.RatchetKey, h.N}]; ok {
+		plaintext, err := open(mk, ad, ciphertext)
+		if err != nil {
+			return nil, err
+		}
+		s.deleteSkipped(skippedKey{h.RatchetKey, h.N})
+		return plaintext, nil
+	}
+
+	// Work on a copy so that forged messages cannot corrupt the state
+	next := s.clone()
+	if !next.hasRemote || h.RatchetKey != next.remote {
+		if err := next.skip(h.PreviousChain); err != nil {
+			return nil, err
+		}
+		if err := next.dhStep(h.RatchetKey); err != nil {
+			return nil, err
+		}
+	}
+	if err := next.skip(h.N); err != nil {
+		return nil, err
+	}
+	mk := chainStep(&next.receiveChain)
+	next.receiveN++
+
+	plaintext, err := open(mk, ad, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	*s = *next
+	return plaintext, nil
+}
+
+// Store the keys of the messages of the receiving chain up to message until
+func (s *State) skip(until uint32) error {
+	if !s.hasReceive {
+		return nil
+	}
+	if until < s.receiveN {
+		return errors.New("ratchet: message already received")
+	}
+	if until-s.receiveN > MaxSkip {
+		return errors.New("ratchet: too many skipped messages")
+	}
+	for s.receiveN < until {
+		k := skippedKey{s.remote, s.receiveN}
+		s.skipped[k] = chainStep(&s.receiveChain)
+		s.skippedOrder = append(s.skippedOrder, k)
+		s.receiveN++
+	}
+	for len(s.skippedOrder) > MaxSkipped {
+		delete(s.skipped, s.skippedOrder[0])
+		s.skippedOrder = s.skippedOrder[1:]
+	}
+	return nil
+}
+
+func (s *State) deleteSkipped(k skippedKey) {
+	delete(s.skipped, k)
+	for i, o := range s.skippedOrder {
+		if o == k {
+			s.skippedOrder = append(s.skippedOrder[:i:i], s.skippedOrder[i+1:]...)
+			break
+		}
+	}
+}
+
+// Diffie-Hellman ratchet step on receiving a new ratchet key
+func (s *State) dhStep(remote [keySize]byte) error {
+	s.previous, s.sendN, s.receiveN = s.sendN, 0, 0
+	s.remote, s.hasRemote = remote, true
+	if err := s.rootStep(&s.receiveChain); err != nil {
+		return err
+	}
+	s.hasReceive = true
+	if err := s.generate(); err != nil {
+		return err
+	}
+	if err := s.rootStep(&s.sendChain); err != nil {
+		return err
+	}
+	s.hasSend = true
+
+	return nil
+}
+
+func (s *State) generate() error {
+	if _, err := io.ReadFull(rand.Reader, s.dhPrivate[:]); err != nil {
+		return err
+	}
+	curve25519.ScalarBaseMult(&s.dhPublic, &s.dhPrivate)
+	return nil
+}
+
+// Mix DH(our ratchet key, their ratchet key) into the root key and output a new chain key
+func (s *State) rootStep(chain *[keySize]byte) error {
+	var shared, zero [keySize]byte
+	curve25519.ScalarMult(&shared, &s.dhPrivate, &s.remote)
+	if shared == zero {
+		return errors.New("ratchet: invalid ratchet key")
+	}
+
+	out := make([]byte, 2*keySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared[:], s.root[:], []byte(labelRoot)), out); err != nil {
+		return err
+	}
+	copy(s.root[:], out)
+	copy(chain[:], out[keySize:])
+
+	return nil
+}
+
+// Advance a chain and return the message key
+func chainStep(chain *[keySize]byte) [keySize]byte {
+	var mk [keySize]byte
+	mac := hmac.New(sha256.New, chain[:])
+	mac.Write([]byte{1})
+	copy(mk[:], mac.Sum(nil))
+
+	mac = hmac.New(sha256.New, chain[:])
+	mac.Write([]byte{2})
+	copy(chain[:], mac.Sum(nil))
+
+	return mk
+}
+
+func (s *State) associatedData(header []byte) []byte {
+	ad := make([]byte, 4, 4+len(s.ad)+len(header))
+	binary.BigEndian.PutUint32(ad, uint32(len(s.ad)))
+	ad = append(ad, s.ad...)
+	return append(ad, header...)
+}
+
+func (s *State) clone() *State {
+	c := *s
+	c.skipped = make(map[skippedKey][keySize]byte, len(s.skipped))
+	for k, v := range s.skipped {
+		c.skipped[k] = v
+	}
+	c.skippedOrder = append([]skippedKey(nil), s.skippedOrder...)
+	return &c
+}
+
+func (h *Header) marshal() []byte {
+	buf := make([]byte, headerSize)
+	copy(buf, h.RatchetKey[:])
+	binary.BigEndian.PutUint32(buf[keySize:], h.PreviousChain)
+	binary.BigEndian.PutUint32(buf[keySize+4:], h.N)
+	return buf
+}
+
+func parseHeader(buf []byte) Header {
+	var h Header
+	copy(h.RatchetKey[:], buf)
+	h.PreviousChain = binary.BigEndian.Uint32(buf[keySize:])
+	h.N = binary.BigEndian.Uint32(buf[keySize+4:])
+	return h
+}
+
+// Message keys are used once, so the AEAD key and nonce are both derived from them
+func messageCipher(mk [keySize]byte) ([]byte, []byte, error) {
+	out := make([]byte, chacha20poly1305.KeySize+chacha20poly1305.NonceSize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, mk[:], nil, []byte(labelMessage)), out); err != nil {
+		return nil, nil, err
+	}
+	return out[:chacha20poly1305.KeySize], out[chacha20poly1305.KeySize:], nil
+}
+
+func seal(mk [keySize]byte, header, ad, plaintext []byte) ([]byte, error) {
+	key, nonce, err := messageCipher(mk)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(header, nonce, plaintext, ad), nil
+}
+
+func open(mk [keySize]byte, ad, ciphertext []byte) ([]byte, error) {
+	key, nonce, err := messageCipher(mk)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, ad)
+	if err != nil {
+		return nil, errors.New("ratchet: decryption failed")
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,173 @@
+package ratchet
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"testing"
+
+	"github.com/nmohnblatt/cd_client/x3dh"
+)
+
+// Run an X3DH handshake and start both sides of the ratchet
+func newPair(t *testing.T) (*State, *State) {
+	alice, _ := x3dh.NewIdentity(rand.Reader)
+	bob, _ := x3dh.NewIdentity(rand.Reader)
+	spk, _ := x3dh.GenerateKeyPair(rand.Reader)
+	psk := bytes.Repeat([]byte{7}, 32)
+
+	s1, m, err := x3dh.Initiate(rand.Reader, alice, x3dh.NewBundle(bob, spk, nil), psk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := x3dh.Respond(bob, spk, nil, m, psk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewInitiator(s1.RootKey, s1.AssociatedData, spk.Public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewResponder(s2.RootKey, s2.AssociatedData, spk.Private, spk.Public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, b
+}
+
+func send(t *testing.T, s *State, text string) []byte {
+	m, err := s.Encrypt([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func expect(t *testing.T, s *State, m []byte, text string) {
+	t.Helper()
+	got, err := s.Decrypt(m)
+	if err != nil {
+		t.Fatalf("Could not decrypt %q: %v", text, err)
+	}
+	if string(got) != text {
+		t.Errorf("Got %q, expected %q", got, text)
+	}
+}
+
+func TestConversation(t *testing.T) {
+	alice, bob := newPair(t)
+
+	if _, err := bob.Encrypt([]byte("hi")); err == nil {
+		t.Errorf("Responder sent before receiving the first message")
+	}
+	expect(t, bob, send(t, alice, "hello"), "hello")
+	expect(t, bob, send(t, alice, "are you there?"), "are you there?")
+	expect(t, alice, send(t, bob, "yes"), "yes")
+	expect(t, bob, send(t, alice, "great"), "great")
+	expect(t, alice, send(t, bob, "bye"), "bye")
+}
+
+func TestOutOfOrder(t *testing.T) {
+	alice, bob := newPair(t)
+
+	var first []string
+	var messages [][]byte
+	for i := 0; i < 4; i++ {
+		first = append(first, fmt.Sprint("message ", i))
+		messages = append(messages, send(t, alice, first[i]))
+	}
+	expect(t, bob, messages[2], first[2])
+	expect(t, bob, messages[0], first[0])
+
+	// Bob replies, starting a new chain before Alice's chain is fully received
+	expect(t, alice, send(t, bob, "reply"), "reply")
+	late := send(t, alice, "new chain")
+	expect(t, bob, late, "new chain")
+	expect(t, bob, messages[3], first[3])
+	expect(t, bob, messages[1], first[1])
+
+	// Every message is delivered once
+	for _, m := range append(messages, late) {
+		if _, err := bob.Decrypt(m); err == nil {
+			t.Errorf("Replayed message was decrypted")
+		}
+	}
+}
+
+func TestTooManySkipped(t *testing.T) {
+	alice, bob := newPair(t)
+
+	var m []byte
+	for i := 0; i <= MaxSkip+1; i++ {
+		m = send(t, alice, "flood")
+	}
+	if _, err := bob.Decrypt(m); err == nil {
+		t.Errorf("Stored more than MaxSkip message keys")
+	}
+}
+
+func TestTampered(t *testing.T) {
+	alice, bob := newPair(t)
+
+	m := send(t, alice, "hello")
+	for _, i := range []int{0, headerSize - 1, len(m) - 1} {
+		forged := append([]byte(nil), m...)
+		forged[i] ^= 1
+		if _, err := bob.Decrypt(forged); err == nil {
+			t.Errorf("Accepted a message tampered at byte %d", i)
+		}
+	}
+	// Failed attempts leave the state untouched
+	expect(t, bob, m, "hello")
+}
+
+func TestCompromisedState(t *testing.T) {
+	alice, bob := newPair(t)
+	expect(t, bob, send(t, alice, "hello"), "hello")
+	expect(t, alice, send(t, bob, "hi"), "hi")
+
+	// An attacker copies Bob's state
+	leaked, _ := bob.MarshalBinary()
+	eve := &State{}
+	if err := eve.UnmarshalBinary(leaked); err != nil {
+		t.Fatal(err)
+	}
+
+	// Messages in the current chain are exposed...
+	m := send(t, alice, "exposed")
+	expect(t, eve, m, "exposed")
+	expect(t, bob, m, "exposed")
+
+	// ...but secrecy is restored after a round trip of DH ratchet steps
+	expect(t, alice, send(t, bob, "new key"), "new key")
+	m = send(t, alice, "secret")
+	if _, err := eve.Decrypt(m); err == nil {
+		t.Errorf("Leaked state decrypted a message after recovery")
+	}
+	expect(t, bob, m, "secret")
+}
+
+func TestPersistence(t *testing.T) {
+	alice, bob := newPair(t)
+
+	skipped := send(t, alice, "skipped")
+	expect(t, bob, send(t, alice, "hello"), "hello")
+
+	// Both sides reload their state from storage
+	for _, s := range []*State{alice, bob} {
+		data, err := s.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect(t, bob, skipped, "skipped")
+	expect(t, alice, send(t, bob, "reloaded"), "reloaded")
+
+	if err := (&State{}).UnmarshalBinary([]byte{stateVersion, 0}); err == nil {
+		t.Errorf("Decoded a truncated state")
+	}
+}
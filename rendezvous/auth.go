@@ -0,0 +1,85 @@
+package rendezvous
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers carrying the proof of knowledge of a meeting point's write key
+const (
+	headerKey       = "X-Cd-Key"
+	headerTimestamp = "X-Cd-Timestamp"
+	headerNonce     = "X-Cd-Nonce"
+	headerSignature = "X-Cd-Signature"
+)
+
+// MaxClockSkew is how far the timestamp of a signed request may be from the server's clock
+const MaxClockSkew = 5 * time.Minute
+
+const signatureLabel = "cd_rendezvous request v1"
+
+const keyIDLabel = "cd_rendezvous meeting point v1"
+
+// KeyID returns the ID of the meeting point written with the key pub on a rendezvous server.
+// The ID commits to the key, so nobody else can write under it, even before its first write.
+func KeyID(pub ed25519.PublicKey) string {
+	h := sha256.New()
+	h.Write([]byte(keyIDLabel))
+	h.Write(pub)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// The signature covers the method, the path, the time and the body of the request. The random
+// nonce makes every signature unique so that the server can reject replays.
+func requestMessage(method, path string, timestamp int64, nonce string, body []byte) []byte {
+	digest := sha256.Sum256(body)
+	msg := signatureLabel + "\n" + method + "\n" + path + "\n" + strconv.FormatInt(timestamp, 10) + "\n" + nonce + "\n" + hex.EncodeToString(digest[:])
+	return []byte(msg)
+}
+
+// Sign a request to the rendezvous server with the write key of its meeting point
+func signRequest(req *http.Request, key ed25519.PrivateKey, body []byte) {
+	timestamp := time.Now().Unix()
+	n := make([]byte, 16)
+	if _, err := rand.Read(n); err != nil {
+		panic(err)
+	}
+	nonce := base64.StdEncoding.EncodeToString(n)
+	sig := ed25519.Sign(key, requestMessage(req.Method, req.URL.EscapedPath(), timestamp, nonce, body))
+
+	req.Header.Set(headerKey, base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)))
+	req.Header.Set(headerTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(headerNonce, nonce)
+	req.Header.Set(headerSignature, base64.StdEncoding.EncodeToString(sig))
+}
+
+// Check the signature of a request and return the public key that produced it
+func verifyRequest(r *http.Request, body []byte, now time.Time) (ed25519.PublicKey, []byte, error) {
+	pub, err := base64.StdEncoding.DecodeString(r.Header.Get(headerKey))
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return nil, nil, errors.New("missing or malformed write key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(r.Header.Get(headerSignature))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return nil, nil, errors.New("missing or malformed signature")
+	}
+	timestamp, err := strconv.ParseInt(r.Header.Get(headerTimestamp), 10, 64)
+	if err != nil {
+		return nil, nil, errors.New("missing or malformed timestamp")
+	}
+	if d := now.Sub(time.Unix(timestamp, 0)); d > MaxClockSkew || d < -MaxClockSkew {
+		return nil, nil, errors.New("timestamp out of range")
+	}
+
+	if !ed25519.Verify(pub, requestMessage(r.Method, r.URL.EscapedPath(), timestamp, r.Header.Get(headerNonce), body), sig) {
+		return nil, nil, errors.New("invalid signature")
+	}
+	return pub, sig, nil
+}
@@ -0,0 +1,95 @@
+package rendezvous
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Dir is a Rendezvous backed by a directory, e.g. a folder synchronised between devices.
+// Each meeting point is a sub-directory and each record a file.
+type Dir struct {
+	root string
+}
+
+// NewDir returns a store rooted at the given directory, creating it if needed
+func NewDir(root string) (*Dir, error) {
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, err
+	}
+	return &Dir{root: root}, nil
+}
+
+// Put creates or replaces a record. The file is written atomically.
+func (d *Dir) Put(id, name string, data []byte) error {
+	if err := checkNames(id, name); err != nil {
+		return err
+	}
+	dir := filepath.Join(d.root, id)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, name))
+}
+
+// Get returns the content of a record
+func (d *Dir) Get(id, name string) ([]byte, error) {
+	if err := checkNames(id, name); err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(filepath.Join(d.root, id, name))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// List returns the names of the records under a meeting point
+func (d *Dir) List(id string) ([]string, error) {
+	if err := checkName(id); err != nil {
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir(filepath.Join(d.root, id))
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.Mode().IsRegular() && checkName(e.Name()) == nil {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Delete removes a record
+func (d *Dir) Delete(id, name string) error {
+	if err := checkNames(id, name); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(d.root, id, name))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,132 @@
+package rendezvous
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Authorizer is implemented by backends on which writes must prove knowledge of the write key
+// of the meeting point. Meeting points on such backends are identified by their write key.
+type Authorizer interface {
+	// Authorize signs the writes under the meeting point of key and returns its ID
+	Authorize(key ed25519.PrivateKey) string
+}
+
+// HTTP is a Rendezvous backed by a cd_rendezvous server (see cmd/cd_rendezvous).
+// Writes under a meeting point must be authorized with its write key first, which gives the
+// ID of the meeting point.
+type HTTP struct {
+	url    string
+	client *http.Client
+
+	mu   sync.Mutex
+	keys map[string]ed25519.PrivateKey
+}
+
+// NewHTTP returns a store that talks to the cd_rendezvous server at url
+func NewHTTP(url string) *HTTP {
+	return &HTTP{url: strings.TrimSuffix(url, "/"), client: http.DefaultClient, keys: map[string]ed25519.PrivateKey{}}
+}
+
+// Authorize signs the writes under the meeting point of key and returns its ID
+func (s *HTTP) Authorize(key ed25519.PrivateKey) string {
+	id := KeyID(key.Public().(ed25519.PublicKey))
+	s.mu.Lock()
+	s.keys[id] = key
+	s.mu.Unlock()
+	return id
+}
+
+// Put creates or replaces a record
+func (s *HTTP) Put(id, name string, data []byte) error {
+	if err := checkNames(id, name); err != nil {
+		return err
+	}
+	_, err := s.do(http.MethodPut, id, name, data)
+	return err
+}
+
+// Get returns the content of a record
+func (s *HTTP) Get(id, name string) ([]byte, error) {
+	if err := checkNames(id, name); err != nil {
+		return nil, err
+	}
+	return s.do(http.MethodGet, id, name, nil)
+}
+
+// List returns the names of the records under a meeting point
+func (s *HTTP) List(id string) ([]string, error) {
+	if err := checkName(id); err != nil {
+		return nil, err
+	}
+	body, err := s.do(http.MethodGet, id, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	if err := json.Unmarshal(body, &names); err != nil {
+		return nil, errors.New("rendezvous: malformed listing")
+	}
+	return names, nil
+}
+
+// Delete removes a record
+func (s *HTTP) Delete(id, name string) error {
+	if err := checkNames(id, name); err != nil {
+		return err
+	}
+	_, err := s.do(http.MethodDelete, id, name, nil)
+	return err
+}
+
+// Append adds a record to the append-only mailbox of the meeting point and returns its name.
+// Mailbox records are listed and read like any other, and can be deleted once read.
+func (s *HTTP) Append(id string, data []byte) (string, error) {
+	if err := checkName(id); err != nil {
+		return "", err
+	}
+	name, err := s.do(http.MethodPost, id, "mailbox", data)
+	return string(name), err
+}
+
+func (s *HTTP) do(method, id, name string, data []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, s.url+"/v1/"+id+"/"+name, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if method != http.MethodGet {
+		s.mu.Lock()
+		key := s.keys[id]
+		s.mu.Unlock()
+		if key == nil {
+			return nil, errors.New("rendezvous: no write key for meeting point " + id)
+		}
+		signRequest(req, key, data)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("rendezvous: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
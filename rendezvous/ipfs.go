@@ -0,0 +1,257 @@
+package rendezvous
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nmohnblatt/cd_client/ipfsapi"
+	"github.com/nmohnblatt/cd_client/ipns"
+)
+
+// Validity and cache lifetime of the IPNS records published for meeting points
+const (
+	recordLifetime = 48 * time.Hour
+	recordTTL      = time.Minute
+)
+
+// IPFS is a Rendezvous backed by the mutable file system (MFS) of an IPFS node.
+// Records are written under /cd_client/<id>/<name> through the HTTP API of the daemon
+// (see README). Each node has its own MFS: call Sync to exchange records with the contact.
+// The records of the snapshot last published for a meeting point are listed in
+// /cd_client/.sync/<id>, which meeting point identifiers cannot clash with.
+type IPFS struct {
+	client *ipfsapi.Client
+	root   string
+}
+
+// NewIPFS returns a store that talks to the daemon API at apiURL (ipfsapi.DefaultURL if empty)
+func NewIPFS(apiURL string) *IPFS {
+	return &IPFS{client: ipfsapi.NewClient(apiURL), root: "/cd_client"}
+}
+
+// Put creates or replaces a record
+func (s *IPFS) Put(id, name string, data []byte) error {
+	if err := checkNames(id, name); err != nil {
+		return err
+	}
+	return s.client.FilesWrite(path.Join(s.root, id, name), data)
+}
+
+// Get returns the content of a record
+func (s *IPFS) Get(id, name string) ([]byte, error) {
+	if err := checkNames(id, name); err != nil {
+		return nil, err
+	}
+	data, err := s.client.FilesRead(path.Join(s.root, id, name))
+	if ipfsapi.IsNotFound(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// List returns the names of the records under a meeting point
+func (s *IPFS) List(id string) ([]string, error) {
+	if err := checkName(id); err != nil {
+		return nil, err
+	}
+	names, err := s.client.FilesLs(path.Join(s.root, id))
+	if ipfsapi.IsNotFound(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// Delete removes a record
+func (s *IPFS) Delete(id, name string) error {
+	if err := checkNames(id, name); err != nil {
+		return err
+	}
+	err := s.client.FilesRm(path.Join(s.root, id, name))
+	if ipfsapi.IsNotFound(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Sync merges the records last published under the IPNS name of key into the local meeting
+// point, then publishes a snapshot of the meeting point under that name. Both contacts derive
+// the same key, so they publish to and resolve the same name without coordinating.
+//
+// Records are merged against the snapshot this node last published: a record the contact
+// added, replaced or deleted since then is added, replaced or deleted locally, unless it was
+// changed locally too, in which case the local record wins and reaches the contact with the
+// snapshot. A record deleted locally is thus not merged back while the contact's copy of it
+// is unchanged, across restarts too.
+func (s *IPFS) Sync(id string, key ed25519.PrivateKey) error {
+	if err := checkName(id); err != nil {
+		return err
+	}
+	pub := key.Public().(ed25519.PublicKey)
+	routingKey := "/ipns/" + ipns.Name(pub)
+
+	var seq uint64
+	record, err := s.client.RoutingGet(routingKey)
+	switch {
+	case err == nil:
+		r, err := ipns.Verify(pub, record)
+		if err != nil && err != ipns.ErrExpired {
+			return err
+		}
+		seq = r.Sequence + 1
+		if err == nil {
+			if err := s.merge(id, r.Value); err != nil {
+				return err
+			}
+		}
+	case !ipfsapi.IsNotFound(err):
+		return err
+	}
+
+	cid, err := s.client.FilesStat(path.Join(s.root, id))
+	if ipfsapi.IsNotFound(err) {
+		// Nothing to publish yet
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	published, err := s.client.Ls("/ipfs/" + cid)
+	if err != nil {
+		return err
+	}
+
+	record, err = ipns.Sign(key, &ipns.Record{
+		Value:    "/ipfs/" + cid,
+		Sequence: seq,
+		EOL:      time.Now().Add(recordLifetime),
+		TTL:      recordTTL,
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.client.RoutingPut(routingKey, record); err != nil {
+		return err
+	}
+	return s.client.FilesWrite(s.basePath(id), encodeLinks(published))
+}
+
+// Apply to the local meeting point the changes between the snapshot we last published and the
+// snapshot published by the contact
+func (s *IPFS) merge(id, snapshot string) error {
+	links, err := s.client.Ls(snapshot)
+	if err != nil {
+		return err
+	}
+	remote := linkMap(links)
+	local, err := s.localLinks(id)
+	if err != nil {
+		return err
+	}
+	base, err := s.base(id)
+	if err != nil {
+		return err
+	}
+
+	for name, hash := range remote {
+		if checkName(name) != nil {
+			continue
+		}
+		was, published := base[name]
+		have, ok := local[name]
+		if published && (was == hash || !ok || have != was) || !published && ok {
+			// Unchanged by the contact, or changed locally: the local record wins
+			continue
+		}
+		data, err := s.client.CatVerified(hash)
+		if err != nil {
+			return err
+		}
+		if err := s.Put(id, name, data); err != nil {
+			return err
+		}
+	}
+
+	for name, hash := range local {
+		if _, ok := remote[name]; ok || base[name] != hash {
+			continue
+		}
+		// Deleted by the contact, and unchanged locally
+		if err := s.Delete(id, name); err != nil && err != ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *IPFS) basePath(id string) string {
+	return path.Join(s.root, ".sync", id)
+}
+
+// Records of the local meeting point, by CID
+func (s *IPFS) localLinks(id string) (map[string]string, error) {
+	cid, err := s.client.FilesStat(path.Join(s.root, id))
+	if ipfsapi.IsNotFound(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	links, err := s.client.Ls("/ipfs/" + cid)
+	if err != nil {
+		return nil, err
+	}
+	return linkMap(links), nil
+}
+
+// Records of the snapshot we last published, by CID
+func (s *IPFS) base(id string) (map[string]string, error) {
+	data, err := s.client.FilesRead(s.basePath(id))
+	if ipfsapi.IsNotFound(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeLinks(data)
+}
+
+func linkMap(links []ipfsapi.Link) map[string]string {
+	m := make(map[string]string, len(links))
+	for _, l := range links {
+		m[l.Name] = l.Hash
+	}
+	return m
+}
+
+// Links are stored one per line, as the name and the CID separated by a space
+func encodeLinks(links []ipfsapi.Link) []byte {
+	var buf bytes.Buffer
+	for _, l := range links {
+		buf.WriteString(l.Name + " " + l.Hash + "\n")
+	}
+	return buf.Bytes()
+}
+
+func decodeLinks(data []byte) (map[string]string, error) {
+	m := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			return nil, errors.New("rendezvous: malformed snapshot listing")
+		}
+		m[fields[0]] = fields[1]
+	}
+	return m, scanner.Err()
+}
@@ -0,0 +1,72 @@
+package rendezvous
+
+import (
+	"sort"
+	"sync"
+)
+
+// Memory is an in-memory Rendezvous, for tests and local experiments
+type Memory struct {
+	mu      sync.Mutex
+	records map[string]map[string][]byte
+}
+
+// NewMemory returns an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{records: map[string]map[string][]byte{}}
+}
+
+// Put creates or replaces a record
+func (m *Memory) Put(id, name string, data []byte) error {
+	if err := checkNames(id, name); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.records[id] == nil {
+		m.records[id] = map[string][]byte{}
+	}
+	m.records[id][name] = append([]byte(nil), data...)
+	return nil
+}
+
+// Get returns the content of a record
+func (m *Memory) Get(id, name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, ok := m.records[id][name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// List returns the names of the records under a meeting point
+func (m *Memory) List(id string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.records[id]))
+	for name := range m.records[id] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Delete removes a record
+func (m *Memory) Delete(id, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.records[id][name]; !ok {
+		return ErrNotFound
+	}
+	delete(m.records[id], name)
+	if len(m.records[id]) == 0 {
+		delete(m.records, id)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Package rendezvous stores the records that contacts exchange at their meeting points.
+// Records are small blobs identified by a name and grouped under a meeting-point ID.
+package rendezvous
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+)
+
+// ErrNotFound is returned when a record does not exist at a meeting point
+var ErrNotFound = errors.New("rendezvous: record not found")
+
+// Rendezvous is a backend where contacts publish and fetch records under their meeting point
+type Rendezvous interface {
+	// Put creates or replaces the record name under the meeting point id
+	Put(id, name string, data []byte) error
+	// Get returns the content of a record, or ErrNotFound
+	Get(id, name string) ([]byte, error)
+	// List returns the names of all records under the meeting point id, in lexical order
+	List(id string) ([]string, error)
+	// Delete removes a record, or returns ErrNotFound
+	Delete(id, name string) error
+}
+
+// Publisher is implemented by backends on which records only become visible to the contact
+// once published, such as IPFS where every node has its own file system
+type Publisher interface {
+	// Sync exchanges records with the contact under the mutable name of key
+	Sync(id string, key ed25519.PrivateKey) error
+}
+
+// Appender is implemented by backends with an append-only mailbox per meeting point. Appended
+// records are named by the backend with MailboxPrefix, cannot be replaced, and are listed, read
+// and deleted like any other.
+type Appender interface {
+	// Append adds a record to the mailbox of the meeting point id and returns its name
+	Append(id string, data []byte) (string, error)
+}
+
+// ID returns the meeting-point ID under which records are stored
+func ID(meetingPoint []byte) string {
+	return hex.EncodeToString(meetingPoint)
+}
+
+// Meeting-point IDs and record names are used as path components by some backends,
+// so they are restricted to a safe alphabet
+func checkName(name string) error {
+	if len(name) == 0 || len(name) > 128 || name[0] == '.' {
+		return errors.New("rendezvous: invalid name " + name)
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.':
+		default:
+			return errors.New("rendezvous: invalid name " + name)
+		}
+	}
+	return nil
+}
+
+func checkNames(id, name string) error {
+	if err := checkName(id); err != nil {
+		return err
+	}
+	return checkName(name)
+}
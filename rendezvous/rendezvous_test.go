@@ -0,0 +1,198 @@
+package rendezvous
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/nmohnblatt/cd_client/ipfsapi/ipfstest"
+)
+
+// Behaviour shared by every backend
+func testRendezvous(t *testing.T, r Rendezvous, id string) {
+
+	names, err := r.List(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 0 {
+		t.Errorf("New meeting point is not empty: %v", names)
+	}
+	if _, err := r.Get(id, "missing"); err != ErrNotFound {
+		t.Errorf("Get on a missing record: got %v, want ErrNotFound", err)
+	}
+
+	if err := r.Put(id, "b", []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Put(id, "a", []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Put(id, "a", []byte("replaced")); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := r.Get(id, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte("replaced")) {
+		t.Errorf("Record was not replaced: %s", data)
+	}
+
+	names, err = r.List(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Errorf("Wrong listing: %v", names)
+	}
+
+	if err := r.Delete(id, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Delete(id, "a"); err != ErrNotFound {
+		t.Errorf("Delete on a missing record: got %v, want ErrNotFound", err)
+	}
+	if _, err := r.Get(id, "a"); err != ErrNotFound {
+		t.Errorf("Record was not deleted")
+	}
+
+	for _, name := range []string{"", "..", "../escape", "a/b", ".hidden"} {
+		if err := r.Put(id, name, []byte("x")); err == nil {
+			t.Errorf("Accepted invalid name %q", name)
+		}
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testRendezvous(t, NewMemory(), ID([]byte{0xde, 0xad, 0xbe, 0xef}))
+}
+
+func TestDir(t *testing.T) {
+	root, err := ioutil.TempDir("", "rendezvous")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	d, err := NewDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRendezvous(t, d, ID([]byte{0xde, 0xad, 0xbe, 0xef}))
+}
+
+func TestIPFS(t *testing.T) {
+	s := ipfstest.NewServer()
+	defer s.Close()
+
+	testRendezvous(t, NewIPFS(s.URL), ID([]byte{0xde, 0xad, 0xbe, 0xef}))
+}
+
+func TestIPFSSync(t *testing.T) {
+	s := ipfstest.NewServer()
+	defer s.Close()
+	peer := s.NewPeer()
+	defer peer.Close()
+
+	alice, bob := NewIPFS(s.URL), NewIPFS(peer.URL)
+	id := ID([]byte{0xde, 0xad, 0xbe, 0xef})
+	key := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+
+	if err := alice.Put(id, "from-alice", []byte("hello bob")); err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.Sync(id, key); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bob.Put(id, "from-bob", []byte("hello alice")); err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.Sync(id, key); err != nil {
+		t.Fatal(err)
+	}
+	data, err := bob.Get(id, "from-alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte("hello bob")) {
+		t.Errorf("Bob did not receive Alice's record")
+	}
+
+	// Alice deletes her copy of Bob's record once read: it must not come back
+	if err := alice.Sync(id, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.Get(id, "from-bob"); err != nil {
+		t.Fatalf("Alice did not receive Bob's record: %s", err)
+	}
+	if err := alice.Delete(id, "from-bob"); err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.Sync(id, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.Get(id, "from-bob"); err != ErrNotFound {
+		t.Errorf("Deleted record was merged back")
+	}
+}
+
+func TestIPFSSyncChanges(t *testing.T) {
+	s := ipfstest.NewServer()
+	defer s.Close()
+	peer := s.NewPeer()
+	defer peer.Close()
+
+	alice, bob := NewIPFS(s.URL), NewIPFS(peer.URL)
+	id := ID([]byte{0xde, 0xad, 0xbe, 0xef})
+	key := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	sync := func(stores ...*IPFS) {
+		for _, store := range stores {
+			if err := store.Sync(id, key); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := alice.Put(id, "prekeys", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.Put(id, "message", []byte("hello bob")); err != nil {
+		t.Fatal(err)
+	}
+	sync(alice, bob)
+
+	// A replaced record reaches the contact
+	if err := alice.Put(id, "prekeys", []byte("v2")); err != nil {
+		t.Fatal(err)
+	}
+	sync(alice, bob)
+	data, err := bob.Get(id, "prekeys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte("v2")) {
+		t.Errorf("Replaced record did not reach Bob: got %q", data)
+	}
+
+	// A deletion survives a restart and reaches the contact
+	if err := bob.Delete(id, "message"); err != nil {
+		t.Fatal(err)
+	}
+	bob = NewIPFS(peer.URL)
+	sync(alice, bob, alice)
+	if _, err := bob.Get(id, "message"); err != ErrNotFound {
+		t.Errorf("Deleted record was merged back after a restart")
+	}
+	if _, err := alice.Get(id, "message"); err != ErrNotFound {
+		t.Errorf("Deletion did not reach Alice")
+	}
+	if _, err := alice.Get(id, "prekeys"); err != nil {
+		t.Errorf("Unrelated record was deleted: %s", err)
+	}
+}
@@ -0,0 +1,269 @@
+package rendezvous
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MailboxPrefix starts the names of the records appended to a mailbox, which cannot be
+// overwritten
+const MailboxPrefix = "m-"
+
+// ServerConfig sets the limits enforced by a rendezvous server
+type ServerConfig struct {
+	// Maximum size of a record in bytes
+	MaxRecordSize int
+	// Maximum number of records under a meeting point
+	MaxRecords int
+	// Records expire this long after they were last written
+	TTL time.Duration
+	// Maximum number of request signatures remembered per meeting point to reject replays.
+	// Writes to a meeting point are refused while its limit is reached. Zero uses the default.
+	MaxSignatures int
+	// Maximum number of meeting points. Zero uses the default.
+	MaxPoints int
+}
+
+// DefaultServerConfig are the limits used by cd_rendezvous unless told otherwise
+var DefaultServerConfig = ServerConfig{
+	MaxRecordSize: 64 * 1024,
+	MaxRecords:    1024,
+	TTL:           7 * 24 * time.Hour,
+	MaxSignatures: 1024,
+	MaxPoints:     1 << 16,
+}
+
+// Server is an HTTP blob store keyed by meeting-point ID.
+//
+// Anyone can read, but writes must be signed with the write key of the meeting point, whose ID is
+// KeyID of the public key. The key is derived from the contacts' shared secret, so the server
+// never learns who meets, and nobody else can write under the ID.
+//
+// Routes:
+//
+//	GET    /v1/<id>/          list records (JSON array of names)
+//	GET    /v1/<id>/<name>    read a record
+//	PUT    /v1/<id>/<name>    create or replace a record (signed)
+//	DELETE /v1/<id>/<name>    delete a record (signed)
+//	POST   /v1/<id>/mailbox   append a record to the mailbox, returns its name (signed)
+type Server struct {
+	config ServerConfig
+	now    func() time.Time
+
+	mu     sync.Mutex
+	points map[string]*point
+}
+
+type point struct {
+	records map[string]*record
+	nextSeq uint64
+
+	// Signatures of the recent writes, in the order they were received
+	seenSigs  map[string]time.Time
+	sigsOrder []string
+}
+
+type record struct {
+	data    []byte
+	expires time.Time
+}
+
+// NewServer returns a server enforcing the given limits
+func NewServer(config ServerConfig) *Server {
+	if config.MaxSignatures <= 0 {
+		config.MaxSignatures = DefaultServerConfig.MaxSignatures
+	}
+	if config.MaxPoints <= 0 {
+		config.MaxPoints = DefaultServerConfig.MaxPoints
+	}
+	return &Server{
+		config: config,
+		now:    time.Now,
+		points: map[string]*point{},
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/v1/"), "/", 2)
+	if !strings.HasPrefix(r.URL.Path, "/v1/") || len(parts) != 2 || checkName(parts[0]) != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	id, name := parts[0], parts[1]
+
+	if name == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.list(w, id)
+		return
+	}
+	if checkName(name) != nil {
+		http.Error(w, "invalid record name", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.get(w, id, name)
+	case http.MethodPut, http.MethodDelete, http.MethodPost:
+		if r.Method == http.MethodPost && name != "mailbox" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.write(w, r, id, name)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) list(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	names := []string{}
+	if p := s.points[id]; p != nil {
+		s.expire(id, p)
+		for name := range p.records {
+			names = append(names, name)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Strings(names)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(names)
+}
+
+func (s *Server) get(w http.ResponseWriter, id, name string) {
+	s.mu.Lock()
+	var data []byte
+	if p := s.points[id]; p != nil {
+		s.expire(id, p)
+		if rec := p.records[name]; rec != nil {
+			data = rec.data
+		}
+	}
+	s.mu.Unlock()
+
+	if data == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(data)
+}
+
+func (s *Server) write(w http.ResponseWriter, r *http.Request, id, name string) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, int64(s.config.MaxRecordSize)+1))
+	if err != nil || len(body) > s.config.MaxRecordSize {
+		http.Error(w, "record too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	now := s.now()
+	pub, sig, err := verifyRequest(r, body, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if KeyID(pub) != id {
+		http.Error(w, "wrong write key for this meeting point", http.StatusForbidden)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.points[id]
+	if p != nil {
+		s.expire(id, p)
+		p = s.points[id]
+	}
+	if p == nil {
+		if len(s.points) >= s.config.MaxPoints {
+			http.Error(w, "too many meeting points", http.StatusInsufficientStorage)
+			return
+		}
+		p = &point{records: map[string]*record{}, seenSigs: map[string]time.Time{}}
+		s.points[id] = p
+	}
+
+	// A signed request can only be used once within the clock skew window. Only holders of
+	// the write key can fill the cache of a meeting point, so the limit only affects them.
+	if _, ok := p.seenSigs[string(sig)]; ok {
+		http.Error(w, "replayed request", http.StatusUnauthorized)
+		return
+	}
+	if len(p.seenSigs) >= s.config.MaxSignatures {
+		http.Error(w, "too many requests", http.StatusServiceUnavailable)
+		return
+	}
+	p.seenSigs[string(sig)] = now
+	p.sigsOrder = append(p.sigsOrder, string(sig))
+
+	switch r.Method {
+	case http.MethodDelete:
+		if p.records[name] == nil {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		delete(p.records, name)
+
+	case http.MethodPut:
+		if strings.HasPrefix(name, MailboxPrefix) {
+			http.Error(w, "mailbox records are append-only", http.StatusForbidden)
+			return
+		}
+		if p.records[name] == nil && len(p.records) >= s.config.MaxRecords {
+			http.Error(w, "too many records", http.StatusInsufficientStorage)
+			return
+		}
+		p.records[name] = &record{data: body, expires: now.Add(s.config.TTL)}
+
+	case http.MethodPost:
+		if len(p.records) >= s.config.MaxRecords {
+			http.Error(w, "too many records", http.StatusInsufficientStorage)
+			return
+		}
+		name = fmt.Sprintf("%s%016d", MailboxPrefix, p.nextSeq)
+		p.nextSeq++
+		p.records[name] = &record{data: body, expires: now.Add(s.config.TTL)}
+		fmt.Fprint(w, name)
+	}
+}
+
+// Purge drops every expired record. Records are also expired when their meeting point is
+// accessed, so this only needs to run periodically to reclaim memory.
+func (s *Server) Purge() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, p := range s.points {
+		s.expire(id, p)
+	}
+}
+
+// Drop expired records and signatures, and the meeting point itself once it is empty. Meeting
+// points whose mailbox was used are kept so that the names of mailbox records are not reused,
+// and so are those with recent signatures, so that their writes cannot be replayed.
+func (s *Server) expire(id string, p *point) {
+	now := s.now()
+	for name, rec := range p.records {
+		if now.After(rec.expires) {
+			delete(p.records, name)
+		}
+	}
+	for len(p.sigsOrder) > 0 && now.Sub(p.seenSigs[p.sigsOrder[0]]) > 2*MaxClockSkew {
+		delete(p.seenSigs, p.sigsOrder[0])
+		p.sigsOrder = p.sigsOrder[1:]
+	}
+	if len(p.records) == 0 && p.nextSeq == 0 && len(p.seenSigs) == 0 {
+		delete(s.points, id)
+	}
+}
@@ -0,0 +1,238 @@
+package rendezvous
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer(config ServerConfig) (*Server, *httptest.Server) {
+	server := NewServer(config)
+	return server, httptest.NewServer(server)
+}
+
+func TestHTTP(t *testing.T) {
+	_, s := newTestServer(DefaultServerConfig)
+	defer s.Close()
+
+	r := NewHTTP(s.URL)
+	testRendezvous(t, r, r.Authorize(ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))))
+}
+
+func TestHTTPWriteKey(t *testing.T) {
+	_, s := newTestServer(DefaultServerConfig)
+	defer s.Close()
+	key := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, ed25519.SeedSize))
+	other := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{2}, ed25519.SeedSize))
+	id := KeyID(key.Public().(ed25519.PublicKey))
+
+	// Writes signed with another key are refused, even before the first write, so that nobody
+	// can claim the meeting point
+	signed := func(method string, key ed25519.PrivateKey, body []byte) int {
+		req, _ := http.NewRequest(method, s.URL+"/v1/"+id+"/a", bytes.NewReader(body))
+		signRequest(req, key, body)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := signed(http.MethodPut, other, []byte("squatted")); code != http.StatusForbidden {
+		t.Errorf("First write with the wrong key: got %d", code)
+	}
+
+	owner := NewHTTP(s.URL)
+	if err := owner.Put(id, "a", []byte("data")); err == nil {
+		t.Errorf("Unauthorized write succeeded")
+	}
+	if owner.Authorize(key) != id {
+		t.Fatal("Authorize returned another meeting point")
+	}
+	if err := owner.Put(id, "a", []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Anyone can read, but only the holder of the write key can write
+	reader := NewHTTP(s.URL)
+	if data, err := reader.Get(id, "a"); err != nil || !bytes.Equal(data, []byte("data")) {
+		t.Errorf("Could not read record: %v", err)
+	}
+	if code := signed(http.MethodPut, other, []byte("overwritten")); code != http.StatusForbidden {
+		t.Errorf("Write with the wrong key: got %d", code)
+	}
+	if code := signed(http.MethodDelete, other, nil); code != http.StatusForbidden {
+		t.Errorf("Delete with the wrong key: got %d", code)
+	}
+
+	// Unsigned requests are rejected
+	req, _ := http.NewRequest(http.MethodPut, s.URL+"/v1/"+id+"/a", strings.NewReader("unsigned"))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Unsigned write: got %s", resp.Status)
+	}
+}
+
+func TestHTTPReplay(t *testing.T) {
+	_, s := newTestServer(DefaultServerConfig)
+	defer s.Close()
+	key := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	id := KeyID(key.Public().(ed25519.PublicKey))
+
+	body := []byte("message")
+	req, _ := http.NewRequest(http.MethodPost, s.URL+"/v1/"+id+"/mailbox", bytes.NewReader(body))
+	signRequest(req, key, body)
+
+	for i, want := range []int{http.StatusOK, http.StatusUnauthorized} {
+		replay, _ := http.NewRequest(req.Method, req.URL.String(), bytes.NewReader(body))
+		replay.Header = req.Header
+		resp, err := http.DefaultClient.Do(replay)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("Request %d: got %s, want %d", i, resp.Status, want)
+		}
+	}
+}
+
+func TestHTTPMailbox(t *testing.T) {
+	_, s := newTestServer(DefaultServerConfig)
+	defer s.Close()
+
+	r := NewHTTP(s.URL)
+	id := r.Authorize(ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize)))
+
+	first, err := r.Append(id, []byte("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := r.Append(id, []byte("second"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first >= second {
+		t.Errorf("Mailbox records are not ordered: %s, %s", first, second)
+	}
+
+	if err := r.Put(id, first, []byte("rewritten")); err == nil {
+		t.Errorf("Mailbox record was overwritten")
+	}
+	if data, _ := r.Get(id, first); !bytes.Equal(data, []byte("first")) {
+		t.Errorf("Wrong mailbox record: %s", data)
+	}
+
+	// Records are deleted once read, which does not reuse their names
+	if err := r.Delete(id, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Delete(id, second); err != nil {
+		t.Fatal(err)
+	}
+	third, err := r.Append(id, []byte("third"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third <= second {
+		t.Errorf("Mailbox name was reused: %s", third)
+	}
+}
+
+func TestHTTPLimits(t *testing.T) {
+	server, s := newTestServer(ServerConfig{MaxRecordSize: 16, MaxRecords: 2, TTL: time.Hour})
+	defer s.Close()
+
+	r := NewHTTP(s.URL)
+	id := r.Authorize(ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize)))
+
+	if err := r.Put(id, "big", make([]byte, 17)); err == nil {
+		t.Errorf("Oversized record was accepted")
+	}
+	if err := r.Put(id, "a", make([]byte, 16)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Put(id, "b", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Put(id, "c", nil); err == nil {
+		t.Errorf("Too many records were accepted")
+	}
+	if err := r.Put(id, "a", nil); err != nil {
+		t.Errorf("Could not replace a record at the limit: %v", err)
+	}
+
+	// Records expire after the TTL
+	server.mu.Lock()
+	server.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	server.mu.Unlock()
+	server.Purge()
+	if names, err := r.List(id); err != nil || len(names) != 0 {
+		t.Errorf("Records did not expire: %v, %v", names, err)
+	}
+}
+
+func TestHTTPSignatureLimit(t *testing.T) {
+	server, s := newTestServer(ServerConfig{MaxRecordSize: 16, MaxRecords: 16, TTL: time.Hour, MaxSignatures: 2})
+	defer s.Close()
+
+	r := NewHTTP(s.URL)
+	id := r.Authorize(ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize)))
+	for i, name := range []string{"a", "b"} {
+		if err := r.Put(id, name, nil); err != nil {
+			t.Fatalf("Write %d: %v", i, err)
+		}
+	}
+	// Signatures are remembered for twice the clock skew, so the third write is refused
+	if err := r.Put(id, "c", nil); err == nil {
+		t.Errorf("Write accepted past the signature limit")
+	}
+
+	// The limit only applies to the meeting point whose writes were signed
+	other := r.Authorize(ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, ed25519.SeedSize)))
+	if err := r.Put(other, "a", nil); err != nil {
+		t.Errorf("Write to another meeting point refused: %v", err)
+	}
+
+	// Signatures are forgotten once their timestamp is out of the window
+	server.mu.Lock()
+	server.now = func() time.Time { return time.Now().Add(2*MaxClockSkew + time.Second) }
+	server.mu.Unlock()
+	server.Purge()
+	server.mu.Lock()
+	remembered := len(server.points[id].seenSigs)
+	server.mu.Unlock()
+	if remembered != 0 {
+		t.Errorf("%d signatures were not expired", remembered)
+	}
+}
+
+func TestHTTPPointLimit(t *testing.T) {
+	_, s := newTestServer(ServerConfig{MaxRecordSize: 16, MaxRecords: 16, TTL: time.Hour, MaxPoints: 2})
+	defer s.Close()
+
+	r := NewHTTP(s.URL)
+	var ids []string
+	for i := byte(0); i < 3; i++ {
+		ids = append(ids, r.Authorize(ed25519.NewKeyFromSeed(bytes.Repeat([]byte{i}, ed25519.SeedSize))))
+	}
+	for _, id := range ids[:2] {
+		if err := r.Put(id, "a", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Put(ids[2], "a", nil); err == nil {
+		t.Errorf("Meeting point created past the limit")
+	}
+	if err := r.Put(ids[0], "b", nil); err != nil {
+		t.Errorf("Could not write to an existing meeting point at the limit: %v", err)
+	}
+}
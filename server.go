@@ -1,7 +1,10 @@
 package main
 
 import (
+	"strconv"
+
 	"github.com/nmohnblatt/cd_client/blindtbls"
+	"github.com/nmohnblatt/cd_client/identifier"
 	"github.com/nmohnblatt/cd_client/moretbls"
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/pairing"
@@ -12,7 +15,7 @@ import (
 )
 
 type server interface {
-	sign(string) (kyber.Point, kyber.Point)
+	sign(identifier.Identifier) (kyber.Point, kyber.Point)
 }
 
 // Local server for testing purposes
@@ -28,11 +31,11 @@ type multiServer struct {
 }
 
 func newDummyServer(id int) *dummyServer {
-	return &dummyServer{id, suite.GT().Scalar().Pick(blake2xb.New([]byte("this is a seed" + string(id))))}
+	return &dummyServer{id, suite.GT().Scalar().Pick(blake2xb.New([]byte("this is a seed" + strconv.Itoa(id))))}
 }
 
-func (s dummyServer) sign(phoneNumber string) (kyber.Point, kyber.Point) {
-	pk1, pk2 := derivePublicKeys(phoneNumber)
+func (s dummyServer) sign(id identifier.Identifier) (kyber.Point, kyber.Point) {
+	pk1, pk2 := derivePublicKeys(id)
 	return suite.G1().Point().Mul(s.sk, pk1), suite.G2().Point().Mul(s.sk, pk2)
 }
 
@@ -65,8 +68,8 @@ func newMultiServer(id int, key1, key2 *share.PriShare) *multiServer {
 	}
 }
 
-func (s multiServer) sign(phoneNumber string) ([]byte, []byte) {
-	toSign := []byte(phoneNumber)
+func (s multiServer) sign(id identifier.Identifier) ([]byte, []byte) {
+	toSign := id.Bytes()
 	buf1, _ := tbls.Sign(suite, s.sk1, toSign)
 	buf2, _ := moretbls.Sign2(suite, s.sk2, toSign)
 
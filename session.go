@@ -0,0 +1,196 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+
+	"github.com/nmohnblatt/cd_client/envelope"
+	"github.com/nmohnblatt/cd_client/keyschedule"
+	"github.com/nmohnblatt/cd_client/ratchet"
+	"github.com/nmohnblatt/cd_client/rendezvous"
+	"github.com/nmohnblatt/cd_client/x3dh"
+)
+
+// Kinds of records written at a meeting point to bootstrap an end-to-end encrypted session
+const (
+	recordPreKeys   = "prekeys"
+	recordHandshake = "x3dh"
+)
+
+// Return our X3DH identity and signed prekey, picking them on first use
+func (u *user) sessionKeys() (*x3dh.Identity, *x3dh.KeyPair, error) {
+	if u.identity == nil {
+		id, err := x3dh.NewIdentity(rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		spk, err := x3dh.GenerateKeyPair(rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		u.identity, u.signedPreKey = id, spk
+		if err := u.save(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return u.identity, u.signedPreKey, nil
+}
+
+// Publish our prekey bundle at the meeting point so that the contact can start a session with
+// us. The bundle carries a one-time prekey reserved for this contact and is signed under our
+// phone number.
+func publishPreKeys(store rendezvous.Rendezvous, u *user, c *contact) error {
+	if c.status != contactConfirmed {
+		return errors.New("session: contact is not confirmed")
+	}
+	id, spk, err := u.sessionKeys()
+	if err != nil {
+		return err
+	}
+	if c.oneTimePreKey == nil {
+		kp, err := x3dh.GenerateKeyPair(rand.Reader)
+		if err != nil {
+			return err
+		}
+		var n [4]byte
+		if _, err := rand.Read(n[:]); err != nil {
+			return err
+		}
+		c.oneTimePreKey = &x3dh.PreKey{ID: binary.BigEndian.Uint32(n[:]), KeyPair: kp}
+		// Keep the private key, needed to accept the session in a later run
+		if err := u.saveSession(c); err != nil {
+			return err
+		}
+	}
+
+	bundle, err := x3dh.NewBundle(id, spk, c.oneTimePreKey).MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err := putSigned(store, u, c, recordPreKeys, envelope.PreKeyBundle, bundle); err != nil {
+		return err
+	}
+	return syncMeetingPoint(store, c)
+}
+
+// Start a session with a contact from the prekey bundle they published. Returns false if the
+// contact has not published a bundle yet.
+func startSession(store rendezvous.Rendezvous, u *user, c *contact) (bool, error) {
+	if c.status != contactConfirmed {
+		return false, errors.New("session: contact is not confirmed")
+	}
+	id, _, err := u.sessionKeys()
+	if err != nil {
+		return false, err
+	}
+	if err := syncMeetingPoint(store, c); err != nil {
+		return false, err
+	}
+	data, err := getSigned(store, u, c, recordPreKeys, envelope.PreKeyBundle)
+	if err == rendezvous.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var bundle x3dh.Bundle
+	if err := bundle.UnmarshalBinary(data); err != nil {
+		return false, err
+	}
+
+	s, m, err := x3dh.Initiate(rand.Reader, id, &bundle, c.schedule.SessionKey())
+	if err != nil {
+		return false, err
+	}
+	r, err := ratchet.NewInitiator(s.RootKey, s.AssociatedData, bundle.SignedPreKey)
+	if err != nil {
+		return false, err
+	}
+	msg, err := m.MarshalBinary()
+	if err != nil {
+		return false, err
+	}
+	if err := putSigned(store, u, c, recordHandshake, envelope.Handshake, msg); err != nil {
+		return false, err
+	}
+	c.session = r
+	if err := u.saveSession(c); err != nil {
+		return false, err
+	}
+
+	return true, syncMeetingPoint(store, c)
+}
+
+// Complete a session that the contact started against our prekey bundle. Returns false if the
+// contact has not started one yet. The one-time prekey is discarded once used.
+func acceptSession(store rendezvous.Rendezvous, u *user, c *contact) (bool, error) {
+	if c.status != contactConfirmed {
+		return false, errors.New("session: contact is not confirmed")
+	}
+	id, spk, err := u.sessionKeys()
+	if err != nil {
+		return false, err
+	}
+	if err := syncMeetingPoint(store, c); err != nil {
+		return false, err
+	}
+	data, err := getSigned(store, u, c, recordHandshake, envelope.Handshake)
+	if err == rendezvous.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var m x3dh.InitialMessage
+	if err := m.UnmarshalBinary(data); err != nil {
+		return false, err
+	}
+
+	s, err := x3dh.Respond(id, spk, c.oneTimePreKey, &m, c.schedule.SessionKey())
+	if err != nil {
+		return false, err
+	}
+	r, err := ratchet.NewResponder(s.RootKey, s.AssociatedData, spk.Private, spk.Public)
+	if err != nil {
+		return false, err
+	}
+	c.session = r
+	if m.UsedOneTimePreKey {
+		c.oneTimePreKey = nil
+	}
+	if err := u.saveSession(c); err != nil {
+		return false, err
+	}
+	if m.UsedOneTimePreKey {
+		err := store.Delete(meetingPointID(store, c), recordName(c, recordPreKeys, c.local.id.String()))
+		if err != nil && err != rendezvous.ErrNotFound {
+			return true, err
+		}
+	}
+
+	return true, syncMeetingPoint(store, c)
+}
+
+// Make progress on the session with a contact. The responder given by the key schedule
+// publishes prekeys and waits for the handshake, while the initiator starts the session from
+// them, so both sides can call this without coordinating. Returns whether the session is
+// established.
+func establishSession(store rendezvous.Rendezvous, u *user, c *contact) (bool, error) {
+	if c.session != nil {
+		return true, nil
+	}
+	switch c.schedule.Role() {
+	case keyschedule.Initiator:
+		return startSession(store, u, c)
+	case keyschedule.Responder:
+		if c.oneTimePreKey == nil {
+			if err := publishPreKeys(store, u, c); err != nil {
+				return false, err
+			}
+		}
+		return acceptSession(store, u, c)
+	default:
+		return false, errors.New("session: no role with the contact")
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nmohnblatt/cd_client/keyschedule"
+	"github.com/nmohnblatt/cd_client/rendezvous"
+	"go.dedis.ch/kyber/v3/util/random"
+)
+
+func TestSession(t *testing.T) {
+	store := rendezvous.NewMemory()
+	testSession(t, store, store)
+}
+
+func TestSessionHTTP(t *testing.T) {
+	s := httptest.NewServer(rendezvous.NewServer(rendezvous.DefaultServerConfig))
+	defer s.Close()
+
+	testSession(t, rendezvous.NewHTTP(s.URL), rendezvous.NewHTTP(s.URL))
+}
+
+// Alice and Bob obtain their keys from threshold servers, so that they can sign their posts
+func newSessionUsers(t *testing.T) (*user, *user) {
+	n := 10
+	thr := n/2 + 1
+
+	secret := suite.GT().Scalar().Pick(random.New())
+	serverList, pubPoly1, pubPoly2 := setupThresholdServers(suite, secret, n, thr)
+
+	alice := testUser(t, "Alice", "07111111111")
+	bob := testUser(t, "Bob", "07222222222")
+	for _, u := range []*user{alice, bob} {
+		if err := u.obtainPrivateKeysBlindThreshold(suite, serverList[:thr], pubPoly1, pubPoly2, thr, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return alice, bob
+}
+
+func testSession(t *testing.T, aliceStore, bobStore rendezvous.Rendezvous) {
+	alice, bob := newSessionUsers(t)
+	users := []*user{alice, bob}
+
+	if err := publishPreKeys(bobStore, bob, newContact(bob, alice.id)); err == nil {
+		t.Errorf("Published prekeys for a pending contact")
+	}
+
+	contacts := confirmAll(t, users, [][2]int{{0, 1}})
+	aliceView, bobView := contacts[alice][0], contacts[bob][0]
+
+	if started, err := startSession(aliceStore, alice, aliceView); started || err != nil {
+		t.Fatalf("Started a session without a prekey bundle: %v", err)
+	}
+	if err := publishPreKeys(bobStore, bob, bobView); err != nil {
+		t.Fatal(err)
+	}
+	if accepted, err := acceptSession(bobStore, bob, bobView); accepted || err != nil {
+		t.Fatalf("Accepted a session that was not started: %v", err)
+	}
+
+	if started, err := startSession(aliceStore, alice, aliceView); !started || err != nil {
+		t.Fatalf("Could not start the session: %v", err)
+	}
+	if accepted, err := acceptSession(bobStore, bob, bobView); !accepted || err != nil {
+		t.Fatalf("Could not accept the session: %v", err)
+	}
+	if bobView.oneTimePreKey != nil {
+		t.Errorf("One-time prekey was not discarded")
+	}
+
+	// Mailbox messages now go through the double ratchet
+	for _, exchange := range []struct {
+		from, to           *user
+		fromView, toView   *contact
+		fromStore, toStore rendezvous.Rendezvous
+		body               string
+	}{
+		{alice, bob, aliceView, bobView, aliceStore, bobStore, "hello"},
+		{bob, alice, bobView, aliceView, bobStore, aliceStore, "hi Alice"},
+		{alice, bob, aliceView, bobView, aliceStore, bobStore, "how are you?"},
+	} {
+		if err := sendMessage(exchange.fromStore, exchange.from, exchange.fromView, []byte(exchange.body)); err != nil {
+			t.Fatal(err)
+		}
+		messages, err := readMessages(exchange.toStore, exchange.to, exchange.toView)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(messages) != 1 || string(messages[0].Body) != exchange.body {
+			t.Errorf("Wrong messages: %v", messages)
+		}
+	}
+}
+
+func TestSessionMessageBeforeAccept(t *testing.T) {
+	alice, bob := newSessionUsers(t)
+	users := []*user{alice, bob}
+	contacts := confirmAll(t, users, [][2]int{{0, 1}})
+	aliceView, bobView := contacts[alice][0], contacts[bob][0]
+	store := rendezvous.NewMemory()
+
+	if err := publishPreKeys(store, bob, bobView); err != nil {
+		t.Fatal(err)
+	}
+	if started, err := startSession(store, alice, aliceView); !started || err != nil {
+		t.Fatalf("Could not start the session: %v", err)
+	}
+	if err := sendMessage(store, alice, aliceView, []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Bob completes the handshake when he reads the first session message
+	messages, err := readMessages(store, bob, bobView)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || string(messages[0].Body) != "first" || bobView.session == nil {
+		t.Errorf("Wrong messages: %v", messages)
+	}
+}
+
+func TestSessionMessageBeforeHandshake(t *testing.T) {
+	alice, bob := newSessionUsers(t)
+	users := []*user{alice, bob}
+	contacts := confirmAll(t, users, [][2]int{{0, 1}})
+	aliceView, bobView := contacts[alice][0], contacts[bob][0]
+	store := rendezvous.NewMemory()
+
+	if err := publishPreKeys(store, bob, bobView); err != nil {
+		t.Fatal(err)
+	}
+	if started, err := startSession(store, alice, aliceView); !started || err != nil {
+		t.Fatalf("Could not start the session: %v", err)
+	}
+	if err := sendMessage(store, alice, aliceView, []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The message reaches Bob before the handshake, so he cannot decrypt it yet
+	id, name := meetingPointID(store, aliceView), recordName(aliceView, recordHandshake, alice.id.String())
+	handshake, err := store.Get(id, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(id, name); err != nil {
+		t.Fatal(err)
+	}
+	if messages, err := readMessages(store, bob, bobView); err != nil || len(messages) != 0 {
+		t.Fatalf("Wrong messages before the handshake: %v, %v", messages, err)
+	}
+
+	// It is kept until the handshake arrives
+	if err := store.Put(id, name, handshake); err != nil {
+		t.Fatal(err)
+	}
+	messages, err := readMessages(store, bob, bobView)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || string(messages[0].Body) != "first" {
+		t.Errorf("Wrong messages after the handshake: %v", messages)
+	}
+}
+
+func TestEstablishSession(t *testing.T) {
+	alice, bob := newSessionUsers(t)
+	users := []*user{alice, bob}
+	contacts := confirmAll(t, users, [][2]int{{0, 1}})
+	aliceView, bobView := contacts[alice][0], contacts[bob][0]
+	store := rendezvous.NewMemory()
+
+	if aliceView.schedule.Role() == bobView.schedule.Role() {
+		t.Fatalf("Both contacts are %s", aliceView.schedule.Role())
+	}
+
+	// Both sides poll until the session is up, in whatever order
+	for i := 0; i < 3; i++ {
+		for _, u := range users {
+			if _, err := establishSession(store, u, contacts[u][0]); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if aliceView.session == nil || bobView.session == nil {
+		t.Fatalf("Session was not established")
+	}
+
+	// The initiator speaks first
+	from, to := alice, bob
+	if bobView.schedule.Role() == keyschedule.Initiator {
+		from, to = bob, alice
+	}
+	if err := sendMessage(store, from, contacts[from][0], []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if messages, err := readMessages(store, to, contacts[to][0]); err != nil || len(messages) != 1 {
+		t.Errorf("Wrong messages: %v, %v", messages, err)
+	}
+}
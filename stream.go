@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/nmohnblatt/cd_client/channel"
+	"github.com/nmohnblatt/cd_client/keyschedule"
+	"github.com/nmohnblatt/cd_client/mailbox"
+	"github.com/nmohnblatt/cd_client/noise"
+	"github.com/nmohnblatt/cd_client/rendezvous"
+)
+
+// Stream messages go through a mailbox of their own at the meeting point
+const streamMailboxSuffix = "/stream"
+
+// Noise messages are kept well below the record size limit of rendezvous servers
+const streamMessageSize = 32 * 1024
+
+// How often the mailbox is polled for stream messages
+var streamPollInterval = time.Second
+
+// Run a Noise handshake with a contact over t. The PSK comes from the contact's key schedule
+// and the meeting point is the prologue. XXpsk3 also exchanges our X3DH identity keys. The
+// schedule tells which of the two contacts initiates the handshake.
+func openStream(t noise.Transport, u *user, c *contact, pattern noise.Pattern) (*noise.Conn, error) {
+	if c.status != contactConfirmed {
+		return nil, errors.New("stream: contact is not confirmed")
+	}
+	role := c.schedule.Role()
+	if role == keyschedule.RoleUnknown {
+		return nil, errors.New("stream: no role with the contact")
+	}
+	cfg := noise.Config{
+		Pattern:        pattern,
+		Initiator:      role == keyschedule.Initiator,
+		PSK:            c.schedule.NoiseKey(),
+		Prologue:       c.meetingPoint,
+		MaxMessageSize: streamMessageSize,
+	}
+	if pattern == noise.XXpsk3 {
+		id, _, err := u.sessionKeys()
+		if err != nil {
+			return nil, err
+		}
+		cfg.Static = &noise.KeyPair{Private: id.DH.Private, Public: id.DH.Public}
+	}
+	return noise.Handshake(t, cfg)
+}
+
+// Carries stream messages through the mailbox at the meeting point, polling for new ones
+type mailboxTransport struct {
+	ctx   context.Context
+	store rendezvous.Rendezvous
+	c     *contact
+
+	mu      sync.Mutex
+	m       *mailbox.Mailbox
+	pending [][]byte
+}
+
+// Return a transport through the stream mailbox with a contact. Receive gives up when ctx is
+// cancelled.
+func newMailboxTransport(ctx context.Context, store rendezvous.Rendezvous, u *user, c *contact) (*mailboxTransport, error) {
+	m, err := openContactMailbox(store, u, c, streamMailboxSuffix, c.streamMailbox)
+	if err != nil {
+		return nil, err
+	}
+	return &mailboxTransport{ctx: ctx, store: store, c: c, m: m}, nil
+}
+
+func (t *mailboxTransport) Send(msg []byte) error {
+	t.mu.Lock()
+	_, err := t.m.Post(msg)
+	t.c.streamMailbox = t.m.State()
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return syncMeetingPoint(t.store, t.c)
+}
+
+func (t *mailboxTransport) Receive() ([]byte, error) {
+	for {
+		if err := t.poll(); err != nil {
+			return nil, err
+		}
+		if len(t.pending) > 0 {
+			msg := t.pending[0]
+			t.pending = t.pending[1:]
+			return msg, nil
+		}
+		select {
+		case <-t.ctx.Done():
+			return nil, t.ctx.Err()
+		case <-time.After(streamPollInterval):
+		}
+	}
+}
+
+// Move new messages from the mailbox to the pending queue
+func (t *mailboxTransport) poll() error {
+	if len(t.pending) > 0 {
+		return nil
+	}
+	if err := syncMeetingPoint(t.store, t.c); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	messages, err := t.m.List()
+	if err != nil {
+		return err
+	}
+	// Noise messages must be read in order, so those after a gap wait for it to fill
+	if messages = inOrder(messages, t.m.State().NextReceive); len(messages) == 0 {
+		return nil
+	}
+	if err := t.m.Ack(messages[len(messages)-1].Seq); err != nil {
+		return err
+	}
+	t.c.streamMailbox = t.m.State()
+	for _, msg := range messages {
+		t.pending = append(t.pending, msg.Body)
+	}
+	return nil
+}
+
+// Carries stream messages over the live channel. Pubsub is best effort, and a lost message
+// breaks the stream.
+type channelTransport struct {
+	ch     *channel.Channel
+	frames <-chan channel.Frame
+}
+
+// Return a transport over the live channel with a contact. Receive gives up when ctx is
+// cancelled.
+func newChannelTransport(ctx context.Context, ch *channel.Channel) (*channelTransport, error) {
+	frames, err := ch.Receive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &channelTransport{ch: ch, frames: frames}, nil
+}
+
+func (t *channelTransport) Send(msg []byte) error {
+	return t.ch.Send(channel.Stream, msg)
+}
+
+func (t *channelTransport) Receive() ([]byte, error) {
+	for f := range t.frames {
+		if f.Type == channel.Stream {
+			return f.Payload, nil
+		}
+	}
+	return nil, errors.New("stream: channel closed")
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/nmohnblatt/cd_client/channel"
+	"github.com/nmohnblatt/cd_client/mailbox"
+	"github.com/nmohnblatt/cd_client/noise"
+	"github.com/nmohnblatt/cd_client/rendezvous"
+)
+
+func init() {
+	streamPollInterval = 10 * time.Millisecond
+}
+
+// Run the handshake on both sides and check that bytes flow in both directions
+func testStream(t *testing.T, pattern noise.Pattern, alice, bob *user, aliceView, bobView *contact, aliceT, bobT noise.Transport) {
+	done := make(chan error)
+	var bobConn *noise.Conn
+	go func() {
+		var err error
+		bobConn, err = openStream(bobT, bob, bobView, pattern)
+		done <- err
+	}()
+	aliceConn, err := openStream(aliceT, alice, aliceView, pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range [][2]*noise.Conn{{aliceConn, bobConn}, {bobConn, aliceConn}, {aliceConn, bobConn}} {
+		msg := []byte(pattern.String() + " stream data")
+		if _, err := dir[0].Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, len(msg))
+		if _, err := io.ReadFull(dir[1], got); err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(msg) {
+			t.Errorf("Got %q, expected %q", got, msg)
+		}
+	}
+}
+
+func TestStreamMailbox(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	alice := testUser(t, "Alice", "07111111111")
+	bob := testUser(t, "Bob", "07222222222")
+	users := []*user{alice, bob}
+	issueKeys(t, users...)
+	contacts := confirmAll(t, users, [][2]int{{0, 1}})
+	aliceView, bobView := contacts[alice][0], contacts[bob][0]
+	store := rendezvous.NewMemory()
+
+	for _, pattern := range []noise.Pattern{noise.NNpsk0, noise.XXpsk3} {
+		aliceT, err := newMailboxTransport(ctx, store, alice, aliceView)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bobT, err := newMailboxTransport(ctx, store, bob, bobView)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testStream(t, pattern, alice, bob, aliceView, bobView, aliceT, bobT)
+	}
+
+	// Stream messages do not show up as mailbox messages
+	if messages, err := readMessages(store, bob, bobView); err != nil || len(messages) != 0 {
+		t.Errorf("Stream leaked into the mailbox: %v, %v", messages, err)
+	}
+}
+
+func TestStreamMailboxOutOfOrder(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	alice := testUser(t, "Alice", "07111111111")
+	bob := testUser(t, "Bob", "07222222222")
+	users := []*user{alice, bob}
+	issueKeys(t, users...)
+	contacts := confirmAll(t, users, [][2]int{{0, 1}})
+	aliceView, bobView := contacts[alice][0], contacts[bob][0]
+	store := rendezvous.NewMemory()
+
+	// Alice's stream messages reach the meeting point out of order, the second one last
+	post := func(seq uint64, msg string) {
+		m, err := openContactMailbox(store, alice, aliceView, streamMailboxSuffix, mailbox.State{NextSend: seq})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.Post([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	post(0, "first")
+	post(2, "third")
+
+	bobT, err := newMailboxTransport(ctx, store, bob, bobView)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := bobT.Receive(); err != nil || string(msg) != "first" {
+		t.Fatalf("Got %q, %v", msg, err)
+	}
+	if err := bobT.poll(); err != nil || len(bobT.pending) != 0 {
+		t.Fatalf("Received messages past the gap: %q, %v", bobT.pending, err)
+	}
+
+	post(1, "second")
+	for _, want := range []string{"second", "third"} {
+		if msg, err := bobT.Receive(); err != nil || string(msg) != want {
+			t.Errorf("Got %q, %v, expected %q", msg, err, want)
+		}
+	}
+}
+
+func TestStreamChannel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	alice := testUser(t, "Alice", "07111111111")
+	bob := testUser(t, "Bob", "07222222222")
+	users := []*user{alice, bob}
+	issueKeys(t, users...)
+	contacts := confirmAll(t, users, [][2]int{{0, 1}})
+	aliceView, bobView := contacts[alice][0], contacts[bob][0]
+	broker := channel.NewBroker()
+
+	aliceChannel, err := openLiveChannel(broker, aliceView)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobChannel, err := openLiveChannel(broker, bobView)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliceT, err := newChannelTransport(ctx, aliceChannel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobT, err := newChannelTransport(ctx, bobChannel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStream(t, noise.XXpsk3, alice, bob, aliceView, bobView, aliceT, bobT)
+}
+
+func TestStreamPending(t *testing.T) {
+	alice := testUser(t, "Alice", "07111111111")
+	bob := testUser(t, "Bob", "07222222222")
+	issueKeys(t, alice, bob)
+
+	if _, err := openStream(nil, alice, newContact(alice, bob.id), noise.NNpsk0); err == nil {
+		t.Errorf("Opened a stream with a pending contact")
+	}
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
 	"errors"
 
 	"github.com/nmohnblatt/cd_client/blindbls"
 	"github.com/nmohnblatt/cd_client/blindtbls"
+	"github.com/nmohnblatt/cd_client/identifier"
+	"github.com/nmohnblatt/cd_client/keystore"
 	"github.com/nmohnblatt/cd_client/moretbls"
+	"github.com/nmohnblatt/cd_client/x3dh"
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/pairing"
 	"go.dedis.ch/kyber/v3/share"
@@ -14,23 +19,88 @@ import (
 	"go.dedis.ch/kyber/v3/xof/blake2xb"
 )
 
-type user struct {
-	name               string
-	phoneNumber        string
+// An identifier the user registered with and the keys issued for it
+type registration struct {
+	id                 identifier.Identifier
 	pk1, pk2, sk1, sk2 kyber.Point
 }
 
-// Creates a new user with the name and phone number specified.
-// Automatically derive public keys. (Private keys need to be provided by server)
-func newUser(Name, Number string) *user {
+type user struct {
+	name string
+	// The identifiers the user registered with, each with its own keys. The first one is the
+	// primary identifier, embedded here, which the user acts as towards groups, mutual
+	// discovery and contacts not tied to another identifier.
+	*registration
+	registrations []*registration
+	// Phone numbers of contacts written without a country calling code are read in region, the
+	// region of the user's primary number if they registered with one.
+	region string
+	// Group public keys of the servers that issued sk1 (point on G2) and sk2 (point on G1)
+	groupKey1, groupKey2 kyber.Point
+	// Epoch of the private keys. Servers rotate their master keys at every epoch, so contacts
+	// must derive their shared keys in the same epoch to meet. Keys issued by dummy servers,
+	// which have no group public key, are in epoch 0.
+	epoch uint32
+	// X3DH identity and signed prekey, published at meeting points to start sessions
+	identity     *x3dh.Identity
+	signedPreKey *x3dh.KeyPair
+	// Hashes of contact identifiers and shared keys derived with them
+	cache *pairingCache
+	// Sessions with contacts, restored from the keystore or saved since
+	sessions map[sessionID]keystore.Session
+	// Keystore the user is written back to, nil if they chose not to keep one
+	keystore *keystoreFile
+}
+
+// Creates a new user with the name and identifier (phone number, email address or username)
+// specified. Phone numbers without a country calling code are read in region. Automatically
+// derive public keys. (Private keys need to be provided by server)
+func newUser(Name, ID, region string) (*user, error) {
 	var u user
 
 	u.name = Name
-	u.phoneNumber = Number
+	id, err := identifier.Parse(ID, region)
+	if err != nil {
+		return nil, err
+	}
+	u.region = id.Region(region)
+	u.registration = newRegistration(id)
+	u.registrations = []*registration{u.registration}
+	u.cache = newPairingCache(defaultCacheSize)
 
-	u.pk1, u.pk2 = derivePublicKeys(u.phoneNumber)
+	return &u, nil
+}
 
-	return &u
+func newRegistration(id identifier.Identifier) *registration {
+	r := registration{id: id}
+	r.pk1, r.pk2 = derivePublicKeys(id)
+	return &r
+}
+
+// Register another identifier of the user, read like the primary one. Its keys are issued the
+// next time the user obtains private keys.
+func (u *user) addIdentifier(ID string) error {
+	id, err := identifier.Parse(ID, u.region)
+	if err != nil {
+		return err
+	}
+	for _, r := range u.registrations {
+		if r.id == id {
+			return errors.New("user: " + id.String() + " is already registered")
+		}
+	}
+	u.registrations = append(u.registrations, newRegistration(id))
+	return nil
+}
+
+// Find the registration of one of the user's identifiers
+func (u *user) registrationOf(id identifier.Identifier) *registration {
+	for _, r := range u.registrations {
+		if r.id == id {
+			return r
+		}
+	}
+	return nil
 }
 
 /*
@@ -63,41 +133,79 @@ func dummyRequestKeys(u *user, serverID string) (kyber.Point, kyber.Point) {
 	return sk1, sk2
 }
 
+// Obtain the private keys of every identifier of the user
 func (u *user) obtainPrivateKeys(servers ...server) {
+	for _, r := range u.registrations {
+		r.obtainPrivateKeys(servers...)
+	}
+	u.cache.invalidateSecrets()
+}
+
+func (r *registration) obtainPrivateKeys(servers ...server) {
 	buf1 := suite.G1().Point()
 	buf2 := suite.G2().Point()
 	for _, s := range servers {
-		partial1, partial2 := s.sign(u.phoneNumber)
+		partial1, partial2 := s.sign(r.id)
 		buf1.Add(buf1, partial1)
 		buf2.Add(buf2, partial2)
 	}
 
-	u.sk1 = buf1
-	u.sk2 = buf2
+	r.sk1 = buf1
+	r.sk2 = buf2
 }
 
+// Obtain the private keys of every identifier of the user from t-out-of-n servers
 func (u *user) obtainPrivateKeysThreshold(suite pairing.Suite, servers []*multiServer, pubPoly1, pubPoly2 *share.PubPoly, t, n int) error {
 	if len(servers) < t {
 		return errors.New("Not enough servers to meet thre threshold")
 	}
+	for _, r := range u.registrations {
+		if err := r.obtainPrivateKeysThreshold(suite, servers, pubPoly1, pubPoly2, t, n); err != nil {
+			return err
+		}
+	}
+	u.cache.invalidateSecrets()
+	u.groupKey1, u.groupKey2 = pubPoly1.Commit(), pubPoly2.Commit()
+	u.epoch = keyEpoch(u.groupKey1, u.groupKey2)
+
+	return nil
+}
+
+// Tell whether the private keys of the user were issued under the given group public keys. Keys
+// loaded from a keystore must be fetched again once the servers rotated their master keys.
+func (u *user) issuedUnder(groupKey1, groupKey2 kyber.Point) bool {
+	return u.groupKey1 != nil && u.groupKey2 != nil && u.groupKey1.Equal(groupKey1) && u.groupKey2.Equal(groupKey2)
+}
+
+// Number the epoch of the master keys with the given group public keys. Servers do not number
+// their key rotations, so every group key pair is an epoch of its own, numbered after the keys
+// so that all users of the same servers agree on it.
+func keyEpoch(groupKey1, groupKey2 kyber.Point) uint32 {
+	h := sha256.New()
+	groupKey1.MarshalTo(h)
+	groupKey2.MarshalTo(h)
+	return binary.BigEndian.Uint32(h.Sum(nil))
+}
+
+func (r *registration) obtainPrivateKeysThreshold(suite pairing.Suite, servers []*multiServer, pubPoly1, pubPoly2 *share.PubPoly, t, n int) error {
 
 	buf1 := make([][]byte, len(servers))
 	buf2 := make([][]byte, len(servers))
 
 	for i, s := range servers {
-		buf1[i], buf2[i] = s.sign(u.phoneNumber)
+		buf1[i], buf2[i] = s.sign(r.id)
 	}
 
-	key1, _ := tbls.Recover(suite, pubPoly1, []byte(u.phoneNumber), buf1, t, n)
-	key2, _ := moretbls.Recover2(suite, pubPoly2, []byte(u.phoneNumber), buf2, t, n)
+	key1, _ := tbls.Recover(suite, pubPoly1, r.id.Bytes(), buf1, t, n)
+	key2, _ := moretbls.Recover2(suite, pubPoly2, r.id.Bytes(), buf2, t, n)
 
-	u.sk1 = suite.G1().Point()
-	err := u.sk1.UnmarshalBinary(key1)
+	r.sk1 = suite.G1().Point()
+	err := r.sk1.UnmarshalBinary(key1)
 	if err != nil {
 		return err
 	}
-	u.sk2 = suite.G2().Point()
-	err = u.sk2.UnmarshalBinary(key2)
+	r.sk2 = suite.G2().Point()
+	err = r.sk2.UnmarshalBinary(key2)
 	if err != nil {
 		return err
 	}
@@ -105,20 +213,35 @@ func (u *user) obtainPrivateKeysThreshold(suite pairing.Suite, servers []*multiS
 	return nil
 }
 
+// Obtain the private keys of every identifier of the user from t-out-of-n servers, blinding
+// the identifiers so that the servers do not learn them
 func (u *user) obtainPrivateKeysBlindThreshold(suite pairing.Suite, servers []*multiServer, pubPoly1, pubPoly2 *share.PubPoly, t, n int) error {
 	if len(servers) < t {
 		return errors.New("Not enough servers to meet the threshold")
 	}
+	for _, r := range u.registrations {
+		if err := r.obtainPrivateKeysBlindThreshold(suite, servers, pubPoly1, pubPoly2, t, n); err != nil {
+			return err
+		}
+	}
+	u.cache.invalidateSecrets()
+	u.groupKey1, u.groupKey2 = pubPoly1.Commit(), pubPoly2.Commit()
+	u.epoch = keyEpoch(u.groupKey1, u.groupKey2)
+
+	return nil
+}
+
+func (r *registration) obtainPrivateKeysBlindThreshold(suite pairing.Suite, servers []*multiServer, pubPoly1, pubPoly2 *share.PubPoly, t, n int) error {
 
 	// Choose blinding factor
 	BF := [2]kyber.Scalar{suite.G1().Scalar().Pick(random.New()), suite.G2().Scalar().Pick(random.New())}
 
 	// Blind
-	aH1M, err := blindtbls.Blind(suite.G1(), BF[0], u.pk1)
+	aH1M, err := blindtbls.Blind(suite.G1(), BF[0], r.pk1)
 	if err != nil {
 		return err
 	}
-	aH2M, err := blindtbls.Blind(suite.G2(), BF[1], u.pk2)
+	aH2M, err := blindtbls.Blind(suite.G2(), BF[1], r.pk2)
 	if err != nil {
 		return err
 	}
@@ -166,8 +289,8 @@ func (u *user) obtainPrivateKeysBlindThreshold(suite pairing.Suite, servers []*m
 	}
 
 	// Unblind
-	u.sk1, _ = blindbls.Unblind(suite.G1(), BF[0], blindKey1)
-	u.sk2, _ = blindbls.Unblind(suite.G2(), BF[1], blindKey2)
+	r.sk1, _ = blindbls.Unblind(suite.G1(), BF[0], blindKey1)
+	r.sk2, _ = blindbls.Unblind(suite.G2(), BF[1], blindKey2)
 
 	return nil
 }
@@ -0,0 +1,321 @@
+// Package x3dh implements the X3DH key agreement of the Signal protocol, bootstrapped from the
+// secret that two contacts discovered through the contact discovery service.
+//
+// The responder publishes a prekey bundle at the meeting point: its identity key, a signed
+// prekey and optionally a one-time prekey. The initiator runs four Diffie-Hellman exchanges
+// against the bundle and sends its identity and ephemeral keys back in an initial message:
+//
+//	DH1 = DH(IK_A, SPK_B)  DH2 = DH(EK_A, IK_B)  DH3 = DH(EK_A, SPK_B)  DH4 = DH(EK_A, OPK_B)
+//	SK  = HKDF(F || DH1 || DH2 || DH3 || DH4 || PSK)
+//
+// where PSK is a key derived from the contact-discovery secret. A man in the middle who
+// substitutes the identity keys therefore also needs to know the contact secret. The root key
+// output by the handshake is meant to seed a double ratchet.
+//
+// Identity keys are X25519 keys, with an Ed25519 key that signs the prekeys. Bundles are not
+// bound to an identifier: callers should sign them (e.g. with package ibs).
+package x3dh
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// KeySize is the size of public keys, private keys and of the root key
+const KeySize = 32
+
+const (
+	labelKDF       = "cd_client x3dh v1"
+	labelSignature = "cd_client x3dh prekey v1"
+
+	bundleSize  = 3*KeySize + ed25519.SignatureSize
+	oneTimeSize = 4 + KeySize
+	messageSize = 2*KeySize + 1 + 4 + sha256.Size
+)
+
+// KeyPair is an X25519 key pair
+type KeyPair struct {
+	Private [KeySize]byte
+	Public  [KeySize]byte
+}
+
+// GenerateKeyPair picks a fresh X25519 key pair
+func GenerateKeyPair(random io.Reader) (*KeyPair, error) {
+	var private [KeySize]byte
+	if _, err := io.ReadFull(random, private[:]); err != nil {
+		return nil, err
+	}
+	return NewKeyPair(private), nil
+}
+
+// NewKeyPair returns the X25519 key pair of a private key
+func NewKeyPair(private [KeySize]byte) *KeyPair {
+	kp := KeyPair{Private: private}
+	curve25519.ScalarBaseMult(&kp.Public, &kp.Private)
+	return &kp
+}
+
+// Identity is the long-term identity of a party
+type Identity struct {
+	DH      *KeyPair
+	Signing ed25519.PrivateKey
+}
+
+// NewIdentity picks a fresh identity
+func NewIdentity(random io.Reader) (*Identity, error) {
+	dh, err := GenerateKeyPair(random)
+	if err != nil {
+		return nil, err
+	}
+	_, signing, err := ed25519.GenerateKey(random)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{DH: dh, Signing: signing}, nil
+}
+
+// PreKey is a one-time prekey with its identifier
+type PreKey struct {
+	ID uint32
+	*KeyPair
+}
+
+// Bundle is the public key material that a responder publishes
+type Bundle struct {
+	IdentityKey  [KeySize]byte
+	SigningKey   ed25519.PublicKey
+	SignedPreKey [KeySize]byte
+	// Signature on the identity key and signed prekey under the signing key
+	Signature []byte
+	// Optional one-time prekey
+	OneTimePreKeyID uint32
+	OneTimePreKey   *[KeySize]byte
+}
+
+// NewBundle signs the signed prekey with the identity and returns the bundle to publish.
+// oneTime may be nil.
+func NewBundle(id *Identity, signedPreKey *KeyPair, oneTime *PreKey) *Bundle {
+	b := &Bundle{
+		IdentityKey:  id.DH.Public,
+		SigningKey:   id.Signing.Public().(ed25519.PublicKey),
+		SignedPreKey: signedPreKey.Public,
+	}
+	b.Signature = ed25519.Sign(id.Signing, b.signedContent())
+	if oneTime != nil {
+		pub := oneTime.Public
+		b.OneTimePreKeyID, b.OneTimePreKey = oneTime.ID, &pub
+	}
+	return b
+}
+
+// Verify checks the signature on the signed prekey
+func (b *Bundle) Verify() error {
+	if len(b.SigningKey) != ed25519.PublicKeySize || !ed25519.Verify(b.SigningKey, b.signedContent(), b.Signature) {
+		return errors.New("x3dh: invalid prekey signature")
+	}
+	return nil
+}
+
+func (b *Bundle) signedContent() []byte {
+	buf := make([]byte, 0, len(labelSignature)+2*KeySize)
+	buf = append(buf, labelSignature...)
+	buf = append(buf, b.IdentityKey[:]...)
+	return append(buf, b.SignedPreKey[:]...)
+}
+
+// MarshalBinary encodes the bundle as
+// identity key | signing key | signed prekey | signature [| one-time prekey ID | one-time prekey]
+func (b *Bundle) MarshalBinary() ([]byte, error) {
+	if len(b.SigningKey) != ed25519.PublicKeySize || len(b.Signature) != ed25519.SignatureSize {
+		return nil, errors.New("x3dh: malformed bundle")
+	}
+	buf := make([]byte, 0, bundleSize+oneTimeSize)
+	buf = append(buf, b.IdentityKey[:]...)
+	buf = append(buf, b.SigningKey...)
+	buf = append(buf, b.SignedPreKey[:]...)
+	buf = append(buf, b.Signature...)
+	if b.OneTimePreKey != nil {
+		var id [4]byte
+		binary.BigEndian.PutUint32(id[:], b.OneTimePreKeyID)
+		buf = append(buf, id[:]...)
+		buf = append(buf, b.OneTimePreKey[:]...)
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary decodes a bundle encoded by MarshalBinary
+func (b *Bundle) UnmarshalBinary(data []byte) error {
+	if len(data) != bundleSize && len(data) != bundleSize+oneTimeSize {
+		return errors.New("x3dh: malformed bundle")
+	}
+	*b = Bundle{}
+	copy(b.IdentityKey[:], data)
+	b.SigningKey = append(ed25519.PublicKey(nil), data[KeySize:2*KeySize]...)
+	copy(b.SignedPreKey[:], data[2*KeySize:])
+	b.Signature = append([]byte(nil), data[3*KeySize:bundleSize]...)
+	if len(data) > bundleSize {
+		b.OneTimePreKeyID = binary.BigEndian.Uint32(data[bundleSize:])
+		b.OneTimePreKey = new([KeySize]byte)
+		copy(b.OneTimePreKey[:], data[bundleSize+4:])
+	}
+	return nil
+}
+
+// InitialMessage is what the initiator sends to the responder to complete the handshake
+type InitialMessage struct {
+	IdentityKey  [KeySize]byte
+	EphemeralKey [KeySize]byte
+	// Whether the one-time prekey OneTimePreKeyID of the bundle was used
+	UsedOneTimePreKey bool
+	OneTimePreKeyID   uint32
+	// MAC of the handshake under a key derived alongside the root key, so that the responder
+	// can tell whether both sides agree before using the session
+	MAC []byte
+}
+
+// MarshalBinary encodes the message as
+// identity key | ephemeral key | one-time prekey flag | one-time prekey ID | MAC
+func (m *InitialMessage) MarshalBinary() ([]byte, error) {
+	if len(m.MAC) != sha256.Size {
+		return nil, errors.New("x3dh: malformed initial message")
+	}
+	buf := make([]byte, messageSize)
+	copy(buf, m.IdentityKey[:])
+	copy(buf[KeySize:], m.EphemeralKey[:])
+	if m.UsedOneTimePreKey {
+		buf[2*KeySize] = 1
+	}
+	binary.BigEndian.PutUint32(buf[2*KeySize+1:], m.OneTimePreKeyID)
+	copy(buf[2*KeySize+5:], m.MAC)
+
+	return buf, nil
+}
+
+// UnmarshalBinary decodes a message encoded by MarshalBinary
+func (m *InitialMessage) UnmarshalBinary(data []byte) error {
+	if len(data) != messageSize || data[2*KeySize] > 1 {
+		return errors.New("x3dh: malformed initial message")
+	}
+	copy(m.IdentityKey[:], data)
+	copy(m.EphemeralKey[:], data[KeySize:])
+	m.UsedOneTimePreKey = data[2*KeySize] == 1
+	m.OneTimePreKeyID = binary.BigEndian.Uint32(data[2*KeySize+1:])
+	m.MAC = append([]byte(nil), data[2*KeySize+5:]...)
+
+	return nil
+}
+
+// Session is the output of the handshake
+type Session struct {
+	// RootKey seeds the double ratchet
+	RootKey []byte
+	// AssociatedData binds both identity keys, initiator first. The ratchet must
+	// authenticate it with every message.
+	AssociatedData []byte
+}
+
+// Initiate runs the handshake against a verified bundle. psk is the key derived from the
+// contact-discovery secret. It returns the session and the message to send to the responder.
+func Initiate(random io.Reader, id *Identity, b *Bundle, psk []byte) (*Session, *InitialMessage, error) {
+	if err := b.Verify(); err != nil {
+		return nil, nil, err
+	}
+	ek, err := GenerateKeyPair(random)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dhs := [][KeySize]byte{
+		dh(&id.DH.Private, &b.SignedPreKey),
+		dh(&ek.Private, &b.IdentityKey),
+		dh(&ek.Private, &b.SignedPreKey),
+	}
+	m := &InitialMessage{IdentityKey: id.DH.Public, EphemeralKey: ek.Public}
+	if b.OneTimePreKey != nil {
+		dhs = append(dhs, dh(&ek.Private, b.OneTimePreKey))
+		m.UsedOneTimePreKey, m.OneTimePreKeyID = true, b.OneTimePreKeyID
+	}
+
+	s, macKey, err := derive(dhs, psk, id.DH.Public, b.IdentityKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	m.MAC = m.tag(macKey, s.AssociatedData)
+
+	return s, m, nil
+}
+
+// Respond completes the handshake from the initial message, using the private keys behind the
+// bundle that the initiator used. oneTime must be the one-time prekey named in the message, or
+// nil if none was used. The caller should then delete the one-time prekey.
+func Respond(id *Identity, signedPreKey *KeyPair, oneTime *PreKey, m *InitialMessage, psk []byte) (*Session, error) {
+	dhs := [][KeySize]byte{
+		dh(&signedPreKey.Private, &m.IdentityKey),
+		dh(&id.DH.Private, &m.EphemeralKey),
+		dh(&signedPreKey.Private, &m.EphemeralKey),
+	}
+	if m.UsedOneTimePreKey {
+		if oneTime == nil || oneTime.ID != m.OneTimePreKeyID {
+			return nil, errors.New("x3dh: unknown one-time prekey")
+		}
+		dhs = append(dhs, dh(&oneTime.Private, &m.EphemeralKey))
+	}
+
+	s, macKey, err := derive(dhs, psk, m.IdentityKey, id.DH.Public)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(m.MAC, m.tag(macKey, s.AssociatedData)) {
+		return nil, errors.New("x3dh: handshake failed")
+	}
+	return s, nil
+}
+
+func (m *InitialMessage) tag(key, ad []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(ad)
+	mac.Write(m.EphemeralKey[:])
+	var id [5]byte
+	if m.UsedOneTimePreKey {
+		id[0] = 1
+	}
+	binary.BigEndian.PutUint32(id[1:], m.OneTimePreKeyID)
+	mac.Write(id[:])
+
+	return mac.Sum(nil)
+}
+
+func dh(private, public *[KeySize]byte) [KeySize]byte {
+	var out [KeySize]byte
+	curve25519.ScalarMult(&out, private, public)
+	return out
+}
+
+func derive(dhs [][KeySize]byte, psk []byte, initiator, responder [KeySize]byte) (*Session, []byte, error) {
+	var zero [KeySize]byte
+	ikm := bytes.Repeat([]byte{0xff}, KeySize)
+	for _, v := range dhs {
+		// Low-order public keys give an all-zero output that anyone can compute
+		if v == zero {
+			return nil, nil, errors.New("x3dh: invalid public key")
+		}
+		ikm = append(ikm, v[:]...)
+	}
+	ikm = append(ikm, psk...)
+
+	out := make([]byte, 2*KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, make([]byte, sha256.Size), []byte(labelKDF)), out); err != nil {
+		return nil, nil, err
+	}
+
+	ad := append(append([]byte(nil), initiator[:]...), responder[:]...)
+	return &Session{RootKey: out[:KeySize], AssociatedData: ad}, out[KeySize:], nil
+}
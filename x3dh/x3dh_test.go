@@ -0,0 +1,145 @@
+package x3dh
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+var psk = bytes.Repeat([]byte{7}, 32)
+
+type responder struct {
+	id           *Identity
+	signedPreKey *KeyPair
+	oneTime      *PreKey
+}
+
+func newResponder(t *testing.T, withOneTime bool) *responder {
+	id, err := NewIdentity(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spk, _ := GenerateKeyPair(rand.Reader)
+	r := &responder{id: id, signedPreKey: spk}
+	if withOneTime {
+		kp, _ := GenerateKeyPair(rand.Reader)
+		r.oneTime = &PreKey{ID: 42, KeyPair: kp}
+	}
+	return r
+}
+
+func (r *responder) bundle() *Bundle {
+	return NewBundle(r.id, r.signedPreKey, r.oneTime)
+}
+
+func TestHandshake(t *testing.T) {
+	for _, withOneTime := range []bool{false, true} {
+		alice, _ := NewIdentity(rand.Reader)
+		bob := newResponder(t, withOneTime)
+
+		s1, m, err := Initiate(rand.Reader, alice, bob.bundle(), psk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.UsedOneTimePreKey != withOneTime {
+			t.Errorf("One-time prekey use: got %v, expected %v", m.UsedOneTimePreKey, withOneTime)
+		}
+		s2, err := Respond(bob.id, bob.signedPreKey, bob.oneTime, m, psk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(s1.RootKey, s2.RootKey) || len(s1.RootKey) != KeySize {
+			t.Errorf("Parties derived different root keys")
+		}
+		if !bytes.Equal(s1.AssociatedData, s2.AssociatedData) {
+			t.Errorf("Parties derived different associated data")
+		}
+	}
+}
+
+func TestWrongPSK(t *testing.T) {
+	alice, _ := NewIdentity(rand.Reader)
+	bob := newResponder(t, true)
+
+	_, m, err := Initiate(rand.Reader, alice, bob.bundle(), psk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Respond(bob.id, bob.signedPreKey, bob.oneTime, m, []byte("another contact secret")); err == nil {
+		t.Errorf("Handshake succeeded without the contact secret")
+	}
+}
+
+func TestTamperedMessages(t *testing.T) {
+	alice, _ := NewIdentity(rand.Reader)
+	mallory, _ := NewIdentity(rand.Reader)
+	bob := newResponder(t, true)
+
+	// The signed prekey must be signed by the identity in the bundle
+	b := bob.bundle()
+	other, _ := GenerateKeyPair(rand.Reader)
+	b.SignedPreKey = other.Public
+	if _, _, err := Initiate(rand.Reader, alice, b, psk); err == nil {
+		t.Errorf("Accepted a bundle with a forged signed prekey")
+	}
+
+	// Substituting the initiator's identity breaks the MAC
+	_, m, _ := Initiate(rand.Reader, alice, bob.bundle(), psk)
+	m.IdentityKey = mallory.DH.Public
+	if _, err := Respond(bob.id, bob.signedPreKey, bob.oneTime, m, psk); err == nil {
+		t.Errorf("Accepted a message with a substituted identity")
+	}
+
+	// The one-time prekey named in the message must be available
+	_, m, _ = Initiate(rand.Reader, alice, bob.bundle(), psk)
+	if _, err := Respond(bob.id, bob.signedPreKey, nil, m, psk); err == nil {
+		t.Errorf("Accepted a message for a deleted one-time prekey")
+	}
+
+	// Low-order ephemeral keys are rejected
+	_, m, _ = Initiate(rand.Reader, alice, bob.bundle(), psk)
+	m.EphemeralKey = [KeySize]byte{}
+	if _, err := Respond(bob.id, bob.signedPreKey, bob.oneTime, m, psk); err == nil {
+		t.Errorf("Accepted a low-order ephemeral key")
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	alice, _ := NewIdentity(rand.Reader)
+	for _, withOneTime := range []bool{false, true} {
+		bob := newResponder(t, withOneTime)
+
+		data, err := bob.bundle().MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b Bundle
+		if err := b.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Verify(); err != nil {
+			t.Errorf("Decoded bundle does not verify: %v", err)
+		}
+
+		_, m, err := Initiate(rand.Reader, alice, &b, psk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err = m.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded InitialMessage
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Respond(bob.id, bob.signedPreKey, bob.oneTime, &decoded, psk); err != nil {
+			t.Errorf("Decoded message was rejected: %v", err)
+		}
+	}
+
+	var b Bundle
+	if err := b.UnmarshalBinary(make([]byte, 10)); err == nil {
+		t.Errorf("Decoded a truncated bundle")
+	}
+}